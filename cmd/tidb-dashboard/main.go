@@ -63,6 +63,7 @@ func NewCLIConfig() *DashboardCLIConfig {
 	flag.BoolVarP(&cfg.EnableDebugLog, "debug", "d", false, "enable debug logs")
 	flag.StringVar(&cfg.CoreConfig.DataDir, "data-dir", cfg.CoreConfig.DataDir, "path to the Dashboard Server data directory")
 	flag.StringVar(&cfg.CoreConfig.TempDir, "temp-dir", cfg.CoreConfig.TempDir, "path to the Dashboard Server temporary directory, used to store the searched logs")
+	flag.StringVar(&cfg.CoreConfig.LogSourceDir, "log-source-dir", cfg.CoreConfig.LogSourceDir, "path to the directory of the component log files, which can be read by log search through the file path of log sources")
 	flag.StringVar(&cfg.CoreConfig.PublicPathPrefix, "path-prefix", cfg.CoreConfig.PublicPathPrefix, "public URL path prefix for reverse proxies")
 	flag.StringVar(&cfg.CoreConfig.PDEndPoint, "pd", cfg.CoreConfig.PDEndPoint, "PD endpoint address that Dashboard Server connects to")
 	flag.BoolVar(&cfg.CoreConfig.EnableTelemetry, "telemetry", cfg.CoreConfig.EnableTelemetry, "allow telemetry")
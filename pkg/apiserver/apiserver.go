@@ -6,6 +6,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/gin-contrib/gzip"
@@ -14,6 +15,7 @@ import (
 	cors "github.com/rs/cors/wrapper/gin"
 	"go.uber.org/fx"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/bindings"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/clusterinfo"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/configuration"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/conprof"
@@ -147,6 +149,7 @@ var Modules = fx.Options(
 	profiling.Module,
 	conprof.Module,
 	statement.Module,
+	bindings.Module,
 	slowquery.Module,
 	debugapi.Module,
 	topsql.Module,
@@ -274,7 +277,14 @@ func newAPIHandlerEngine() (apiHandlerEngine *gin.Engine, endpoint *gin.RouterGr
 	apiHandlerEngine = gin.New()
 	apiHandlerEngine.Use(gin.Recovery())
 	apiHandlerEngine.Use(cors.AllowAll())
-	apiHandlerEngine.Use(gzip.Gzip(gzip.DefaultCompression))
+	gzipHandler := gzip.Gzip(gzip.DefaultCompression)
+	apiHandlerEngine.Use(func(c *gin.Context) {
+		// Server-Sent Events must be flushed once written, which is not supported by the gzip writer.
+		if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			return
+		}
+		gzipHandler(c)
+	})
 	apiHandlerEngine.Use(rest.ErrorHandlerFn())
 
 	endpoint = apiHandlerEngine.Group("/dashboard/api")
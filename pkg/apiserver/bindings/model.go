@@ -0,0 +1,69 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package bindings
+
+import "time"
+
+type Scope string
+
+const (
+	ScopeGlobal  Scope = "global"
+	ScopeSession Scope = "session"
+)
+
+type Model struct {
+	Scope       Scope  `gorm:"-" json:"scope"`
+	OriginalSQL string `gorm:"column:original_sql" json:"original_sql"`
+	BindSQL     string `gorm:"column:bind_sql" json:"bind_sql"`
+	DefaultDB   string `gorm:"column:default_db" json:"default_db"`
+	Status      string `gorm:"column:status" json:"status" enums:"enabled,using,disabled,deleted,invalid"`
+	Source      string `gorm:"column:source" json:"source" enums:"manual,history,capture,evolve"`
+	CreateTime  int    `gorm:"column:create_time" json:"create_time"`
+	UpdateTime  int    `gorm:"column:update_time" json:"update_time"`
+	SQLDigest   string `gorm:"column:sql_digest" json:"sql_digest"`
+	PlanDigest  string `gorm:"column:plan_digest" json:"plan_digest"`
+
+	Usage Usage `gorm:"-" json:"usage"`
+}
+
+// Usage shows whether plans are generated from the binding, according to `plan_in_binding` in the statements
+// and `Plan_from_binding` in the slow queries.
+type Usage struct {
+	Used bool `json:"used"`
+	// Number of executions whose plan comes from a binding in the statements.
+	ExecCount int `json:"exec_count"`
+	// Number of slow queries whose plan comes from a binding.
+	SlowQueryCount int `json:"slow_query_count"`
+	LastUsedTime   int `json:"last_used_time"`
+}
+
+// usageModel is the usage of bindings aggregated by (digest, plan_digest).
+type usageModel struct {
+	Digest     string `gorm:"column:digest"`
+	PlanDigest string `gorm:"column:plan_digest"`
+	Count      int    `gorm:"column:count"`
+	LastSeen   int    `gorm:"column:last_seen"`
+}
+
+// sessionBindingModel maps to the response of `SHOW SESSION BINDINGS` query.
+type sessionBindingModel struct {
+	OriginalSQL string    `gorm:"column:Original_sql"`
+	BindSQL     string    `gorm:"column:Bind_sql"`
+	DefaultDB   string    `gorm:"column:Default_db"`
+	Status      string    `gorm:"column:Status"`
+	CreateTime  time.Time `gorm:"column:Create_time"`
+	UpdateTime  time.Time `gorm:"column:Update_time"`
+	Source      string    `gorm:"column:Source"`
+	SQLDigest   string    `gorm:"column:Sql_digest"`
+	PlanDigest  string    `gorm:"column:Plan_digest"`
+}
+
+type BatchResult struct {
+	Succeeded []string      `json:"succeeded"`
+	Failed    []BatchFailed `json:"failed"`
+}
+
+type BatchFailed struct {
+	SQLDigest string `json:"sql_digest"`
+	Error     string `json:"error"`
+}
@@ -0,0 +1,326 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package bindings
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joomcode/errorx"
+	"github.com/samber/lo"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/tidb"
+	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+	"github.com/pingcap/tidb-dashboard/util/featureflag"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	BindInfoTable   = "mysql.bind_info"
+	StatementsTable = "INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY"
+	SlowQueryTable  = "INFORMATION_SCHEMA.CLUSTER_SLOW_QUERY"
+
+	defaultUsageDuration = 24 * time.Hour
+)
+
+var (
+	ErrNS            = errorx.NewNamespace("error.api.bindings")
+	ErrInvalidDigest = ErrNS.NewType("invalid_digest")
+
+	digestInjectChecker = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+)
+
+type ServiceParams struct {
+	fx.In
+	TiDBClient *tidb.Client
+	SysSchema  *commonUtils.SysSchema
+}
+
+type Service struct {
+	params             ServiceParams
+	bindingFeatureFlag *featureflag.FeatureFlag
+}
+
+func newService(p ServiceParams, ff *featureflag.Registry) *Service {
+	return &Service{
+		params:             p,
+		bindingFeatureFlag: ff.Register("binding_management", ">= 6.5.0"),
+	}
+}
+
+func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
+	endpoint := r.Group("/bindings")
+	endpoint.Use(
+		auth.MWAuthRequired(),
+		s.bindingFeatureFlag.VersionGuard(),
+		utils.MWConnectTiDB(s.params.TiDBClient),
+	)
+	{
+		endpoint.GET("/list", s.getList)
+		endpoint.POST("/enable", auth.MWRequireWritePriv(), s.enableBindings)
+		endpoint.POST("/disable", auth.MWRequireWritePriv(), s.disableBindings)
+		endpoint.POST("/drop", auth.MWRequireWritePriv(), s.dropBindings)
+	}
+}
+
+type GetListRequest struct {
+	// Session bindings only belong to the SQL connection created by the dashboard, so that they are usually empty.
+	Scope          Scope `json:"scope" form:"scope" enums:"global,session"`
+	IncludeDeleted bool  `json:"include_deleted" form:"include_deleted"`
+	// The time range to check the usage of the bindings. Defaults to the last 24 hours.
+	BeginTime int `json:"begin_time" form:"begin_time"`
+	EndTime   int `json:"end_time" form:"end_time"`
+}
+
+// @Summary List bindings with their usage
+// @Param q query GetListRequest true "Query"
+// @Success 200 {array} Model
+// @Router /bindings/list [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) getList(c *gin.Context) {
+	var req GetListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.EndTime == 0 {
+		req.EndTime = int(time.Now().Unix())
+	}
+	if req.BeginTime == 0 {
+		req.BeginTime = req.EndTime - int(defaultUsageDuration.Seconds())
+	}
+
+	db := utils.GetTiDBConnection(c)
+	var results []Model
+	var err error
+	switch req.Scope {
+	case "", ScopeGlobal:
+		results, err = s.queryGlobalBindings(db, req.IncludeDeleted)
+	case ScopeSession:
+		results, err = querySessionBindings(db, req.IncludeDeleted)
+	default:
+		rest.Error(c, rest.ErrBadRequest.New("unknown scope %s", req.Scope))
+		return
+	}
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	if err := s.fillUsage(db, results, req.BeginTime, req.EndTime); err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+type BatchRequest struct {
+	SQLDigests []string `json:"sql_digests" binding:"required"`
+}
+
+// @Summary Enable global bindings
+// @Param request body BatchRequest true "Request body"
+// @Success 200 {object} BatchResult
+// @Router /bindings/enable [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) enableBindings(c *gin.Context) {
+	s.handleBatch(c, "SET BINDING ENABLED FOR SQL DIGEST '%s'")
+}
+
+// @Summary Disable global bindings
+// @Param request body BatchRequest true "Request body"
+// @Success 200 {object} BatchResult
+// @Router /bindings/disable [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) disableBindings(c *gin.Context) {
+	s.handleBatch(c, "SET BINDING DISABLED FOR SQL DIGEST '%s'")
+}
+
+// @Summary Drop global bindings
+// @Param request body BatchRequest true "Request body"
+// @Success 200 {object} BatchResult
+// @Router /bindings/drop [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) dropBindings(c *gin.Context) {
+	s.handleBatch(c, "DROP GLOBAL BINDING FOR SQL DIGEST '%s'")
+}
+
+// handleBatch executes the statement for each digest. A failure does not stop the rest digests.
+func (s *Service) handleBatch(c *gin.Context, stmtFormat string) {
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	// Caution! SQL injection vulnerability!
+	// We have to interpolate sql string here, since binding stmt does not support session level prepare.
+	for _, digest := range req.SQLDigests {
+		if !digestInjectChecker.MatchString(digest) {
+			rest.Error(c, ErrInvalidDigest.New("invalid sql digest %s", digest))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, executeBatch(utils.GetTiDBConnection(c), stmtFormat, req.SQLDigests))
+}
+
+func executeBatch(db *gorm.DB, stmtFormat string, digests []string) BatchResult {
+	result := BatchResult{
+		Succeeded: []string{},
+		Failed:    []BatchFailed{},
+	}
+	for _, digest := range lo.Uniq(digests) {
+		if err := db.Exec(fmt.Sprintf(stmtFormat, digest)).Error; err != nil {
+			result.Failed = append(result.Failed, BatchFailed{SQLDigest: digest, Error: err.Error()})
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, digest)
+	}
+	return result
+}
+
+func (s *Service) queryGlobalBindings(db *gorm.DB, includeDeleted bool) ([]Model, error) {
+	columns, err := s.params.SysSchema.GetTableColumnNames(db, BindInfoTable)
+	if err != nil {
+		return nil, err
+	}
+	selectStmt := []string{
+		"original_sql",
+		"bind_sql",
+		"default_db",
+		"status",
+		"source",
+		"FLOOR(UNIX_TIMESTAMP(create_time)) AS create_time",
+		"FLOOR(UNIX_TIMESTAMP(update_time)) AS update_time",
+	}
+	// digest columns are not available in old versions
+	for _, col := range []string{"sql_digest", "plan_digest"} {
+		if utils.IsSubsetICaseInsensitive(columns, []string{col}) {
+			selectStmt = append(selectStmt, fmt.Sprintf("IFNULL(%s, '') AS %s", col, col))
+		} else {
+			selectStmt = append(selectStmt, fmt.Sprintf("'' AS %s", col))
+		}
+	}
+
+	query := db.
+		Table(BindInfoTable).
+		Select(strings.Join(selectStmt, ", ")).
+		// the pseudo binding used as a lock
+		Where("source != ?", "builtin").
+		Order("create_time DESC")
+	if !includeDeleted {
+		query = query.Where("status != ?", "deleted")
+	}
+	var results []Model
+	if err := query.Find(&results).Error; err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Scope = ScopeGlobal
+	}
+	return results, nil
+}
+
+func querySessionBindings(db *gorm.DB, includeDeleted bool) ([]Model, error) {
+	var bindings []sessionBindingModel
+	if err := db.Raw("SHOW SESSION BINDINGS").Scan(&bindings).Error; err != nil {
+		return nil, err
+	}
+	results := make([]Model, 0, len(bindings))
+	for _, b := range bindings {
+		if !includeDeleted && b.Status == "deleted" {
+			continue
+		}
+		results = append(results, Model{
+			Scope:       ScopeSession,
+			OriginalSQL: b.OriginalSQL,
+			BindSQL:     b.BindSQL,
+			DefaultDB:   b.DefaultDB,
+			Status:      b.Status,
+			Source:      b.Source,
+			CreateTime:  int(b.CreateTime.Unix()),
+			UpdateTime:  int(b.UpdateTime.Unix()),
+			SQLDigest:   b.SQLDigest,
+			PlanDigest:  b.PlanDigest,
+		})
+	}
+	return results, nil
+}
+
+// fillUsage fills the usage of the bindings. A binding is regarded as used by a statement if the statement
+// digest is the same as the binding digest, or the plan digest is the same as the one that the binding is
+// created from.
+func (s *Service) fillUsage(db *gorm.DB, bindings []Model, beginTime, endTime int) error {
+	if len(bindings) == 0 {
+		return nil
+	}
+	stmtUsages, err := s.queryUsage(db, StatementsTable, "plan_in_binding", func(query *gorm.DB) *gorm.DB {
+		return query.
+			Select("digest, plan_digest, SUM(exec_count) AS count, FLOOR(UNIX_TIMESTAMP(MAX(last_seen))) AS last_seen").
+			Where("plan_in_binding = 1").
+			Where("summary_begin_time <= FROM_UNIXTIME(?) AND summary_end_time >= FROM_UNIXTIME(?)", endTime, beginTime).
+			Group("digest, plan_digest")
+	})
+	if err != nil {
+		return err
+	}
+	slowUsages, err := s.queryUsage(db, SlowQueryTable, "Plan_from_binding", func(query *gorm.DB) *gorm.DB {
+		return query.
+			Select("Digest AS digest, Plan_digest AS plan_digest, COUNT(*) AS count, FLOOR(UNIX_TIMESTAMP(MAX(Time))) AS last_seen").
+			Where("Plan_from_binding = 1").
+			Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", beginTime, endTime).
+			Group("Digest, Plan_digest")
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range bindings {
+		b := &bindings[i]
+		matched := func(u usageModel) bool {
+			return (b.SQLDigest != "" && u.Digest == b.SQLDigest) || (b.PlanDigest != "" && u.PlanDigest == b.PlanDigest)
+		}
+		for _, u := range lo.Filter(stmtUsages, func(u usageModel, _ int) bool { return matched(u) }) {
+			b.Usage.ExecCount += u.Count
+			b.Usage.LastUsedTime = lo.Max([]int{b.Usage.LastUsedTime, u.LastSeen})
+		}
+		for _, u := range lo.Filter(slowUsages, func(u usageModel, _ int) bool { return matched(u) }) {
+			b.Usage.SlowQueryCount += u.Count
+			b.Usage.LastUsedTime = lo.Max([]int{b.Usage.LastUsedTime, u.LastSeen})
+		}
+		b.Usage.Used = b.Usage.ExecCount > 0 || b.Usage.SlowQueryCount > 0
+	}
+	return nil
+}
+
+// queryUsage returns nothing if the table does not contain the column indicating the plan is from a binding.
+func (s *Service) queryUsage(db *gorm.DB, table string, column string, build func(*gorm.DB) *gorm.DB) ([]usageModel, error) {
+	columns, err := s.params.SysSchema.GetTableColumnNames(db, table)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.IsSubsetICaseInsensitive(columns, []string{column}) {
+		return nil, nil
+	}
+	var results []usageModel
+	err = build(db.Session(&gorm.Session{NewDB: true}).Table(table)).Find(&results).Error
+	return results, err
+}
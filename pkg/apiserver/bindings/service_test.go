@@ -0,0 +1,105 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package bindings
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func newTestService() *Service {
+	return &Service{params: ServiceParams{SysSchema: commonUtils.NewSysSchema()}}
+}
+
+func TestQueryGlobalBindings(t *testing.T) {
+	s := newTestService()
+	defer s.params.SysSchema.Close()
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	// plan_digest is not available in old versions
+	db.Mocker().
+		ExpectQuery("DESC mysql.bind_info").
+		WillReturnRows(sqlmock.NewRows([]string{"Field"}).AddRow("original_sql").AddRow("sql_digest"))
+	db.Mocker().
+		ExpectQuery("SELECT original_sql, bind_sql, default_db, status, source, "+
+			"FLOOR(UNIX_TIMESTAMP(create_time)) AS create_time, FLOOR(UNIX_TIMESTAMP(update_time)) AS update_time, "+
+			"IFNULL(sql_digest, '') AS sql_digest, '' AS plan_digest "+
+			"FROM `mysql`.`bind_info` WHERE source != ? AND status != ? ORDER BY create_time DESC").
+		WithArgs("builtin", "deleted").
+		WillReturnRows(sqlmock.NewRows([]string{"original_sql", "status", "sql_digest", "plan_digest"}).
+			AddRow("select * from t where a = ?", "enabled", "d1", ""))
+
+	results, err := s.queryGlobalBindings(db.Gorm(), false)
+	require.NoError(t, err)
+	require.Equal(t, []Model{
+		{Scope: ScopeGlobal, OriginalSQL: "select * from t where a = ?", Status: "enabled", SQLDigest: "d1"},
+	}, results)
+	db.MustMeetMockExpectation()
+}
+
+func TestFillUsage(t *testing.T) {
+	s := newTestService()
+	defer s.params.SysSchema.Close()
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	db.Mocker().
+		ExpectQuery("DESC " + StatementsTable).
+		WillReturnRows(sqlmock.NewRows([]string{"Field"}).AddRow("digest").AddRow("plan_in_binding"))
+	db.Mocker().
+		ExpectQuery("SELECT digest, plan_digest, SUM(exec_count) AS count, FLOOR(UNIX_TIMESTAMP(MAX(last_seen))) AS last_seen "+
+			"FROM `INFORMATION_SCHEMA`.`CLUSTER_STATEMENTS_SUMMARY_HISTORY` WHERE plan_in_binding = 1 "+
+			"AND (summary_begin_time <= FROM_UNIXTIME(?) AND summary_end_time >= FROM_UNIXTIME(?)) GROUP BY digest, plan_digest").
+		WithArgs(200, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"digest", "plan_digest", "count", "last_seen"}).
+			AddRow("d1", "p1", 10, 150).
+			AddRow("d1", "p2", 5, 160).
+			AddRow("d2", "p3", 7, 170).
+			AddRow("d3", "p4", 1, 180))
+	// Plan_from_binding is not available in old versions, so that no slow query is counted
+	db.Mocker().
+		ExpectQuery("DESC " + SlowQueryTable).
+		WillReturnRows(sqlmock.NewRows([]string{"Field"}).AddRow("Digest"))
+
+	bindings := []Model{
+		{SQLDigest: "d1"},
+		// created from the plan p3 of a statement whose digest is different from the binding
+		{SQLDigest: "d4", PlanDigest: "p3"},
+		{SQLDigest: "d5"},
+	}
+	require.NoError(t, s.fillUsage(db.Gorm(), bindings, 100, 200))
+	require.Equal(t, Usage{Used: true, ExecCount: 15, LastUsedTime: 160}, bindings[0].Usage)
+	require.Equal(t, Usage{Used: true, ExecCount: 7, LastUsedTime: 170}, bindings[1].Usage)
+	require.Equal(t, Usage{}, bindings[2].Usage)
+	db.MustMeetMockExpectation()
+}
+
+func TestExecuteBatch(t *testing.T) {
+	db := testutil.OpenMockDB(t)
+	defer db.MustClose()
+
+	db.Mocker().
+		ExpectExec("DROP GLOBAL BINDING FOR SQL DIGEST 'd1'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mocker().
+		ExpectExec("DROP GLOBAL BINDING FOR SQL DIGEST 'd2'").
+		WillReturnError(errors.New("binding not found"))
+	db.Mocker().
+		ExpectExec("DROP GLOBAL BINDING FOR SQL DIGEST 'd3'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// A failure does not stop the rest digests, and duplicated digests are executed once.
+	result := executeBatch(db.Gorm(), "DROP GLOBAL BINDING FOR SQL DIGEST '%s'", []string{"d1", "d2", "d1", "d3"})
+	require.Equal(t, BatchResult{
+		Succeeded: []string{"d1", "d3"},
+		Failed:    []BatchFailed{{SQLDigest: "d2", Error: "binding not found"}},
+	}, result)
+	db.MustMeetMockExpectation()
+}
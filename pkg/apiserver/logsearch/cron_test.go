@@ -0,0 +1,76 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testCronSuite{})
+
+type testCronSuite struct{}
+
+func (t *testCronSuite) Test_parseCronSchedule(c *check.C) {
+	for _, spec := range []string{"* * * * *", "*/5 9-17 * * 1-5", "0,30 0 1 1,7 *", "5-50/15 * * * 0"} {
+		_, err := parseCronSchedule(spec)
+		c.Assert(err, check.IsNil, check.Commentf("spec %s", spec))
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCronSchedule(spec)
+		c.Assert(err, check.NotNil, check.Commentf("spec %s", spec))
+	}
+}
+
+func (t *testCronSuite) Test_cronScheduleNext(c *check.C) {
+	// 2024-01-01 is a Monday
+	now := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2024, 1, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week
+		{"0 0 15 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tc := range cases {
+		schedule, err := parseCronSchedule(tc.spec)
+		c.Assert(err, check.IsNil)
+		c.Assert(schedule.Next(now).Equal(tc.next), check.IsTrue, check.Commentf("spec %s, got %v", tc.spec, schedule.Next(now)))
+	}
+}
+
+func (t *testCronSuite) Test_diffPatterns(c *check.C) {
+	current := []*LogPatternModel{
+		{Template: "a <*>", Level: 2, Count: 10},
+		{Template: "b", Level: 3, Count: 1},
+	}
+	previous := []*LogPatternModel{
+		{Template: "a <*>", Level: 2, Count: 4},
+		{Template: "c", Level: 4, Count: 2},
+	}
+	c.Assert(diffPatterns(current, previous, false, false), check.DeepEquals, []PatternDiff{
+		{Template: "a <*>", Level: 2, Count: 10, PreviousCount: 4, Delta: 6},
+		{Template: "b", Level: 3, Count: 1, Delta: 1},
+		{Template: "c", Level: 4, PreviousCount: 2, Delta: -2},
+	})
+
+	// The templates absent from a truncated run are missing instead of 0.
+	c.Assert(diffPatterns(current, previous, false, true), check.DeepEquals, []PatternDiff{
+		{Template: "a <*>", Level: 2, Count: 10, PreviousCount: 4, Delta: 6},
+		{Template: "c", Level: 4, PreviousCount: 2, Delta: -2},
+		{Template: "b", Level: 3, Count: 1, PreviousMissing: true},
+	})
+	c.Assert(diffPatterns(current, previous, true, false), check.DeepEquals, []PatternDiff{
+		{Template: "a <*>", Level: 2, Count: 10, PreviousCount: 4, Delta: 6},
+		{Template: "b", Level: 3, Count: 1, Delta: 1},
+		{Template: "c", Level: 4, PreviousCount: 2, Missing: true},
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	// Long values like SQL texts are not useful for faceting, so that they are not extracted.
+	maxLogFieldValueLen = 128
+
+	DefaultFacetLimit = 10
+	MaxFacetLimit     = 100
+)
+
+// LogFieldModel is a `[key=value]` field extracted from an indexed log line.
+type LogFieldModel struct {
+	ID          uint   `json:"id" gorm:"primary_key"`
+	LineID      uint   `json:"line_id" gorm:"index"`
+	TaskID      uint   `json:"task_id" gorm:"index"`
+	TaskGroupID uint   `json:"task_group_id" gorm:"index:idx_log_fields_task_group_key_value,priority:1"`
+	Key         string `json:"key" gorm:"size:64;index:idx_log_fields_task_group_key_value,priority:2"`
+	Value       string `json:"value" gorm:"size:128;index:idx_log_fields_task_group_key_value,priority:3"`
+}
+
+func (LogFieldModel) TableName() string {
+	return "log_fields"
+}
+
+type logField struct {
+	Key   string
+	Value string
+}
+
+func isLogFieldKeyChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parseLogFields extracts the `[key=value]` fields of a message in the unified log format, e.g.
+// `[server.go:100] ["connection closed"] [conn=5] [sql="select \"a\""]`. Values are quoted when they contain
+// special characters, and are unquoted here.
+func parseLogFields(message string) []logField {
+	fields := make([]logField, 0)
+	for i := 0; i < len(message); i++ {
+		if message[i] != '[' {
+			continue
+		}
+		keyEnd := i + 1
+		for keyEnd < len(message) && isLogFieldKeyChar(message[keyEnd]) {
+			keyEnd++
+		}
+		if keyEnd == i+1 || keyEnd >= len(message) || message[keyEnd] != '=' {
+			continue
+		}
+		key := message[i+1 : keyEnd]
+
+		valueBegin := keyEnd + 1
+		var value string
+		var end int
+		if valueBegin < len(message) && message[valueBegin] == '"' {
+			// find the closing quote which is not escaped
+			end = valueBegin + 1
+			for end < len(message) && message[end] != '"' {
+				if message[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end+1 >= len(message) || message[end+1] != ']' {
+				continue
+			}
+			unquoted, err := strconv.Unquote(message[valueBegin : end+1])
+			if err != nil {
+				continue
+			}
+			value = unquoted
+			end++
+		} else {
+			end = strings.IndexByte(message[valueBegin:], ']')
+			if end < 0 {
+				break
+			}
+			end += valueBegin
+			value = message[valueBegin:end]
+		}
+		i = end
+		if len(value) > maxLogFieldValueLen {
+			continue
+		}
+		fields = append(fields, logField{Key: key, Value: value})
+	}
+	return fields
+}
+
+// buildLogFields extracts the fields of the lines which are already saved.
+func buildLogFields(lines []*LogIndexModel) []*LogFieldModel {
+	models := make([]*LogFieldModel, 0)
+	for _, line := range lines {
+		for _, f := range parseLogFields(line.Message) {
+			models = append(models, &LogFieldModel{
+				LineID:      line.ID,
+				TaskID:      line.TaskID,
+				TaskGroupID: line.TaskGroupID,
+				Key:         f.Key,
+				Value:       f.Value,
+			})
+		}
+	}
+	return models
+}
+
+// fillLogFields attaches the extracted fields to the lines.
+func fillLogFields(db *dbstore.DB, lines []*LogIndexModel) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ID)
+	}
+	var fields []*LogFieldModel
+	if err := db.Where("line_id IN ?", ids).Order("id").Find(&fields).Error; err != nil {
+		return err
+	}
+	fieldsOf := make(map[uint]map[string]string, len(lines))
+	for _, f := range fields {
+		if fieldsOf[f.LineID] == nil {
+			fieldsOf[f.LineID] = make(map[string]string)
+		}
+		fieldsOf[f.LineID][f.Key] = f.Value
+	}
+	for _, line := range lines {
+		line.Fields = fieldsOf[line.ID]
+	}
+	return nil
+}
+
+type GetFacetsRequest struct {
+	// Fields to count, the most frequent fields are counted if empty.
+	Fields []string `json:"fields" form:"fields"`
+	// Max number of values of each field.
+	Limit int `json:"limit" form:"limit"`
+}
+
+type LogFacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type LogFacet struct {
+	Field  string          `json:"field"`
+	Count  int64           `json:"count"`
+	Values []LogFacetValue `json:"values" gorm:"-"`
+}
+
+func queryLogFacets(db *dbstore.DB, taskGroupID uint, req *GetFacetsRequest) ([]LogFacet, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultFacetLimit
+	}
+	if limit > MaxFacetLimit {
+		limit = MaxFacetLimit
+	}
+
+	var facets []LogFacet
+	tx := db.Model(&LogFieldModel{}).
+		Select("key AS field, COUNT(*) AS count").
+		Where("task_group_id = ?", taskGroupID).
+		Group("key").
+		Order("count DESC, key")
+	if len(req.Fields) > 0 {
+		tx = tx.Where("key IN ?", req.Fields)
+	} else {
+		tx = tx.Limit(MaxFacetLimit)
+	}
+	if err := tx.Scan(&facets).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range facets {
+		err := db.Model(&LogFieldModel{}).
+			Select("value, COUNT(*) AS count").
+			Where("task_group_id = ? AND key = ?", taskGroupID, facets[i].Field).
+			Group("value").
+			Order("count DESC, value").
+			Limit(limit).
+			Scan(&facets[i].Values).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return facets, nil
+}
+
+// parseFieldFilter parses a filter in the `key=value` form.
+func parseFieldFilter(filter string) (logField, bool) {
+	key, value, ok := strings.Cut(filter, "=")
+	if !ok || key == "" {
+		return logField{}, false
+	}
+	return logField{Key: key, Value: value}, true
+}
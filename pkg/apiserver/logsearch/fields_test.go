@@ -0,0 +1,47 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"testing"
+
+	"github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	check.CustomVerboseFlag = true
+	check.TestingT(t)
+}
+
+var _ = check.Suite(&testFieldsSuite{})
+
+type testFieldsSuite struct{}
+
+func (t *testFieldsSuite) Test_parseLogFields(c *check.C) {
+	fields := parseLogFields(`[server.go:100] ["connection closed"] [conn=5] [txn_start_ts=449] [sql="select \"a]\" from t"] [range="[a, b)"] [empty=]`)
+	c.Assert(fields, check.DeepEquals, []logField{
+		{Key: "conn", Value: "5"},
+		{Key: "txn_start_ts", Value: "449"},
+		{Key: "sql", Value: `select "a]" from t`},
+		{Key: "range", Value: "[a, b)"},
+		{Key: "empty", Value: ""},
+	})
+
+	c.Assert(parseLogFields(`["a=b"] [no_value] [region_id=1`), check.HasLen, 0)
+	c.Assert(parseLogFields(`[region_id=1] [bad="unterminated]`), check.DeepEquals, []logField{{Key: "region_id", Value: "1"}})
+}
+
+func (t *testFieldsSuite) Test_parseFieldFilter(c *check.C) {
+	field, ok := parseFieldFilter("region_id=1234")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(field, check.Equals, logField{Key: "region_id", Value: "1234"})
+
+	field, ok = parseFieldFilter("sql=a=b")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(field.Value, check.Equals, "a=b")
+
+	_, ok = parseFieldFilter("region_id")
+	c.Assert(ok, check.IsFalse)
+	_, ok = parseFieldFilter("=1")
+	c.Assert(ok, check.IsFalse)
+}
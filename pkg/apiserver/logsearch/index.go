@@ -0,0 +1,264 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	logIndexBatchSize = 1000
+	// Approximate size of a row besides the texts.
+	logIndexRowOverhead = config.LogIndexLineOverheadBytes
+
+	DefaultQueryLogLimit = 100
+	MaxQueryLogLimit     = 1000
+)
+
+// LogIndexModel is a log line of a finished task, which is indexed for full-text searching.
+type LogIndexModel struct {
+	ID          uint                   `json:"id" gorm:"primary_key"`
+	TaskID      uint                   `json:"task_id" gorm:"index"`
+	TaskGroupID uint                   `json:"task_group_id" gorm:"index:idx_log_index_lines_task_group_time,priority:1"`
+	Time        int64                  `json:"time" gorm:"index:idx_log_index_lines_task_group_time,priority:2"`
+	Level       diagnosticspb.LogLevel `json:"level" gorm:"type:integer" swaggertype:"integer"`
+	Message     string                 `json:"message" gorm:"type:text"`
+	// Fields extracted from the message, only filled in query results.
+	Fields map[string]string `json:"fields,omitempty" gorm:"-"`
+}
+
+func (LogIndexModel) TableName() string {
+	return "log_index_lines"
+}
+
+// The FTS table uses `log_index_lines` as the external content table, and is kept in sync by triggers, so that
+// messages are not stored twice. FTS4 is used because FTS5 is only available with the `sqlite_fts5` build tag.
+var logIndexFTSStmts = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS log_index_fts USING fts4(content="log_index_lines", message)`,
+	`CREATE TRIGGER IF NOT EXISTS log_index_lines_ai AFTER INSERT ON log_index_lines BEGIN
+		INSERT INTO log_index_fts(docid, message) VALUES (new.id, new.message);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS log_index_lines_bd BEFORE DELETE ON log_index_lines BEGIN
+		DELETE FROM log_index_fts WHERE docid = old.id;
+	END`,
+}
+
+func autoMigrateLogIndex(db *dbstore.DB) error {
+	if err := db.AutoMigrate(&LogIndexModel{}, &LogFieldModel{}); err != nil {
+		return err
+	}
+	for _, stmt := range logIndexFTSStmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logIndexer writes log lines into the index in batches. Indexing is stopped at the first error, since the logs
+// are still available for downloading. The error is kept in the task, so that queries can tell the result is
+// partial.
+type logIndexer struct {
+	db          *dbstore.DB
+	mu          *sync.Mutex
+	quota       *diskQuota
+	taskID      uint
+	taskGroupID uint
+	buf         []*LogIndexModel
+	lines       int
+	// Lines after the limit are still available for downloading, but not indexed.
+	maxLines int
+	// Approximate size of the saved lines and fields. The full-text index is assumed to be as large as the
+	// messages.
+	size     int64
+	reserved int64
+	err      error
+}
+
+func newLogIndexer(db *dbstore.DB, mu *sync.Mutex, quota *diskQuota, taskID, taskGroupID uint, maxLines int) *logIndexer {
+	return &logIndexer{
+		db:          db,
+		mu:          mu,
+		quota:       quota,
+		taskID:      taskID,
+		taskGroupID: taskGroupID,
+		maxLines:    maxLines,
+		buf:         make([]*LogIndexModel, 0, logIndexBatchSize),
+	}
+}
+
+func (ix *logIndexer) Add(msg *diagnosticspb.LogMessage) {
+	if ix.err != nil {
+		return
+	}
+	if ix.lines >= ix.maxLines {
+		ix.Flush()
+		if ix.err == nil {
+			ix.err = fmt.Errorf("only the first %d lines are indexed", ix.maxLines)
+		}
+		return
+	}
+	ix.lines++
+	ix.buf = append(ix.buf, &LogIndexModel{
+		TaskID:      ix.taskID,
+		TaskGroupID: ix.taskGroupID,
+		Time:        msg.Time,
+		Level:       msg.Level,
+		Message:     msg.Message,
+	})
+	if len(ix.buf) >= logIndexBatchSize {
+		ix.Flush()
+	}
+}
+
+func (ix *logIndexer) Flush() {
+	if ix.err != nil || len(ix.buf) == 0 {
+		return
+	}
+	defer func() {
+		ix.buf = ix.buf[:0]
+	}()
+
+	var size int64
+	// Tasks are running concurrently, and their writes are serialized to avoid failing with SQLITE_BUSY.
+	ix.mu.Lock()
+	err := ix.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(ix.buf, logIndexBatchSize).Error; err != nil {
+			return err
+		}
+		for _, line := range ix.buf {
+			size += int64(2*len(line.Message) + logIndexRowOverhead)
+		}
+		fields := buildLogFields(ix.buf)
+		for _, f := range fields {
+			size += int64(len(f.Key) + len(f.Value) + logIndexRowOverhead)
+		}
+		return tx.CreateInBatches(fields, logIndexBatchSize).Error
+	})
+	ix.mu.Unlock()
+	if err == nil {
+		ix.size += size
+		ix.reserved += size
+		err = ix.quota.Reserve(size)
+	}
+	if err != nil {
+		log.Warn("Failed to index logs", zap.Uint("task_id", ix.taskID), zap.Error(err))
+		ix.err = err
+	}
+}
+
+type QueryLogRequest struct {
+	// Display names of the instances, all instances are queried if empty.
+	Instances []string   `json:"instances" form:"instances"`
+	Levels    []LogLevel `json:"levels" form:"levels"`
+	// Extracted fields in the `key=value` form, e.g. `region_id=1234`. Lines must match all fields.
+	Fields []string `json:"fields" form:"fields"`
+	// unix timestamp in milliseconds
+	BeginTime int64  `json:"begin_time" form:"begin_time"`
+	EndTime   int64  `json:"end_time" form:"end_time"`
+	Phrase    string `json:"phrase" form:"phrase"`
+	Offset    int    `json:"offset" form:"offset"`
+	Limit     int    `json:"limit" form:"limit"`
+}
+
+type TaskIndexError struct {
+	TaskID   uint   `json:"task_id"`
+	Instance string `json:"instance"`
+	Error    string `json:"error"`
+}
+
+type QueryLogResponse struct {
+	Total int64            `json:"total"`
+	Lines []*LogIndexModel `json:"lines"`
+	// The tasks whose lines are not all indexed, so that the result may be partial.
+	IndexErrors []TaskIndexError `json:"index_errors"`
+}
+
+// buildMatchPhrase quotes the phrase, so that it is matched as a whole instead of being parsed as FTS operators.
+func buildMatchPhrase(phrase string) string {
+	return `"` + strings.ReplaceAll(phrase, `"`, `""`) + `"`
+}
+
+func queryLogIndex(db *dbstore.DB, taskGroupID uint, req *QueryLogRequest) (*QueryLogResponse, error) {
+	tx := db.Model(&LogIndexModel{}).Where("log_index_lines.task_group_id = ?", taskGroupID)
+	if len(req.Instances) > 0 {
+		tasks := db.Model(&TaskModel{}).
+			Select("id").
+			Where("task_group_id = ? AND display_name IN ?", taskGroupID, req.Instances)
+		tx = tx.Where("log_index_lines.task_id IN (?)", tasks)
+	}
+	for _, filter := range req.Fields {
+		field, ok := parseFieldFilter(filter)
+		if !ok {
+			return nil, rest.ErrBadRequest.New("Invalid field filter %s", filter)
+		}
+		lines := db.Model(&LogFieldModel{}).
+			Select("line_id").
+			Where("task_group_id = ? AND key = ? AND value = ?", taskGroupID, field.Key, field.Value)
+		tx = tx.Where("log_index_lines.id IN (?)", lines)
+	}
+	if len(req.Levels) > 0 {
+		tx = tx.Where("log_index_lines.level IN ?", req.Levels)
+	}
+	if req.BeginTime > 0 {
+		tx = tx.Where("log_index_lines.time >= ?", req.BeginTime)
+	}
+	if req.EndTime > 0 {
+		tx = tx.Where("log_index_lines.time <= ?", req.EndTime)
+	}
+	if phrase := strings.TrimSpace(req.Phrase); phrase != "" {
+		tx = tx.
+			Joins("JOIN log_index_fts ON log_index_fts.docid = log_index_lines.id").
+			Where("log_index_fts MATCH ?", buildMatchPhrase(phrase))
+	}
+
+	resp := &QueryLogResponse{}
+	if err := tx.Session(&gorm.Session{}).Count(&resp.Total).Error; err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLogLimit
+	}
+	if limit > MaxQueryLogLimit {
+		limit = MaxQueryLogLimit
+	}
+	err := tx.
+		Select("log_index_lines.*").
+		Order("log_index_lines.time, log_index_lines.id").
+		Offset(req.Offset).
+		Limit(limit).
+		Find(&resp.Lines).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := fillLogFields(db, resp.Lines); err != nil {
+		return nil, err
+	}
+
+	var tasks []*TaskModel
+	if err := db.Where("task_group_id = ? AND index_error IS NOT NULL", taskGroupID).Order("id").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	resp.IndexErrors = make([]TaskIndexError, 0, len(tasks))
+	for _, task := range tasks {
+		resp.IndexErrors = append(resp.IndexErrors, TaskIndexError{
+			TaskID:   task.ID,
+			Instance: task.Target.DisplayName,
+			Error:    *task.IndexError,
+		})
+	}
+	return resp, nil
+}
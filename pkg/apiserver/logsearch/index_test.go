@@ -0,0 +1,93 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = check.Suite(&testIndexSuite{})
+
+type testIndexSuite struct{}
+
+func (t *testIndexSuite) Test_queryLogIndex(c *check.C) {
+	s := newTestService(c)
+	tidb := newTestTask(c, s, model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "127.0.0.1:4000", IP: "127.0.0.1", Port: 4000})
+	tikv := newTestTask(c, s, model.RequestTargetNode{Kind: model.NodeKindTiKV, DisplayName: "127.0.0.1:20160", IP: "127.0.0.1", Port: 20160})
+	// Put both tasks into the same task group.
+	tikv.model.TaskGroupID = tidb.model.TaskGroupID
+	c.Assert(s.db.Save(tikv.model).Error, check.IsNil)
+	tikv.indexer.taskGroupID = tidb.model.TaskGroupID
+
+	tidb.indexer.Add(&diagnosticspb.LogMessage{Time: 1000, Level: diagnosticspb.LogLevel_Info, Message: `["new connection"] [conn=1]`})
+	tidb.indexer.Add(&diagnosticspb.LogMessage{Time: 3000, Level: diagnosticspb.LogLevel_Warn, Message: `["slow query"] [conn=2] [sql="select 1"]`})
+	tikv.indexer.Add(&diagnosticspb.LogMessage{Time: 2000, Level: diagnosticspb.LogLevel_Warn, Message: `["Slow Query handled"] [region_id=5]`})
+	tidb.indexer.Flush()
+	tikv.indexer.Flush()
+	c.Assert(tidb.indexer.err, check.IsNil)
+	c.Assert(tidb.indexer.size > 0, check.IsTrue)
+	groupID := tidb.model.TaskGroupID
+
+	resp, err := queryLogIndex(s.db, groupID, &QueryLogRequest{})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(3))
+	c.Assert(resp.Lines[1].Time, check.Equals, int64(2000))
+	c.Assert(resp.IndexErrors, check.HasLen, 0)
+
+	// The phrase is matched through the FTS table, as whole words ignoring the case.
+	resp, err = queryLogIndex(s.db, groupID, &QueryLogRequest{Phrase: "slow query"})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(2))
+	resp, err = queryLogIndex(s.db, groupID, &QueryLogRequest{Phrase: "slow query", Instances: []string{"127.0.0.1:4000"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(1))
+	c.Assert(resp.Lines[0].Fields, check.DeepEquals, map[string]string{"conn": "2", "sql": "select 1"})
+	resp, err = queryLogIndex(s.db, groupID, &QueryLogRequest{Phrase: "quer"})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(0))
+
+	resp, err = queryLogIndex(s.db, groupID, &QueryLogRequest{Fields: []string{"conn=1"}, Levels: []LogLevel{LogLevelInfo}})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(1))
+	resp, err = queryLogIndex(s.db, groupID, &QueryLogRequest{BeginTime: 1500, EndTime: 2500})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(1))
+	_, err = queryLogIndex(s.db, groupID, &QueryLogRequest{Fields: []string{"conn"}})
+	c.Assert(err, check.NotNil)
+
+	// The FTS rows are removed with the lines by the trigger.
+	tikv.model.RemoveDataAndPreview(s.db)
+	resp, err = queryLogIndex(s.db, groupID, &QueryLogRequest{Phrase: "slow query"})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(1))
+	var ftsRows int64
+	c.Assert(s.db.Raw("SELECT COUNT(*) FROM log_index_fts WHERE log_index_fts MATCH ?", `"handled"`).Scan(&ftsRows).Error, check.IsNil)
+	c.Assert(ftsRows, check.Equals, int64(0))
+}
+
+func (t *testIndexSuite) Test_indexLimit(c *check.C) {
+	s := newTestService(c)
+	const maxLines = 100
+	s.maxIndexedLines.Store(maxLines)
+	task := newTestTask(c, s, model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "127.0.0.1:4000", IP: "127.0.0.1", Port: 4000})
+	for i := 0; i <= maxLines; i++ {
+		task.indexer.Add(&diagnosticspb.LogMessage{Time: int64(i), Level: diagnosticspb.LogLevel_Info, Message: "line"})
+	}
+	task.indexer.Flush()
+	task.saveIndexState()
+	c.Assert(s.db.Save(task.model).Error, check.IsNil)
+	c.Assert(task.model.Indexed, check.IsFalse)
+	c.Assert(task.model.IndexSize, check.Equals, task.indexer.reserved)
+
+	resp, err := queryLogIndex(s.db, task.model.TaskGroupID, &QueryLogRequest{})
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.Total, check.Equals, int64(maxLines))
+	c.Assert(resp.IndexErrors, check.HasLen, 1)
+	c.Assert(resp.IndexErrors[0].Instance, check.Equals, "127.0.0.1:4000")
+
+	// The index is counted in the disk quota.
+	c.Assert(s.diskQuota.storedSize(), check.Equals, task.model.IndexSize)
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const diskUsageCacheDuration = 5 * time.Second
+
+// The size of the task pool before the dynamic config is loaded.
+const defaultTaskPoolSize = config.DefaultLogSearchMaxRunningTasks
+
+// taskPool limits the number of tasks running at the same time. Tasks are started in the order they acquire the
+// pool. The size can be changed when tasks are running, and it takes effect when running tasks release the pool.
+type taskPool struct {
+	mu      sync.Mutex
+	size    int
+	running int
+	waiters []chan struct{}
+}
+
+func newTaskPool(size int) *taskPool {
+	return &taskPool{size: size}
+}
+
+func (p *taskPool) SetSize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	p.wakeLocked()
+}
+
+// Acquire waits until the task can run. An error is returned if the context is done before that.
+func (p *taskPool) Acquire(ctx context.Context) error {
+	p.mu.Lock()
+	if p.running < p.size && len(p.waiters) == 0 {
+		p.running++
+		p.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	p.waiters = append(p.waiters, ready)
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-ready:
+			// Acquired right before being canceled, pass it to others.
+			p.running--
+			p.wakeLocked()
+		default:
+			for i, w := range p.waiters {
+				if w == ready {
+					p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+func (p *taskPool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	p.wakeLocked()
+}
+
+func (p *taskPool) wakeLocked() {
+	for p.running < p.size && len(p.waiters) > 0 {
+		p.running++
+		close(p.waiters[0])
+		p.waiters = p.waiters[1:]
+	}
+}
+
+// rateLimiter limits the rate of receiving bytes from a target. Since the stream is not read when the limiter
+// waits, gRPC flow control slows down the sender as well.
+type rateLimiter struct {
+	bytesPerSec int64 // 0 means unlimited
+	start       time.Time
+	bytes       int64
+	now         func() time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{bytesPerSec: bytesPerSec, start: time.Now(), now: time.Now}
+}
+
+// delay returns how long to wait after n more bytes are received, so that the average rate does not exceed the limit.
+func (l *rateLimiter) delay(n int64) time.Duration {
+	l.bytes += n
+	if l.bytesPerSec <= 0 {
+		return 0
+	}
+	expected := time.Duration(float64(l.bytes) / float64(l.bytesPerSec) * float64(time.Second))
+	return expected - l.now().Sub(l.start)
+}
+
+func (l *rateLimiter) Wait(ctx context.Context, n int64) error {
+	d := l.delay(n)
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// diskQuota limits the size of logs and their indexes stored by all task groups. The size of finished tasks comes
+// from the database, while running tasks reserve the bytes they received, which is not less than the compressed
+// size, and the bytes they indexed.
+type diskQuota struct {
+	db       *dbstore.DB
+	limit    atomic.Int64 // 0 means unlimited
+	reserved atomic.Int64
+
+	mu          sync.Mutex
+	stored      int64
+	refreshedAt time.Time
+}
+
+func newDiskQuota(db *dbstore.DB) *diskQuota {
+	return &diskQuota{db: db}
+}
+
+func (q *diskQuota) storedSize() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Since(q.refreshedAt) < diskUsageCacheDuration {
+		return q.stored
+	}
+	var size struct{ Size int64 }
+	if err := q.db.Model(&TaskModel{}).Select("COALESCE(SUM(size + index_size), 0) AS size").Scan(&size).Error; err == nil {
+		q.stored = size.Size
+		q.refreshedAt = time.Now()
+	}
+	return q.stored
+}
+
+// Reserve reserves n bytes, an error is returned if the quota is exceeded. The reserved bytes are still counted
+// until they are released.
+func (q *diskQuota) Reserve(n int64) error {
+	reserved := q.reserved.Add(n)
+	limit := q.limit.Load()
+	if limit > 0 && q.storedSize()+reserved > limit {
+		return ErrDiskQuotaExceeded.New("logs exceed the disk quota of %d MB", limit/1024/1024)
+	}
+	return nil
+}
+
+func (q *diskQuota) Release(n int64) {
+	q.reserved.Add(-n)
+}
+
+// streamMeter applies the rate limit and the disk quota to the bytes received by a task.
+type streamMeter struct {
+	task    *Task
+	limiter *rateLimiter
+}
+
+func (t *Task) newStreamMeter() *streamMeter {
+	return &streamMeter{task: t, limiter: newRateLimiter(t.taskGroup.service.targetRateLimit.Load())}
+}
+
+func (m *streamMeter) Add(n int64) error {
+	t := m.task
+	t.model.BytesReceived += n
+	t.reservedBytes += n
+	if err := t.taskGroup.service.diskQuota.Reserve(n); err != nil {
+		return err
+	}
+	return m.limiter.Wait(t.ctx, n)
+}
+
+// meteredLogStream meters the responses of the diagnostics service.
+type meteredLogStream struct {
+	logStream
+	meter *streamMeter
+}
+
+func (s *meteredLogStream) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	res, err := s.logStream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.meter.Add(int64(res.Size())); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// meteredReader meters the raw log read from a log source, since the whole log is read even if few lines match.
+type meteredReader struct {
+	io.ReadCloser
+	meter *streamMeter
+}
+
+func (r *meteredReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if merr := r.meter.Add(int64(n)); merr != nil {
+			return n, merr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+var _ = check.Suite(&testLimitsSuite{})
+
+type testLimitsSuite struct{}
+
+func (t *testLimitsSuite) Test_taskPool(c *check.C) {
+	pool := newTaskPool(1)
+	c.Assert(pool.Acquire(context.Background()), check.IsNil)
+
+	acquired := make(chan struct{})
+	go func() {
+		c.Assert(pool.Acquire(context.Background()), check.IsNil)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("acquired when the pool is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// canceled waiters leave the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(pool.Acquire(ctx), check.NotNil)
+
+	pool.Release()
+	<-acquired
+
+	// growing the pool wakes up waiters
+	acquired = make(chan struct{})
+	go func() {
+		c.Assert(pool.Acquire(context.Background()), check.IsNil)
+		close(acquired)
+	}()
+	pool.SetSize(2)
+	<-acquired
+	c.Assert(pool.running, check.Equals, 2)
+}
+
+func (t *testLimitsSuite) Test_defaultLimits(c *check.C) {
+	// Tasks can run before the dynamic config is loaded.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(newTaskPool(defaultTaskPoolSize).Acquire(ctx), check.IsNil)
+
+	s := newTestService(c)
+	c.Assert(s.maxRecvMsgSize.Load(), check.Equals, int64(config.DefaultLogSearchMaxRecvMsgSizeMB*1024*1024))
+	s.applyConfig(&config.LogSearchConfig{MaxRunningTasks: 1, DiskQuotaMB: 1, MaxRecvMsgSizeMB: 4})
+	c.Assert(s.maxRecvMsgSize.Load(), check.Equals, int64(4*1024*1024))
+}
+
+func (t *testLimitsSuite) Test_rateLimiter(c *check.C) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter(1024)
+	l.start = now
+	l.now = func() time.Time { return now }
+
+	c.Assert(l.delay(512), check.Equals, 500*time.Millisecond)
+	now = now.Add(time.Second)
+	c.Assert(l.delay(512), check.Equals, time.Duration(0))
+	c.Assert(l.delay(2048) > 0, check.IsTrue)
+
+	unlimited := newRateLimiter(0)
+	c.Assert(unlimited.delay(1<<30), check.Equals, time.Duration(0))
+}
+
+func (t *testLimitsSuite) Test_diskQuota(c *check.C) {
+	s := newTestService(c)
+	q := s.diskQuota
+	c.Assert(s.db.Create(&TaskModel{State: TaskStateFinished, Size: 600, IndexSize: 200}).Error, check.IsNil)
+
+	// unlimited
+	c.Assert(q.Reserve(1<<30), check.IsNil)
+	q.Release(1 << 30)
+
+	q.limit.Store(1000)
+	c.Assert(q.storedSize(), check.Equals, int64(800))
+	c.Assert(q.Reserve(150), check.IsNil)
+	c.Assert(errorx.IsOfType(q.Reserve(100), ErrDiskQuotaExceeded), check.IsTrue)
+	// the bytes are still reserved when the quota is exceeded, until they are released
+	c.Assert(q.reserved.Load(), check.Equals, int64(250))
+	q.Release(100)
+	c.Assert(q.Reserve(50), check.IsNil)
+
+	// the stored size is cached
+	c.Assert(s.db.Create(&TaskModel{State: TaskStateFinished, Size: 1000}).Error, check.IsNil)
+	c.Assert(q.storedSize(), check.Equals, int64(800))
+	q.refreshedAt = time.Time{}
+	c.Assert(q.storedSize(), check.Equals, int64(1800))
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	DownloadFormatZip    = "zip"
+	DownloadFormatText   = "text"
+	DownloadFormatNDJSON = "ndjson"
+)
+
+// Same as the layout in logMessageToString.
+const storedLogTimeLayout = "2006/01/02 15:04:05.000 -07:00"
+
+type MergedLogEntry struct {
+	Instance string `json:"instance"`
+	Kind     string `json:"kind"`
+	Time     int64  `json:"time"` // unix timestamp in milliseconds
+	Level    string `json:"level"`
+	Message  string `json:"message"`
+}
+
+// storedLogReader reads the entries from a log stored by a task. A message may span multiple lines, so lines
+// not starting with a timestamp are appended to the previous entry.
+type storedLogReader struct {
+	instance string
+	kind     string
+	scanner  *bufio.Scanner
+	pending  *MergedLogEntry
+}
+
+func newStoredLogReader(r io.Reader, instance, kind string) *storedLogReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &storedLogReader{instance: instance, kind: kind, scanner: scanner}
+}
+
+func parseStoredLogLine(line string) (t time.Time, level string, message string, ok bool) {
+	if !strings.HasPrefix(line, "[") {
+		return
+	}
+	timeStr, rest, found := strings.Cut(line[1:], "] [")
+	if !found {
+		return
+	}
+	level, message, found = strings.Cut(rest, "] ")
+	if !found {
+		return
+	}
+	t, err := time.Parse(storedLogTimeLayout, timeStr)
+	if err != nil {
+		return
+	}
+	return t, level, message, true
+}
+
+// Next returns the next entry, or io.EOF if there is no more entries.
+func (r *storedLogReader) Next() (*MergedLogEntry, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		t, level, message, ok := parseStoredLogLine(line)
+		if !ok {
+			if r.pending != nil {
+				r.pending.Message += "\n" + line
+			}
+			// Lines before the first entry are dropped.
+			continue
+		}
+		entry := r.pending
+		r.pending = &MergedLogEntry{
+			Instance: r.instance,
+			Kind:     r.kind,
+			Time:     t.UnixMilli(),
+			Level:    level,
+			Message:  message,
+		}
+		if entry != nil {
+			return entry, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if r.pending != nil {
+		entry := r.pending
+		r.pending = nil
+		return entry, nil
+	}
+	return nil, io.EOF
+}
+
+type mergeItem struct {
+	entry  *MergedLogEntry
+	reader *storedLogReader
+	order  int
+}
+
+type mergeHeap []*mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].entry.Time != h[j].entry.Time {
+		return h[i].entry.Time < h[j].entry.Time
+	}
+	return h[i].order < h[j].order
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// mergeStoredLogs merges the entries of the readers by time. Each log is already ordered by time, and entries
+// of the same time keep the order of the readers.
+func mergeStoredLogs(readers []*storedLogReader, fn func(entry *MergedLogEntry) error) error {
+	h := make(mergeHeap, 0, len(readers))
+	for i, r := range readers {
+		entry, err := r.Next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		h = append(h, &mergeItem{entry: entry, reader: r, order: i})
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		item := h[0]
+		if err := fn(item.entry); err != nil {
+			return err
+		}
+		entry, err := item.reader.Next()
+		if err == io.EOF {
+			heap.Pop(&h)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		item.entry = entry
+		heap.Fix(&h, 0)
+	}
+	return nil
+}
+
+func formatMergedLogEntry(w io.Writer, entry *MergedLogEntry, format string) error {
+	if format == DownloadFormatNDJSON {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	timeStr := time.UnixMilli(entry.Time).Format(storedLogTimeLayout)
+	_, err := fmt.Fprintf(w, "[%s] [%s] [%s] %s\n", entry.Instance, timeStr, entry.Level, entry.Message)
+	return err
+}
+
+func serveMergedTasksForDownload(tasks []*TaskModel, format string, c *gin.Context) {
+	readers := make([]*storedLogReader, 0, len(tasks))
+	for _, task := range tasks {
+		for _, logPath := range []*string{task.LogStorePath, task.SlowLogStorePath} {
+			if logPath == nil {
+				continue
+			}
+			zr, err := zip.OpenReader(*logPath)
+			if err != nil {
+				rest.Error(c, err)
+				return
+			}
+			defer zr.Close() // #nosec
+			if len(zr.File) == 0 {
+				continue
+			}
+			f, err := zr.File[0].Open()
+			if err != nil {
+				rest.Error(c, err)
+				return
+			}
+			defer f.Close() // #nosec
+			readers = append(readers, newStoredLogReader(f, task.Target.DisplayName, string(task.Target.Kind)))
+		}
+	}
+	if len(readers) == 0 {
+		rest.Error(c, rest.ErrBadRequest.New("Log is not ready"))
+		return
+	}
+
+	fileName, contentType := "logs.log", "text/plain; charset=utf-8"
+	if format == DownloadFormatNDJSON {
+		fileName, contentType = "logs.ndjson", "application/x-ndjson"
+	}
+	c.Writer.Header().Set("Content-type", contentType)
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	w := bufio.NewWriterSize(c.Writer, 1024*1024)
+	err := mergeStoredLogs(readers, func(entry *MergedLogEntry) error {
+		return formatMergedLogEntry(w, entry, format)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Error("Stream merged logs failed", zap.Error(err))
+	}
+}
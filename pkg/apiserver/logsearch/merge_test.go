@@ -0,0 +1,52 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testMergeSuite{})
+
+type testMergeSuite struct{}
+
+func (t *testMergeSuite) Test_mergeStoredLogs(c *check.C) {
+	tidb := "[2024/01/01 10:00:00.000 +08:00] [INFO] [server.go:1] [\"start\"]\n" +
+		"[2024/01/01 10:00:02.000 +08:00] [ERROR] [conn.go:1] [\"panic\"]\n" +
+		"goroutine 1 [running]:\n" +
+		"[2024/01/01 10:00:04.000 +08:00] [WARN] [conn.go:2] [\"slow\"]\n"
+	// in another time zone
+	tikv := "[2024/01/01 02:00:01.000 +00:00] [INFO] [raft.rs:1] [\"ready\"]\n" +
+		"[2024/01/01 02:00:02.000 +00:00] [INFO] [raft.rs:2] [\"commit\"]\n"
+	readers := []*storedLogReader{
+		newStoredLogReader(strings.NewReader(tidb), "10.0.0.1:10080", "tidb"),
+		newStoredLogReader(strings.NewReader(tikv), "10.0.0.2:20160", "tikv"),
+		newStoredLogReader(strings.NewReader(""), "10.0.0.3:20160", "tikv"),
+	}
+
+	entries := make([]*MergedLogEntry, 0)
+	err := mergeStoredLogs(readers, func(entry *MergedLogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 5)
+	instances := make([]string, 0, len(entries))
+	for _, e := range entries {
+		instances = append(instances, e.Instance)
+	}
+	c.Assert(instances, check.DeepEquals, []string{
+		"10.0.0.1:10080", "10.0.0.2:20160", "10.0.0.1:10080", "10.0.0.2:20160", "10.0.0.1:10080",
+	})
+	c.Assert(entries[2].Level, check.Equals, "ERROR")
+	c.Assert(entries[2].Message, check.Equals, "[conn.go:1] [\"panic\"]\ngoroutine 1 [running]:")
+	c.Assert(entries[1].Time, check.Equals, int64(1704074401000))
+
+	var buf bytes.Buffer
+	c.Assert(formatMergedLogEntry(&buf, entries[1], DownloadFormatNDJSON), check.IsNil)
+	c.Assert(buf.String(), check.Equals,
+		`{"instance":"10.0.0.2:20160","kind":"tikv","time":1704074401000,"level":"INFO","message":"[raft.rs:1] [\"ready\"]"}`+"\n")
+}
@@ -26,6 +26,8 @@ type TaskGroupState int
 const (
 	TaskGroupStateRunning  TaskGroupState = 1
 	TaskGroupStateFinished TaskGroupState = 2
+	// The task group was running when the dashboard stopped, and its unfinished tasks can be retried.
+	TaskGroupStateInterrupted TaskGroupState = 3
 )
 
 type LogLevel int32
@@ -88,7 +90,14 @@ type TaskModel struct {
 	LogStorePath     *string                  `json:"log_store_path" gorm:"type:text"`
 	SlowLogStorePath *string                  `json:"slow_log_store_path" gorm:"type:text"`
 	Size             int64                    `json:"size" gorm:"index"`
+	BytesReceived    int64                    `json:"bytes_received"`
+	LinesMatched     int64                    `json:"lines_matched"`
 	Error            *string                  `json:"error" gorm:"type:text"`
+	// Approximate size of the indexed lines in the local store.
+	IndexSize int64 `json:"index_size"`
+	// Whether all lines are indexed, otherwise IndexError tells why.
+	Indexed    bool    `json:"indexed"`
+	IndexError *string `json:"index_error" gorm:"type:text"`
 }
 
 func (TaskModel) TableName() string {
@@ -102,6 +111,11 @@ func (task *TaskModel) RemoveDataAndPreview(db *dbstore.DB) {
 		task.LogStorePath = nil
 	}
 	db.Where("task_id = ?", task.ID).Delete(&PreviewModel{})
+	db.Where("task_id = ?", task.ID).Delete(&LogFieldModel{})
+	db.Where("task_id = ?", task.ID).Delete(&LogIndexModel{})
+	task.IndexSize = 0
+	task.Indexed = false
+	task.IndexError = nil
 }
 
 type TaskGroupModel struct {
@@ -110,6 +124,10 @@ type TaskGroupModel struct {
 	State         TaskGroupState                `json:"state" gorm:"index"`
 	TargetStats   model.RequestTargetStatistics `json:"target_stats" gorm:"embedded;embedded_prefix:target_stats_"`
 	LogStoreDir   *string                       `json:"log_store_dir" gorm:"type:text"`
+	CreatedAt     int64                         `json:"created_at" gorm:"autoCreateTime;index"` // unix timestamp in seconds
+	SavedSearchID uint                          `json:"saved_search_id" gorm:"index"`           // 0 for ad-hoc searches
+	// Number of lines which are not clustered into the message templates, since there are too many templates.
+	UnclusteredLines int64 `json:"unclustered_lines"`
 }
 
 func (TaskGroupModel) TableName() string {
@@ -121,6 +139,9 @@ func (tg *TaskGroupModel) Delete(db *dbstore.DB) {
 		_ = os.RemoveAll(*tg.LogStoreDir)
 	}
 	db.Where("task_group_id = ?", tg.ID).Delete(&PreviewModel{})
+	db.Where("task_group_id = ?", tg.ID).Delete(&LogPatternModel{})
+	db.Where("task_group_id = ?", tg.ID).Delete(&LogFieldModel{})
+	db.Where("task_group_id = ?", tg.ID).Delete(&LogIndexModel{})
 	db.Where("task_group_id = ?", tg.ID).Delete(&TaskModel{})
 	db.Where("id = ?", tg.ID).Delete(&TaskGroupModel{})
 }
@@ -139,13 +160,25 @@ func (PreviewModel) TableName() string {
 }
 
 func autoMigrate(db *dbstore.DB) error {
-	return db.AutoMigrate(&TaskModel{}, &TaskGroupModel{}, &PreviewModel{})
+	if err := db.AutoMigrate(&TaskModel{}, &TaskGroupModel{}, &PreviewModel{}, &LogPatternModel{}, &SavedSearchModel{}); err != nil {
+		return err
+	}
+	return autoMigrateLogIndex(db)
 }
 
-func cleanupAllTasks(db *dbstore.DB) {
-	var taskGroups []*TaskGroupModel
-	db.Find(&taskGroups)
-	for _, tg := range taskGroups {
-		tg.Delete(db)
+// markInterruptedTasks marks the task groups which were running when the dashboard stopped as interrupted. Their
+// unfinished tasks are marked as failed, so that they can be retried.
+func markInterruptedTasks(db *dbstore.DB) {
+	var tasks []*TaskModel
+	db.Where("state = ?", TaskStateRunning).Find(&tasks)
+	for _, task := range tasks {
+		task.RemoveDataAndPreview(db)
+		errStr := "interrupted by dashboard restart"
+		task.Error = &errStr
+		task.State = TaskStateError
+		db.Save(task)
 	}
+	db.Model(&TaskGroupModel{}).
+		Where("state = ?", TaskGroupStateRunning).
+		Update("state", TaskGroupStateInterrupted)
 }
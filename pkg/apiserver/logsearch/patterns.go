@@ -0,0 +1,246 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	patternMask = "<*>"
+
+	// Messages are not clustered any more when there are too many templates, which means the masking does not work
+	// for these logs.
+	maxPatternsInMemory  = 10000
+	maxPatternsToSave    = 500
+	maxExamplesOfPattern = 3
+
+	DefaultPatternLimit = 100
+)
+
+var (
+	// `[key=value]` fields, values are always variables.
+	patternFieldRegexp = regexp.MustCompile(`\[([A-Za-z0-9_.\-]+)=("(?:[^"\\]|\\.)*"|[^\]]*)\]`)
+	// Variable tokens in the free text, ordered from the most specific one.
+	patternTokenRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+		regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`),
+		regexp.MustCompile(`\b0[xX][0-9a-fA-F]+\b`),
+		regexp.MustCompile(`\b[0-9a-fA-F]{8,}\b`),
+		regexp.MustCompile(`\b\d+(\.\d+)?(ns|µs|us|ms|s|m|h|B|KiB|MiB|GiB|KB|MB|GB)?\b`),
+	}
+)
+
+// maskLogMessage replaces the variable parts of a message, so that messages printed by the same statement share
+// the same template.
+func maskLogMessage(message string) string {
+	template := patternFieldRegexp.ReplaceAllString(message, "[$1="+patternMask+"]")
+	for _, r := range patternTokenRegexps {
+		template = r.ReplaceAllString(template, patternMask)
+	}
+	return template
+}
+
+type PatternInstanceCounts map[string]int64
+
+func (c *PatternInstanceCounts) Scan(src interface{}) error {
+	return json.Unmarshal([]byte(src.(string)), c)
+}
+
+func (c PatternInstanceCounts) Value() (driver.Value, error) {
+	val, err := json.Marshal(c)
+	return string(val), err
+}
+
+type PatternExamples []string
+
+func (e *PatternExamples) Scan(src interface{}) error {
+	return json.Unmarshal([]byte(src.(string)), e)
+}
+
+func (e PatternExamples) Value() (driver.Value, error) {
+	val, err := json.Marshal(e)
+	return string(val), err
+}
+
+// LogPatternModel is a message template of the logs in a task group.
+type LogPatternModel struct {
+	ID          uint                   `json:"id" gorm:"primary_key"`
+	TaskGroupID uint                   `json:"task_group_id" gorm:"index"`
+	Template    string                 `json:"template" gorm:"type:text"`
+	Level       diagnosticspb.LogLevel `json:"level" gorm:"type:integer" swaggertype:"integer"`
+	Count       int64                  `json:"count"`
+	// unix timestamp in milliseconds
+	FirstSeen int64 `json:"first_seen"`
+	LastSeen  int64 `json:"last_seen"`
+	// Number of lines of each instance, keyed by the display name.
+	InstanceCounts PatternInstanceCounts `json:"instance_counts" gorm:"type:text" swaggertype:"object,integer"`
+	Examples       PatternExamples       `json:"examples" gorm:"type:text" swaggertype:"array,string"`
+}
+
+func (LogPatternModel) TableName() string {
+	return "log_patterns"
+}
+
+type patternKey struct {
+	level    diagnosticspb.LogLevel
+	template string
+}
+
+type patternClusterer struct {
+	taskGroupID uint
+	patterns    map[patternKey]*LogPatternModel
+	// lines of new templates after there are too many templates
+	unclustered int64
+}
+
+func newPatternClusterer(taskGroupID uint) *patternClusterer {
+	return &patternClusterer{
+		taskGroupID: taskGroupID,
+		patterns:    make(map[patternKey]*LogPatternModel),
+	}
+}
+
+func (pc *patternClusterer) Add(instance string, time int64, level diagnosticspb.LogLevel, message string) {
+	key := patternKey{level: level, template: maskLogMessage(message)}
+	p, ok := pc.patterns[key]
+	if !ok {
+		if len(pc.patterns) >= maxPatternsInMemory {
+			pc.unclustered++
+			return
+		}
+		p = &LogPatternModel{
+			TaskGroupID:    pc.taskGroupID,
+			Template:       key.template,
+			Level:          level,
+			FirstSeen:      time,
+			LastSeen:       time,
+			InstanceCounts: make(PatternInstanceCounts),
+			Examples:       make(PatternExamples, 0, maxExamplesOfPattern),
+		}
+		pc.patterns[key] = p
+	}
+	p.Count++
+	if time < p.FirstSeen {
+		p.FirstSeen = time
+	}
+	if time > p.LastSeen {
+		p.LastSeen = time
+	}
+	p.InstanceCounts[instance]++
+	if len(p.Examples) < maxExamplesOfPattern {
+		p.Examples = append(p.Examples, message)
+	}
+}
+
+// Result returns the most frequent patterns.
+func (pc *patternClusterer) Result(limit int) []*LogPatternModel {
+	patterns := make([]*LogPatternModel, 0, len(pc.patterns))
+	for _, p := range pc.patterns {
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		return patterns[i].FirstSeen < patterns[j].FirstSeen
+	})
+	if len(patterns) > limit {
+		patterns = patterns[:limit]
+	}
+	return patterns
+}
+
+// readStoredLog reads the entries of a log stored by a task.
+func readStoredLog(logPath string, fn func(entry *MergedLogEntry) error) error {
+	zr, err := zip.OpenReader(logPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close() // #nosec
+	if len(zr.File) == 0 {
+		return nil
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close() // #nosec
+	r := newStoredLogReader(f, "", "")
+	for {
+		entry, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// analyzePatterns clusters all stored lines of a task group into templates, and replaces the saved ones. Lines
+// after the limit of the index are clustered as well, since they are read from the stored logs. The number of
+// lines which are not clustered because of too many templates is returned.
+func analyzePatterns(db *dbstore.DB, taskGroupID uint) (int64, error) {
+	var tasks []*TaskModel
+	if err := db.Where("task_group_id = ?", taskGroupID).Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	pc := newPatternClusterer(taskGroupID)
+	for _, task := range tasks {
+		if task.Target == nil {
+			continue
+		}
+		instance := task.Target.DisplayName
+		for _, logPath := range []*string{task.LogStorePath, task.SlowLogStorePath} {
+			if logPath == nil {
+				continue
+			}
+			err := readStoredLog(*logPath, func(entry *MergedLogEntry) error {
+				pc.Add(instance, entry.Time, parseLogLevel(entry.Level), entry.Message)
+				return nil
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_group_id = ?", taskGroupID).Delete(&LogPatternModel{}).Error; err != nil {
+			return err
+		}
+		patterns := pc.Result(maxPatternsToSave)
+		if len(patterns) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(patterns, logIndexBatchSize).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pc.unclustered, nil
+}
+
+// PatternsResponse is the message templates of a task group.
+type PatternsResponse struct {
+	Patterns []LogPatternModel `json:"patterns"`
+	// Whether some lines are not clustered into the templates.
+	Partial bool `json:"partial"`
+	// Number of lines which are not clustered, since there are too many templates.
+	UnclusteredLines int64 `json:"unclustered_lines"`
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"fmt"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = check.Suite(&testPatternsSuite{})
+
+type testPatternsSuite struct{}
+
+func (t *testPatternsSuite) Test_maskLogMessage(c *check.C) {
+	c.Assert(
+		maskLogMessage(`[region.go:123] ["region miss"] [region_id=1234] [addr="127.0.0.1:20160"]`),
+		check.Equals,
+		`[region.go:<*>] ["region miss"] [region_id=<*>] [addr=<*>]`)
+	c.Assert(
+		maskLogMessage(`txn 449571234 takes 12.5ms on store 10.0.1.2:20160 with key 0x7480000000`),
+		check.Equals,
+		`txn <*> takes <*> on store <*> with key <*>`)
+	c.Assert(
+		maskLogMessage(`digest 6b86b273ff34fce19d6b804eff5a3f57 of session 3c6e0b8a-9c15-4f2d-8e2b-1a2b3c4d5e6f`),
+		check.Equals,
+		`digest <*> of session <*>`)
+	// identifiers with numbers are kept
+	c.Assert(maskLogMessage(`tikv1 is down`), check.Equals, `tikv1 is down`)
+}
+
+func (t *testPatternsSuite) Test_patternClusterer(c *check.C) {
+	pc := newPatternClusterer(1)
+	lines := []struct {
+		instance string
+		time     int64
+		level    diagnosticspb.LogLevel
+		message  string
+	}{
+		{"tidb-0", 30, 6, `["lock failed"] [conn=1]`},
+		{"tikv-0", 10, 6, `["lock failed"] [conn=2]`},
+		{"tidb-0", 20, 6, `["lock failed"] [conn=3]`},
+		{"tidb-0", 40, 6, `["lock failed"] [conn=4]`},
+		{"tidb-0", 50, 2, `["lock failed"] [conn=5]`},
+		{"tikv-0", 5, 2, `["welcome"]`},
+		{"tikv-0", 6, 2, `["welcome"]`},
+	}
+	for _, line := range lines {
+		pc.Add(line.instance, line.time, line.level, line.message)
+	}
+
+	result := pc.Result(2)
+	c.Assert(result, check.HasLen, 2)
+	c.Assert(result[0].TaskGroupID, check.Equals, uint(1))
+	c.Assert(result[0].Template, check.Equals, `["lock failed"] [conn=<*>]`)
+	c.Assert(result[0].Count, check.Equals, int64(4))
+	c.Assert(result[0].FirstSeen, check.Equals, int64(10))
+	c.Assert(result[0].LastSeen, check.Equals, int64(40))
+	c.Assert(result[0].InstanceCounts, check.DeepEquals, PatternInstanceCounts{"tidb-0": 3, "tikv-0": 1})
+	c.Assert(result[0].Examples, check.HasLen, maxExamplesOfPattern)
+	c.Assert(result[1].Template, check.Equals, `["welcome"]`)
+	c.Assert(result[1].Count, check.Equals, int64(2))
+	c.Assert(pc.unclustered, check.Equals, int64(0))
+}
+
+func (t *testPatternsSuite) Test_patternClustererUnclustered(c *check.C) {
+	pc := newPatternClusterer(1)
+	for i := 0; i < maxPatternsInMemory; i++ {
+		pc.Add("tidb-0", int64(i), diagnosticspb.LogLevel_Info, fmt.Sprintf("template %c%d", 'a'+i%26, i/26))
+	}
+	// lines of the existing templates are still clustered
+	pc.Add("tidb-0", 0, diagnosticspb.LogLevel_Info, "template a1")
+	c.Assert(pc.unclustered, check.Equals, int64(0))
+	pc.Add("tidb-0", 0, diagnosticspb.LogLevel_Info, "another template")
+	pc.Add("tidb-0", 0, diagnosticspb.LogLevel_Warn, "template a1")
+	c.Assert(pc.unclustered, check.Equals, int64(2))
+}
+
+func (t *testPatternsSuite) Test_analyzePatternsBeyondIndexLimit(c *check.C) {
+	s := newTestService(c)
+	s.maxIndexedLines.Store(2)
+	task := newTestTask(c, s, model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "127.0.0.1:4000", IP: "127.0.0.1", Port: 4000})
+	messages := make([]*diagnosticspb.LogMessage, 0)
+	for i := 0; i < 5; i++ {
+		messages = append(messages, &diagnosticspb.LogMessage{Time: int64(1000 + i), Level: diagnosticspb.LogLevel_Warn, Message: fmt.Sprintf(`["lock failed"] [conn=%d]`, i)})
+	}
+	task.saveLogStream(&fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{{Messages: messages}}}, diagnosticspb.SearchLogRequest_Normal)
+	c.Assert(task.model.Error, check.IsNil)
+	task.saveIndexState()
+	c.Assert(task.model.Indexed, check.IsFalse)
+	c.Assert(s.db.Save(task.model).Error, check.IsNil)
+
+	unclustered, err := analyzePatterns(s.db, task.model.TaskGroupID)
+	c.Assert(err, check.IsNil)
+	c.Assert(unclustered, check.Equals, int64(0))
+	var patterns []LogPatternModel
+	c.Assert(s.db.Where("task_group_id = ?", task.model.TaskGroupID).Find(&patterns).Error, check.IsNil)
+	c.Assert(patterns, check.HasLen, 1)
+	// all stored lines are clustered instead of the indexed ones
+	c.Assert(patterns[0].Count, check.Equals, int64(5))
+	c.Assert(patterns[0].Level, check.Equals, diagnosticspb.LogLevel_Warn)
+	c.Assert(patterns[0].FirstSeen, check.Equals, int64(1000))
+	c.Assert(patterns[0].LastSeen, check.Equals, int64(1004))
+	c.Assert(patterns[0].InstanceCounts, check.DeepEquals, PatternInstanceCounts{"127.0.0.1:4000": 5})
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const retentionCheckInterval = time.Hour
+
+func (s *Service) retentionLoop(ctx context.Context) {
+	cfgCh := s.configManager.NewPushChannel()
+
+	var cfg *config.LogSearchConfig
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			cfg = &dc.LogSearch
+			s.applyConfig(cfg)
+		case <-ticker.C:
+		}
+		if cfg != nil {
+			if err := cleanupExpiredTaskGroups(s.db, cfg, time.Now()); err != nil {
+				log.Warn("Failed to cleanup expired log search task groups", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *Service) applyConfig(cfg *config.LogSearchConfig) {
+	s.logSearchConfig.Store(cfg)
+	s.taskPool.SetSize(int(cfg.MaxRunningTasks))
+	s.targetRateLimit.Store(int64(cfg.TargetRateLimitKBps) * 1024)
+	s.diskQuota.limit.Store(int64(cfg.DiskQuotaMB) * 1024 * 1024)
+	s.maxIndexedLines.Store(int64(cfg.MaxIndexedLinesPerTask))
+	s.maxRecvMsgSize.Store(int64(cfg.MaxRecvMsgSizeMB) * 1024 * 1024)
+}
+
+// applyDefaultLimits applies the default limits before the dynamic config is loaded.
+func (s *Service) applyDefaultLimits() {
+	s.maxIndexedLines.Store(config.DefaultLogSearchMaxIndexedLinesPerTask)
+	s.maxRecvMsgSize.Store(config.DefaultLogSearchMaxRecvMsgSizeMB * 1024 * 1024)
+}
+
+type taskGroupSize struct {
+	TaskGroupID uint
+	Size        int64
+}
+
+// cleanupExpiredTaskGroups removes the task groups which exceed the retention days or whose logs are lost, then
+// removes the oldest task groups until the total size of logs and their indexes is within the limit. Running task
+// groups are kept.
+func cleanupExpiredTaskGroups(db *dbstore.DB, cfg *config.LogSearchConfig, now time.Time) error {
+	var taskGroups []*TaskGroupModel
+	err := db.
+		Where("state != ?", TaskGroupStateRunning).
+		Order("created_at, id").
+		Find(&taskGroups).Error
+	if err != nil {
+		return err
+	}
+
+	var sizes []taskGroupSize
+	err = db.Model(&TaskModel{}).
+		Select("task_group_id, SUM(size + index_size) AS size").
+		Group("task_group_id").
+		Scan(&sizes).Error
+	if err != nil {
+		return err
+	}
+	sizeOf := make(map[uint]int64, len(sizes))
+	var totalSize int64
+	for _, s := range sizes {
+		sizeOf[s.TaskGroupID] = s.Size
+		totalSize += s.Size
+	}
+
+	expireBefore := now.Add(-time.Duration(cfg.RetentionDays) * 24 * time.Hour).Unix()
+	sizeLimit := int64(cfg.RetentionSizeMB) * 1024 * 1024
+	for _, tg := range taskGroups {
+		expired := tg.CreatedAt < expireBefore || totalSize > sizeLimit
+		if !expired && tg.LogStoreDir != nil {
+			if _, err := os.Stat(*tg.LogStoreDir); os.IsNotExist(err) {
+				expired = true
+			}
+		}
+		if !expired {
+			continue
+		}
+		log.Debug("Remove expired log search task group", zap.Uint("task_group_id", tg.ID))
+		tg.Delete(db)
+		totalSize -= sizeOf[tg.ID]
+	}
+	return nil
+}
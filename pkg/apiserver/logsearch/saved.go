@@ -0,0 +1,274 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const savedSearchCheckInterval = 30 * time.Second
+
+type SavedSearchDefinition struct {
+	MinLevel LogLevel `json:"min_level"`
+	Patterns []string `json:"patterns"`
+	// Targets are the instances of these components when the search runs.
+	Kinds []model.NodeKind `json:"kinds"`
+	// The search covers the logs in the last WindowSecs seconds when it runs.
+	WindowSecs uint `json:"window_secs"`
+}
+
+func (d *SavedSearchDefinition) Scan(src interface{}) error {
+	return json.Unmarshal([]byte(src.(string)), d)
+}
+
+func (d *SavedSearchDefinition) Value() (driver.Value, error) {
+	val, err := json.Marshal(d)
+	return string(val), err
+}
+
+type SavedSearchModel struct {
+	ID         uint                   `json:"id" gorm:"primary_key"`
+	Name       string                 `json:"name" gorm:"size:128"`
+	Definition *SavedSearchDefinition `json:"definition" gorm:"type:text"`
+	// Schedule in the 5-field cron format, e.g. `0 9 * * *`. The search only runs manually if it is empty.
+	Schedule        string `json:"schedule" gorm:"size:128"`
+	NextRunAt       int64  `json:"next_run_at" gorm:"index"` // unix timestamp in seconds, 0 if not scheduled
+	LastRunAt       int64  `json:"last_run_at"`
+	LastTaskGroupID uint   `json:"last_task_group_id"`
+	CreatedAt       int64  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (SavedSearchModel) TableName() string {
+	return "log_saved_searches"
+}
+
+type SavedSearchRequest struct {
+	Name       string                `json:"name" binding:"required"`
+	Definition SavedSearchDefinition `json:"definition" binding:"required"`
+	Schedule   string                `json:"schedule"`
+}
+
+var supportedSavedSearchKinds = []model.NodeKind{
+	model.NodeKindTiDB,
+	model.NodeKindTiKV,
+	model.NodeKindPD,
+	model.NodeKindTiFlash,
+	model.NodeKindTiCDC,
+	model.NodeKindTiProxy,
+	model.NodeKindTSO,
+	model.NodeKindScheduling,
+}
+
+// nextRunAt validates the request and calculates the next scheduled run time.
+func (req *SavedSearchRequest) nextRunAt(now time.Time) (int64, error) {
+	if len(req.Definition.Kinds) == 0 {
+		return 0, rest.ErrBadRequest.New("Expect at least 1 component kind")
+	}
+	for _, kind := range req.Definition.Kinds {
+		if !slices.Contains(supportedSavedSearchKinds, kind) {
+			return 0, rest.ErrBadRequest.New("Unsupported component kind %s", kind)
+		}
+	}
+	if req.Definition.WindowSecs == 0 {
+		return 0, rest.ErrBadRequest.New("window_secs cannot be 0")
+	}
+	if req.Schedule == "" {
+		return 0, nil
+	}
+	schedule, err := parseCronSchedule(req.Schedule)
+	if err != nil {
+		return 0, rest.ErrBadRequest.WrapWithNoMessage(err)
+	}
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return 0, rest.ErrBadRequest.New("Schedule %s never runs", req.Schedule)
+	}
+	return next.Unix(), nil
+}
+
+// runSavedSearch starts a task group for the saved search, covering the logs in the window before now.
+func (s *Service) runSavedSearch(ctx context.Context, ss *SavedSearchModel, now time.Time) (*TaskGroupResponse, error) {
+	targets, err := s.resolveTargets(ctx, ss.Definition.Kinds)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, rest.ErrBadRequest.New("No instance of the component kinds")
+	}
+	req := &CreateTaskGroupRequest{
+		Request: SearchLogRequest{
+			StartTime: now.Add(-time.Duration(ss.Definition.WindowSecs) * time.Second).UnixMilli(),
+			EndTime:   now.UnixMilli(),
+			MinLevel:  ss.Definition.MinLevel,
+			Patterns:  ss.Definition.Patterns,
+		},
+		Targets: targets,
+	}
+	resp, err := s.startTaskGroup(req, ss.ID)
+	if err != nil {
+		return nil, err
+	}
+	ss.LastRunAt = now.Unix()
+	ss.LastTaskGroupID = resp.TaskGroup.ID
+	if err := s.db.Save(ss).Error; err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Service) savedSearchLoop(ctx context.Context) {
+	ticker := time.NewTicker(savedSearchCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runScheduledSearches(ctx, now)
+		}
+	}
+}
+
+func (s *Service) runScheduledSearches(ctx context.Context, now time.Time) {
+	var searches []*SavedSearchModel
+	err := s.db.
+		Where("next_run_at > 0 AND next_run_at <= ?", now.Unix()).
+		Find(&searches).Error
+	if err != nil {
+		log.Warn("Failed to list scheduled log searches", zap.Error(err))
+		return
+	}
+	for _, ss := range searches {
+		if _, err := s.runSavedSearch(ctx, ss, now); err != nil {
+			log.Warn("Failed to run scheduled log search", zap.Uint("saved_search_id", ss.ID), zap.Error(err))
+		}
+		// Always move to the next run, so that a failing search does not run in every check.
+		ss.NextRunAt = 0
+		if schedule, err := parseCronSchedule(ss.Schedule); err == nil {
+			if next := schedule.Next(now); !next.IsZero() {
+				ss.NextRunAt = next.Unix()
+			}
+		}
+		if err := s.db.Model(ss).Update("next_run_at", ss.NextRunAt).Error; err != nil {
+			log.Warn("Failed to update the next run of scheduled log search", zap.Uint("saved_search_id", ss.ID), zap.Error(err))
+		}
+	}
+}
+
+type PatternDiff struct {
+	Template      string `json:"template"`
+	Level         int32  `json:"level"`
+	Count         int64  `json:"count"`
+	PreviousCount int64  `json:"previous_count"`
+	// Delta is 0 when the count of either run is missing.
+	Delta int64 `json:"delta"`
+	// The template is not in the saved templates of the run, which are truncated, so that its count is unknown
+	// instead of 0.
+	Missing         bool `json:"missing"`
+	PreviousMissing bool `json:"previous_missing"`
+}
+
+type SavedSearchDiffResponse struct {
+	TaskGroupID         uint `json:"task_group_id"`
+	PreviousTaskGroupID uint `json:"previous_task_group_id"`
+	// Whether only the most frequent templates of the run are available.
+	Truncated         bool          `json:"truncated"`
+	PreviousTruncated bool          `json:"previous_truncated"`
+	Patterns          []PatternDiff `json:"patterns"`
+}
+
+// patternsTruncated returns whether the saved templates of a run may not contain all of its templates.
+func patternsTruncated(run *TaskGroupModel, patterns []*LogPatternModel) bool {
+	return run.UnclusteredLines > 0 || len(patterns) >= maxPatternsToSave
+}
+
+// diffPatterns compares the message templates of two runs. Templates only appearing in one run are included with
+// a zero count in the other run, or are marked as missing in the other run if its templates are truncated.
+// Templates whose deltas are unknown are ordered after the others.
+func diffPatterns(current, previous []*LogPatternModel, truncated, previousTruncated bool) []PatternDiff {
+	type key struct {
+		level    int32
+		template string
+	}
+	diffs := make(map[key]*PatternDiff)
+	for _, p := range current {
+		k := key{int32(p.Level), p.Template}
+		diffs[k] = &PatternDiff{Template: p.Template, Level: k.level, Count: p.Count, PreviousMissing: previousTruncated}
+	}
+	for _, p := range previous {
+		k := key{int32(p.Level), p.Template}
+		d, ok := diffs[k]
+		if !ok {
+			d = &PatternDiff{Template: p.Template, Level: k.level, Missing: truncated}
+			diffs[k] = d
+		}
+		d.PreviousCount = p.Count
+		d.PreviousMissing = false
+	}
+	result := make([]PatternDiff, 0, len(diffs))
+	for _, d := range diffs {
+		if !d.Missing && !d.PreviousMissing {
+			d.Delta = d.Count - d.PreviousCount
+		}
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		unknownI := result[i].Missing || result[i].PreviousMissing
+		unknownJ := result[j].Missing || result[j].PreviousMissing
+		if unknownI != unknownJ {
+			return !unknownI
+		}
+		if result[i].Delta != result[j].Delta {
+			return result[i].Delta > result[j].Delta
+		}
+		return result[i].Template < result[j].Template
+	})
+	return result
+}
+
+// querySavedSearchDiff compares a finished run with the finished run before it. Runs which are interrupted are
+// skipped, since their logs are incomplete. The latest finished run is used if taskGroupID is 0.
+func querySavedSearchDiff(db *dbstore.DB, savedSearchID, taskGroupID uint) (*SavedSearchDiffResponse, error) {
+	var runs []*TaskGroupModel
+	tx := db.
+		Where("saved_search_id = ? AND state = ?", savedSearchID, TaskGroupStateFinished).
+		Order("id DESC").
+		Limit(2)
+	if taskGroupID != 0 {
+		tx = tx.Where("id <= ?", taskGroupID)
+	}
+	if err := tx.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 || (taskGroupID != 0 && runs[0].ID != taskGroupID) {
+		return nil, rest.ErrNotFound.New("Run is not found or not finished")
+	}
+
+	resp := &SavedSearchDiffResponse{TaskGroupID: runs[0].ID}
+	var current, previous []*LogPatternModel
+	if err := db.Where("task_group_id = ?", runs[0].ID).Find(&current).Error; err != nil {
+		return nil, err
+	}
+	resp.Truncated = patternsTruncated(runs[0], current)
+	if len(runs) > 1 {
+		resp.PreviousTaskGroupID = runs[1].ID
+		if err := db.Where("task_group_id = ?", runs[1].ID).Find(&previous).Error; err != nil {
+			return nil, err
+		}
+		resp.PreviousTruncated = patternsTruncated(runs[1], previous)
+	}
+	resp.Patterns = diffPatterns(current, previous, resp.Truncated, resp.PreviousTruncated)
+	return resp, nil
+}
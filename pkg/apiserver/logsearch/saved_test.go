@@ -0,0 +1,89 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+var _ = check.Suite(&testSavedSuite{})
+
+type testSavedSuite struct{}
+
+func (t *testSavedSuite) Test_runScheduledSearches(c *check.C) {
+	s := newTestService(c)
+	now := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	// The searches fail since there is no instance of the component kinds.
+	due := &SavedSearchModel{Name: "due", Definition: &SavedSearchDefinition{WindowSecs: 60}, Schedule: "0 * * * *", NextRunAt: now.Add(-time.Minute).Unix()}
+	later := &SavedSearchModel{Name: "later", Definition: &SavedSearchDefinition{WindowSecs: 60}, Schedule: "0 * * * *", NextRunAt: now.Add(time.Minute).Unix()}
+	manual := &SavedSearchModel{Name: "manual", Definition: &SavedSearchDefinition{WindowSecs: 60}}
+	for _, ss := range []*SavedSearchModel{due, later, manual} {
+		c.Assert(s.db.Create(ss).Error, check.IsNil)
+	}
+
+	s.runScheduledSearches(context.Background(), now)
+
+	var saved []*SavedSearchModel
+	c.Assert(s.db.Order("id").Find(&saved).Error, check.IsNil)
+	// A failing search still moves to the next run.
+	c.Assert(saved[0].NextRunAt, check.Equals, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC).Unix())
+	c.Assert(saved[0].LastRunAt, check.Equals, int64(0))
+	c.Assert(saved[1].NextRunAt, check.Equals, later.NextRunAt)
+	c.Assert(saved[2].NextRunAt, check.Equals, int64(0))
+}
+
+func (t *testSavedSuite) Test_querySavedSearchDiff(c *check.C) {
+	s := newTestService(c)
+	runs := []*TaskGroupModel{
+		{SavedSearchID: 1, State: TaskGroupStateFinished},
+		{SavedSearchID: 2, State: TaskGroupStateFinished},
+		{SavedSearchID: 1, State: TaskGroupStateInterrupted},
+		{SavedSearchID: 1, State: TaskGroupStateRunning},
+		{SavedSearchID: 1, State: TaskGroupStateFinished, UnclusteredLines: 3},
+	}
+	for _, tg := range runs {
+		c.Assert(s.db.Create(tg).Error, check.IsNil)
+	}
+	patterns := []*LogPatternModel{
+		{TaskGroupID: runs[0].ID, Template: "a", Level: diagnosticspb.LogLevel_Info, Count: 5},
+		{TaskGroupID: runs[0].ID, Template: "b", Level: diagnosticspb.LogLevel_Warn, Count: 1},
+		{TaskGroupID: runs[1].ID, Template: "a", Level: diagnosticspb.LogLevel_Info, Count: 100},
+		{TaskGroupID: runs[2].ID, Template: "a", Level: diagnosticspb.LogLevel_Info, Count: 7},
+		{TaskGroupID: runs[4].ID, Template: "a", Level: diagnosticspb.LogLevel_Info, Count: 8},
+	}
+	for _, p := range patterns {
+		c.Assert(s.db.Create(p).Error, check.IsNil)
+	}
+
+	// The interrupted and running ones are skipped, and the runs of other saved searches are not compared. The
+	// latest run has unclustered lines, so the template it lacks is missing.
+	resp, err := querySavedSearchDiff(s.db, 1, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp, check.DeepEquals, &SavedSearchDiffResponse{
+		TaskGroupID:         runs[4].ID,
+		PreviousTaskGroupID: runs[0].ID,
+		Truncated:           true,
+		Patterns: []PatternDiff{
+			{Template: "a", Level: int32(diagnosticspb.LogLevel_Info), Count: 8, PreviousCount: 5, Delta: 3},
+			{Template: "b", Level: int32(diagnosticspb.LogLevel_Warn), PreviousCount: 1, Missing: true},
+		},
+	})
+
+	// The first run has nothing to compare with.
+	resp, err = querySavedSearchDiff(s.db, 1, runs[0].ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(resp.PreviousTaskGroupID, check.Equals, uint(0))
+	c.Assert(resp.Patterns, check.HasLen, 2)
+
+	for _, id := range []uint{runs[1].ID, runs[2].ID, runs[3].ID} {
+		_, err = querySavedSearchDiff(s.db, 1, id)
+		c.Assert(errorx.IsOfType(err, rest.ErrNotFound), check.IsTrue)
+	}
+}
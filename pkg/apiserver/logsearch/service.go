@@ -4,13 +4,21 @@ package logsearch
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joomcode/errorx"
 	"github.com/pingcap/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
@@ -19,46 +27,95 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/pkg/httpc"
+	"github.com/pingcap/tidb-dashboard/pkg/pd"
 	"github.com/pingcap/tidb-dashboard/util/rest"
 )
 
+var (
+	ErrNS                = errorx.NewNamespace("error.api.log_search")
+	ErrDiskQuotaExceeded = ErrNS.NewType("disk_quota_exceeded")
+)
+
 type Service struct {
 	// FIXME: Use fx.In
 	lifecycleCtx context.Context
 
 	config            *config.Config
+	configManager     *config.DynamicConfigManager
 	logStoreDirectory string
 	db                *dbstore.DB
 	scheduler         *Scheduler
+	pdClient          *pd.Client
+	etcdClient        *clientv3.Client
+
+	taskPool        *taskPool
+	diskQuota       *diskQuota
+	targetRateLimit atomic.Int64 // bytes per second, 0 means unlimited
+	maxIndexedLines atomic.Int64
+	maxRecvMsgSize  atomic.Int64 // bytes
+	logSearchConfig atomic.Pointer[config.LogSearchConfig]
+	httpClient      *httpc.Client
+	indexMu         sync.Mutex
+
+	wg sync.WaitGroup
 }
 
-func NewService(lc fx.Lifecycle, config *config.Config, db *dbstore.DB) *Service {
+func NewService(
+	lc fx.Lifecycle,
+	config *config.Config,
+	configManager *config.DynamicConfigManager,
+	db *dbstore.DB,
+	pdClient *pd.Client,
+	etcdClient *clientv3.Client,
+	httpClient *httpc.Client,
+) *Service {
 	dir := config.TempDir
 	if dir == "" {
-		var err error
-		dir, err = os.MkdirTemp("", "dashboard-logs")
-		if err != nil {
-			log.Fatal("Failed to create directory for storing logs", zap.Error(err))
-		}
+		// Use a fixed directory instead of a random temporary one, so that logs are kept across restarts.
+		dir = path.Join(config.DataDir, "logs")
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil { // #nosec
+		log.Fatal("Failed to create directory for storing logs", zap.Error(err))
 	}
 	err := autoMigrate(db)
 	if err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
-	cleanupAllTasks(db)
+	markInterruptedTasks(db)
 
 	service := &Service{
 		config:            config,
+		configManager:     configManager,
 		logStoreDirectory: dir,
 		db:                db,
 		scheduler:         nil, // will be filled after scheduler is created
+		pdClient:          pdClient,
+		etcdClient:        etcdClient,
+		httpClient:        httpClient,
+		taskPool:          newTaskPool(defaultTaskPoolSize), // resized when the dynamic config is loaded
+		diskQuota:         newDiskQuota(db),
 	}
+	service.applyDefaultLimits()
 	scheduler := NewScheduler(service)
 	service.scheduler = scheduler
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			service.lifecycleCtx = ctx
+			service.wg.Add(2)
+			go func() {
+				defer service.wg.Done()
+				service.retentionLoop(ctx)
+			}()
+			go func() {
+				defer service.wg.Done()
+				service.savedSearchLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			service.wg.Wait()
 			return nil
 		},
 	})
@@ -70,13 +127,27 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/logs")
 	{
 		endpoint.GET("/download", s.DownloadLogs)
+		endpoint.GET("/tail", s.TailLogs)
 		endpoint.Use(auth.MWAuthRequired())
 		{
 			endpoint.GET("/download/acquire_token", s.GetDownloadToken)
+			endpoint.POST("/tail/token", s.GetTailToken)
+			endpoint.GET("/config", s.GetConfig)
+			endpoint.GET("/saved_searches", s.GetAllSavedSearches)
+			endpoint.PUT("/saved_search", s.CreateSavedSearch)
+			endpoint.POST("/saved_searches/:id", s.UpdateSavedSearch)
+			endpoint.DELETE("/saved_searches/:id", s.DeleteSavedSearch)
+			endpoint.POST("/saved_searches/:id/run", s.RunSavedSearch)
+			endpoint.GET("/saved_searches/:id/runs", s.GetSavedSearchRuns)
+			endpoint.GET("/saved_searches/:id/diff", s.GetSavedSearchDiff)
+			endpoint.PUT("/config", auth.MWRequireWritePriv(), s.SetConfig)
 			endpoint.PUT("/taskgroup", s.CreateTaskGroup)
 			endpoint.GET("/taskgroups", s.GetAllTaskGroups)
 			endpoint.GET("/taskgroups/:id", s.GetTaskGroup)
 			endpoint.GET("/taskgroups/:id/preview", s.GetTaskGroupPreview)
+			endpoint.GET("/taskgroups/:id/query", s.QueryTaskGroupLogs)
+			endpoint.GET("/taskgroups/:id/facets", s.GetTaskGroupFacets)
+			endpoint.GET("/taskgroups/:id/patterns", s.GetTaskGroupPatterns)
 			endpoint.POST("/taskgroups/:id/retry", s.RetryTask)
 			endpoint.POST("/taskgroups/:id/cancel", s.CancelTask)
 			endpoint.DELETE("/taskgroups/:id", s.DeleteTaskGroup)
@@ -112,15 +183,29 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 		rest.Error(c, rest.ErrBadRequest.New("Expect at least 1 target"))
 		return
 	}
+	resp, err := s.StartTaskGroup(&req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// StartTaskGroup creates a task group and runs it in background.
+func (s *Service) StartTaskGroup(req *CreateTaskGroupRequest) (*TaskGroupResponse, error) {
+	return s.startTaskGroup(req, 0)
+}
+
+func (s *Service) startTaskGroup(req *CreateTaskGroupRequest, savedSearchID uint) (*TaskGroupResponse, error) {
 	stats := model.NewRequestTargetStatisticsFromArray(&req.Targets)
 	taskGroup := TaskGroupModel{
 		SearchRequest: &req.Request,
 		State:         TaskGroupStateRunning,
 		TargetStats:   stats,
+		SavedSearchID: savedSearchID,
 	}
 	if err := s.db.Create(&taskGroup).Error; err != nil {
-		rest.Error(c, err)
-		return
+		return nil, err
 	}
 	tasks := make([]*TaskModel, 0, len(req.Targets))
 	for _, t := range req.Targets {
@@ -137,11 +222,10 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 	if !s.scheduler.AsyncStart(&taskGroup, tasks) {
 		log.Error("Failed to start task group", zap.Uint("task_group_id", taskGroup.ID))
 	}
-	resp := TaskGroupResponse{
+	return &TaskGroupResponse{
 		TaskGroup: taskGroup,
 		Tasks:     tasks,
-	}
-	c.JSON(http.StatusOK, resp)
+	}, nil
 }
 
 // @Summary List all log search task groups
@@ -211,7 +295,159 @@ func (s *Service) GetTaskGroupPreview(c *gin.Context) {
 	c.JSON(http.StatusOK, lines)
 }
 
-// @Summary Retry failed tasks in a log search task group
+// @Summary Search the full logs of a log search task group
+// @Description Logs are indexed when they are searched, the phrase is matched as whole words in a case-insensitive way. The tasks whose lines are not all indexed are listed in `index_errors`.
+// @Param id path string true "task group id"
+// @Param q query QueryLogRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} QueryLogResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/taskgroups/{id}/query [get]
+func (s *Service) QueryTaskGroupLogs(c *gin.Context) {
+	taskGroupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var req QueryLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil || req.Offset < 0 {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	resp, err := queryLogIndex(s.db, uint(taskGroupID), &req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Count the values of the fields extracted from the logs of a log search task group
+// @Description Fields are extracted from the `[key=value]` parts of the indexed logs. Use the `fields` filter of the query API to find the lines with a value.
+// @Param id path string true "task group id"
+// @Param q query GetFacetsRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {array} LogFacet
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/taskgroups/{id}/facets [get]
+func (s *Service) GetTaskGroupFacets(c *gin.Context) {
+	taskGroupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var req GetFacetsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	facets, err := queryLogFacets(s.db, uint(taskGroupID), &req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, facets)
+}
+
+// @Summary List message templates of the logs in a log search task group
+// @Description Messages are clustered into templates by masking the variable parts when the task group finishes. Templates are ordered by frequency. The result is partial when there are too many templates.
+// @Param id path string true "task group id"
+// @Param limit query int false "max number of templates"
+// @Security JwtAuth
+// @Success 200 {object} PatternsResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/taskgroups/{id}/patterns [get]
+func (s *Service) GetTaskGroupPatterns(c *gin.Context) {
+	taskGroupID := c.Param("id")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultPatternLimit)))
+	if err != nil || limit <= 0 {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var taskGroup TaskGroupModel
+	if err := s.db.First(&taskGroup, "id = ?", taskGroupID).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	resp := PatternsResponse{
+		Patterns:         make([]LogPatternModel, 0),
+		Partial:          taskGroup.UnclusteredLines > 0,
+		UnclusteredLines: taskGroup.UnclusteredLines,
+	}
+	err = s.db.
+		Where("task_group_id = ?", taskGroupID).
+		Order("count DESC, first_seen").
+		Limit(limit).
+		Find(&resp.Patterns).Error
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Get log search retention configurations
+// @Security JwtAuth
+// @Success 200 {object} config.LogSearchConfig
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/config [get]
+func (s *Service) GetConfig(c *gin.Context) {
+	dc, err := s.configManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.LogSearch)
+}
+
+// @Summary Update log search retention configurations
+// @Description Omitted fields keep the current values.
+// @Param request body config.LogSearchConfig true "Request body"
+// @Security JwtAuth
+// @Success 200 {object} config.LogSearchConfig
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/config [put]
+func (s *Service) SetConfig(c *gin.Context) {
+	dc, err := s.configManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	req := dc.LogSearch
+	// The elements of a slice are decoded into the existing ones, so that it is replaced as a whole if present.
+	req.LogSources = nil
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.LogSources == nil {
+		req.LogSources = dc.LogSearch.LogSources
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.LogSearch = req
+	}
+	if err := s.configManager.Modify(opt); err != nil {
+		rest.Error(c, err)
+		return
+	}
+	dc, err = s.configManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.LogSearch)
+}
+
+// @Summary Retry failed or interrupted tasks in a log search task group
 // @Param id path string true "task group id"
 // @Security JwtAuth
 // @Success 200 {object} rest.EmptyResponse
@@ -226,9 +462,12 @@ func (s *Service) RetryTask(c *gin.Context) {
 		return
 	}
 
-	// Currently we can only retry finished task group.
+	// Currently we can only retry finished or interrupted task group.
 	taskGroup := TaskGroupModel{}
-	if err := s.db.Where("id = ? AND state = ?", taskGroupID, TaskGroupStateFinished).First(&taskGroup).Error; err != nil {
+	err = s.db.
+		Where("id = ? AND state IN ?", taskGroupID, []TaskGroupState{TaskGroupStateFinished, TaskGroupStateInterrupted}).
+		First(&taskGroup).Error
+	if err != nil {
 		rest.Error(c, err)
 		return
 	}
@@ -241,6 +480,10 @@ func (s *Service) RetryTask(c *gin.Context) {
 
 	if len(tasks) == 0 {
 		// No tasks to retry
+		if taskGroup.State == TaskGroupStateInterrupted {
+			taskGroup.State = TaskGroupStateFinished
+			s.db.Save(&taskGroup)
+		}
 		c.JSON(http.StatusOK, rest.EmptyResponse{})
 		return
 	}
@@ -251,6 +494,11 @@ func (s *Service) RetryTask(c *gin.Context) {
 	for _, task := range tasks {
 		task.Error = nil
 		task.State = TaskStateRunning
+		task.BytesReceived = 0
+		task.LinesMatched = 0
+		task.IndexSize = 0
+		task.Indexed = false
+		task.IndexError = nil
 		s.db.Save(task)
 	}
 
@@ -326,8 +574,11 @@ func (s *Service) GetDownloadToken(c *gin.Context) {
 }
 
 // @Summary Download logs
-// @Produce application/x-tar,application/zip
+// @Description By default, logs of each instance are packed in a zip file. Logs can also be merged into a single
+// @Description file ordered by time, with the instance of each line.
+// @Produce application/x-tar,application/zip,plain,application/x-ndjson
 // @Param token query string true "download token"
+// @Param format query string false "zip (default), text for merged plain text or ndjson for merged JSON lines"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 // @Failure 500 {object} rest.ErrorResponse
@@ -339,6 +590,11 @@ func (s *Service) DownloadLogs(c *gin.Context) {
 		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	format := c.DefaultQuery("format", DownloadFormatZip)
+	if format != DownloadFormatZip && format != DownloadFormatText && format != DownloadFormatNDJSON {
+		rest.Error(c, rest.ErrBadRequest.New("Unsupported format %s", format))
+		return
+	}
 	ids := strings.Split(str, ",")
 	tasks := make([]*TaskModel, 0, len(ids))
 	for _, id := range ids {
@@ -352,12 +608,274 @@ func (s *Service) DownloadLogs(c *gin.Context) {
 		}
 	}
 
-	switch len(tasks) {
-	case 0:
+	switch {
+	case len(tasks) == 0:
 		rest.Error(c, rest.ErrBadRequest.New("Expect at least 1 target"))
-	case 1:
+	case format != DownloadFormatZip:
+		serveMergedTasksForDownload(tasks, format, c)
+	case len(tasks) == 1:
 		serveTaskForDownload(tasks[0], c)
 	default:
 		serveMultipleTaskForDownload(tasks, c)
 	}
 }
+
+// @Summary Generate a token for tailing logs
+// @Description The token is only valid for a short time to open the stream.
+// @Produce plain
+// @Param request body TailLogRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {string} string "xxx"
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Router /logs/tail/token [post]
+func (s *Service) GetTailToken(c *gin.Context) {
+	var req TailLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if len(req.Targets) == 0 {
+		rest.Error(c, rest.ErrBadRequest.New("Expect at least 1 target"))
+		return
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	token, err := utils.NewJWTStringWithExpire("logs/tail", string(data), time.Minute)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// @Summary Tail logs
+// @Description Stream new log lines of all targets in timestamp order as Server-Sent Events. `log` events carry a TailLogLine, `error` events carry a TailLogError, and `ping` events are sent periodically when there is no new line.
+// @Produce text/event-stream
+// @Param token query string true "tail token"
+// @Success 200 {object} TailLogLine
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/tail [get]
+func (s *Service) TailLogs(c *gin.Context) {
+	str, err := utils.ParseJWTString("logs/tail", c.Query("token"))
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var req TailLogRequest
+	if err := json.Unmarshal([]byte(str), &req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	tailer, err := s.newLogTailer(&req, time.Now())
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	defer tailer.Close()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), tailMaxDuration)
+	defer cancel()
+	ticker := time.NewTicker(TailPollInterval)
+	defer ticker.Stop()
+
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	lastSent := time.Now()
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case now := <-ticker.C:
+			lines, errs := tailer.Poll(ctx, now)
+			for _, e := range errs {
+				c.SSEvent("error", e)
+			}
+			for _, line := range lines {
+				c.SSEvent("log", line)
+			}
+			if len(lines) > 0 || len(errs) > 0 {
+				lastSent = now
+			} else if now.Sub(lastSent) >= tailHeartbeatInterval {
+				c.SSEvent("ping", now.Unix())
+				lastSent = now
+			}
+			return true
+		}
+	})
+}
+
+// @Summary List all saved log searches
+// @Security JwtAuth
+// @Success 200 {array} SavedSearchModel
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_searches [get]
+func (s *Service) GetAllSavedSearches(c *gin.Context) {
+	var searches []*SavedSearchModel
+	if err := s.db.Order("id").Find(&searches).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, searches)
+}
+
+// @Summary Create a saved log search
+// @Description The search runs on the instances of the selected component kinds over a relative time window. It runs periodically if the schedule is set.
+// @Param request body SavedSearchRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {object} SavedSearchModel
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_search [put]
+func (s *Service) CreateSavedSearch(c *gin.Context) {
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	nextRunAt, err := req.nextRunAt(time.Now())
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	ss := SavedSearchModel{
+		Name:       req.Name,
+		Definition: &req.Definition,
+		Schedule:   req.Schedule,
+		NextRunAt:  nextRunAt,
+	}
+	if err := s.db.Create(&ss).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ss)
+}
+
+// @Summary Update a saved log search
+// @Param id path string true "saved search id"
+// @Param request body SavedSearchRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {object} SavedSearchModel
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_searches/{id} [post]
+func (s *Service) UpdateSavedSearch(c *gin.Context) {
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var ss SavedSearchModel
+	if err := s.db.First(&ss, "id = ?", c.Param("id")).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	nextRunAt, err := req.nextRunAt(time.Now())
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	ss.Name = req.Name
+	ss.Definition = &req.Definition
+	ss.Schedule = req.Schedule
+	ss.NextRunAt = nextRunAt
+	if err := s.db.Save(&ss).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ss)
+}
+
+// @Summary Delete a saved log search
+// @Description Task groups of the previous runs are kept until they are removed by the retention.
+// @Param id path string true "saved search id"
+// @Security JwtAuth
+// @Success 200 {object} rest.EmptyResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_searches/{id} [delete]
+func (s *Service) DeleteSavedSearch(c *gin.Context) {
+	if err := s.db.Where("id = ?", c.Param("id")).Delete(&SavedSearchModel{}).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+// @Summary Run a saved log search now
+// @Param id path string true "saved search id"
+// @Security JwtAuth
+// @Success 200 {object} TaskGroupResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_searches/{id}/run [post]
+func (s *Service) RunSavedSearch(c *gin.Context) {
+	var ss SavedSearchModel
+	if err := s.db.First(&ss, "id = ?", c.Param("id")).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	resp, err := s.runSavedSearch(c.Request.Context(), &ss, time.Now())
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary List task groups of the runs of a saved log search
+// @Param id path string true "saved search id"
+// @Security JwtAuth
+// @Success 200 {array} TaskGroupModel
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_searches/{id}/runs [get]
+func (s *Service) GetSavedSearchRuns(c *gin.Context) {
+	var taskGroups []*TaskGroupModel
+	err := s.db.
+		Where("saved_search_id = ?", c.Param("id")).
+		Order("id DESC").
+		Find(&taskGroups).Error
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, taskGroups)
+}
+
+// @Summary Compare the message templates of a run of a saved log search with the previous run
+// @Param id path string true "saved search id"
+// @Param task_group_id query int false "task group id of the run, the latest finished run if absent"
+// @Security JwtAuth
+// @Success 200 {object} SavedSearchDiffResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /logs/saved_searches/{id}/diff [get]
+func (s *Service) GetSavedSearchDiff(c *gin.Context) {
+	savedSearchID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	taskGroupID, err := strconv.Atoi(c.DefaultQuery("task_group_id", "0"))
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	resp, err := querySavedSearchDiff(s.db, uint(savedSearchID), uint(taskGroupID))
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
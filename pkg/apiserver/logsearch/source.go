@@ -0,0 +1,354 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+const sourceLogBatchSize = 1024
+
+var (
+	ErrLogSourceNotConfigured = ErrNS.NewType("log_source_not_configured")
+	ErrLogSourceRequestFailed = ErrNS.NewType("log_source_request_failed")
+	ErrLogSourcePathForbidden = ErrNS.NewType("log_source_path_forbidden")
+	ErrLogSourceNotFound      = ErrNS.NewType("log_source_not_found")
+)
+
+// logStream is implemented by the diagnostics SearchLog stream and sourceLogStream.
+type logStream interface {
+	Recv() (*diagnosticspb.SearchLogResponse, error)
+}
+
+func parseLogLevel(level string) diagnosticspb.LogLevel {
+	switch strings.ToUpper(level) {
+	case "DEBUG":
+		return diagnosticspb.LogLevel_Debug
+	case "INFO":
+		return diagnosticspb.LogLevel_Info
+	case "WARN", "WARNING":
+		return diagnosticspb.LogLevel_Warn
+	case "TRACE":
+		return diagnosticspb.LogLevel_Trace
+	case "CRITICAL", "FATAL", "PANIC", "DPANIC":
+		return diagnosticspb.LogLevel_Critical
+	case "ERROR":
+		return diagnosticspb.LogLevel_Error
+	default:
+		return diagnosticspb.LogLevel_UNKNOWN
+	}
+}
+
+// sourceLogStream searches a log in the unified log format, the same as the diagnostics service does.
+type sourceLogStream struct {
+	ctx       context.Context
+	reader    *storedLogReader
+	closer    io.Closer
+	startTime int64
+	endTime   int64
+	levels    []diagnosticspb.LogLevel
+	patterns  []*regexp.Regexp
+	done      bool
+}
+
+func newSourceLogStream(ctx context.Context, r io.ReadCloser, req *diagnosticspb.SearchLogRequest) (*sourceLogStream, error) {
+	patterns := make([]*regexp.Regexp, 0, len(req.Patterns))
+	for _, p := range req.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return &sourceLogStream{
+		ctx:       ctx,
+		reader:    newStoredLogReader(r, "", ""),
+		closer:    r,
+		startTime: req.StartTime,
+		endTime:   req.EndTime,
+		levels:    req.Levels,
+		patterns:  patterns,
+	}, nil
+}
+
+func (s *sourceLogStream) match(level diagnosticspb.LogLevel, message string) bool {
+	if len(s.levels) > 0 && !slices.Contains(s.levels, level) {
+		return false
+	}
+	for _, p := range s.patterns {
+		if !p.MatchString(message) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *sourceLogStream) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	messages := make([]*diagnosticspb.LogMessage, 0)
+	for !s.done && len(messages) < sourceLogBatchSize {
+		entry, err := s.reader.Next()
+		if err == io.EOF {
+			s.done = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Time < s.startTime {
+			continue
+		}
+		if entry.Time > s.endTime {
+			// Logs are ordered by time, so the rest are all out of the range.
+			s.done = true
+			break
+		}
+		level := parseLogLevel(entry.Level)
+		if !s.match(level, entry.Message) {
+			continue
+		}
+		messages = append(messages, &diagnosticspb.LogMessage{
+			Time:    entry.Time,
+			Level:   level,
+			Message: entry.Message,
+		})
+	}
+	if len(messages) == 0 {
+		return nil, io.EOF
+	}
+	return &diagnosticspb.SearchLogResponse{Messages: messages}, nil
+}
+
+func (s *sourceLogStream) Close() error {
+	return s.closer.Close()
+}
+
+// mergedLogStream merges the logs of the streams by time. The logs of each stream must be ordered by time.
+type mergedLogStream struct {
+	streams []logStream
+	pending [][]*diagnosticspb.LogMessage
+	done    []bool
+}
+
+func newMergedLogStream(streams ...logStream) *mergedLogStream {
+	return &mergedLogStream{
+		streams: streams,
+		pending: make([][]*diagnosticspb.LogMessage, len(streams)),
+		done:    make([]bool, len(streams)),
+	}
+}
+
+func (s *mergedLogStream) fill(i int) error {
+	for !s.done[i] && len(s.pending[i]) == 0 {
+		res, err := s.streams[i].Recv()
+		if err == io.EOF {
+			s.done[i] = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.pending[i] = res.Messages
+	}
+	return nil
+}
+
+func (s *mergedLogStream) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	messages := make([]*diagnosticspb.LogMessage, 0)
+	for len(messages) < sourceLogBatchSize {
+		earliest := -1
+		for i := range s.streams {
+			if err := s.fill(i); err != nil {
+				return nil, err
+			}
+			if len(s.pending[i]) > 0 && (earliest == -1 || s.pending[i][0].Time < s.pending[earliest][0].Time) {
+				earliest = i
+			}
+		}
+		if earliest == -1 {
+			break
+		}
+		messages = append(messages, s.pending[earliest][0])
+		s.pending[earliest] = s.pending[earliest][1:]
+	}
+	if len(messages) == 0 {
+		return nil, io.EOF
+	}
+	return &diagnosticspb.SearchLogResponse{Messages: messages}, nil
+}
+
+func (s *Service) findLogSource(kind model.NodeKind) *config.LogSourceConfig {
+	cfg := s.logSearchConfig.Load()
+	if cfg == nil {
+		return nil
+	}
+	for i := range cfg.LogSources {
+		if cfg.LogSources[i].Kind == kind {
+			return &cfg.LogSources[i]
+		}
+	}
+	return nil
+}
+
+func isInDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveLogSourcePaths returns the log files of the target matched by the glob pattern `filePath`, which must be
+// in the base directory. Symbolic links are resolved, so that they cannot point to the files out of the base
+// directory either. Rotated files are matched together with the current file, and are ordered by the modification
+// time from old to new.
+func resolveLogSourcePaths(baseDir, filePath string, target *model.RequestTargetNode) ([]string, error) {
+	if baseDir == "" {
+		return nil, ErrLogSourcePathForbidden.New("reading log files is disabled, please start the dashboard with --log-source-dir")
+	}
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	// The address of the target is matched literally.
+	escape := strings.NewReplacer("*", "\\*", "?", "\\?", "[", "\\[", "\\", "\\\\")
+	pattern := filepath.Join(base, strings.NewReplacer(
+		"{ip}", escape.Replace(target.IP),
+		"{port}", strconv.Itoa(target.Port),
+	).Replace(filePath))
+	if !isInDir(base, pattern) {
+		return nil, ErrLogSourcePathForbidden.New("log file of %s is out of the log source directory", target.DisplayName)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrLogSourceNotFound.New("log file of %s is not found", target.DisplayName)
+	}
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return nil, err
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	files := make([]logFile, 0, len(matches))
+	for _, m := range matches {
+		realPath, err := filepath.EvalSymlinks(m)
+		if err != nil {
+			return nil, err
+		}
+		if !isInDir(realBase, realPath) {
+			return nil, ErrLogSourcePathForbidden.New("log file of %s is out of the log source directory", target.DisplayName)
+		}
+		info, err := os.Stat(realPath)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		files = append(files, logFile{path: realPath, modTime: info.ModTime()})
+	}
+	if len(files) == 0 {
+		return nil, ErrLogSourceNotFound.New("log file of %s is not found", target.DisplayName)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.path)
+	}
+	return paths, nil
+}
+
+// multiFileReader reads the files one after another.
+type multiFileReader struct {
+	io.Reader
+	files []*os.File
+}
+
+func (r *multiFileReader) Close() error {
+	var firstErr error
+	for _, f := range r.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openLogFiles opens the log files in order. Files which are not modified since `startTime` (unix milliseconds)
+// are skipped, since all of their logs are earlier than the search range.
+func openLogFiles(paths []string, startTime int64) (io.ReadCloser, error) {
+	r := &multiFileReader{}
+	readers := make([]io.Reader, 0, len(paths))
+	for i, p := range paths {
+		// The latest file is always read, so that the reader is never empty.
+		if i < len(paths)-1 {
+			info, err := os.Stat(p)
+			if err != nil {
+				_ = r.Close()
+				return nil, err
+			}
+			if info.ModTime().UnixMilli() < startTime {
+				continue
+			}
+		}
+		f, err := os.Open(p) // #nosec
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, f)
+		readers = append(readers, f)
+	}
+	r.Reader = io.MultiReader(readers...)
+	return r, nil
+}
+
+// openLogSource opens the log of the target from the configured log source of its component.
+func (s *Service) openLogSource(ctx context.Context, target *model.RequestTargetNode, startTime int64) (io.ReadCloser, error) {
+	src := s.findLogSource(target.Kind)
+	if src == nil {
+		return nil, ErrLogSourceNotConfigured.New("%s does not support log search, please configure a log source for it", target.Kind)
+	}
+	if src.FilePath != "" {
+		paths, err := resolveLogSourcePaths(s.config.LogSourceDir, src.FilePath, target)
+		if err != nil {
+			return nil, err
+		}
+		return openLogFiles(paths, startTime)
+	}
+
+	uri := fmt.Sprintf("%s://%s%s",
+		s.config.GetClusterHTTPScheme(),
+		net.JoinHostPort(target.IP, strconv.Itoa(target.Port)),
+		src.HTTPPath)
+	// The log may be large, so it is only bounded by the context instead of the default timeout.
+	resp, err := s.httpClient.WithTimeout(0).Send(ctx, uri, http.MethodGet, nil, ErrLogSourceRequestFailed, string(target.Kind))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Response.Body, nil
+}
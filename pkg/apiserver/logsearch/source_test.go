@@ -0,0 +1,153 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = check.Suite(&testSourceSuite{})
+
+type testSourceSuite struct{}
+
+func (t *testSourceSuite) Test_sourceLogStream(c *check.C) {
+	logs := "[2024/01/01 10:00:00.000 +08:00] [INFO] [server.go:1] [\"start\"]\n" +
+		"[2024/01/01 10:00:01.000 +08:00] [INFO] [capture.go:1] [\"owner changed\"]\n" +
+		"[2024/01/01 10:00:02.000 +08:00] [WARN] [capture.go:2] [\"owner lost\"]\n" +
+		"[2024/01/01 10:00:03.000 +08:00] [ERROR] [capture.go:3] [\"Owner resign failed\"]\n" +
+		"[2024/01/01 10:00:04.000 +08:00] [ERROR] [capture.go:4] [\"owner resign failed\"]\n"
+	req := &diagnosticspb.SearchLogRequest{
+		StartTime: 1704074401000,
+		EndTime:   1704074403000,
+		Levels:    []diagnosticspb.LogLevel{diagnosticspb.LogLevel_Warn, diagnosticspb.LogLevel_Error},
+		Patterns:  []string{"(?i)owner"},
+	}
+	stream, err := newSourceLogStream(context.Background(), io.NopCloser(strings.NewReader(logs)), req)
+	c.Assert(err, check.IsNil)
+
+	res, err := stream.Recv()
+	c.Assert(err, check.IsNil)
+	c.Assert(res.Messages, check.HasLen, 2)
+	c.Assert(res.Messages[0].Level, check.Equals, diagnosticspb.LogLevel_Warn)
+	c.Assert(res.Messages[1].Time, check.Equals, int64(1704074403000))
+	c.Assert(res.Messages[1].Message, check.Equals, "[capture.go:3] [\"Owner resign failed\"]")
+	_, err = stream.Recv()
+	c.Assert(err, check.Equals, io.EOF)
+
+	req.Patterns = []string{"("}
+	_, err = newSourceLogStream(context.Background(), io.NopCloser(strings.NewReader(logs)), req)
+	c.Assert(err, check.NotNil)
+}
+
+func (t *testSourceSuite) Test_resolveLogSourcePaths(c *check.C) {
+	base := c.MkDir()
+	outside := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(base, "127.0.0.1"), 0o777), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(base, "127.0.0.1", "cdc.log"), nil, 0o600), check.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(outside, "secret"), nil, 0o600), check.IsNil)
+	c.Assert(os.Symlink(filepath.Join(outside, "secret"), filepath.Join(base, "link.log")), check.IsNil)
+	target := &model.RequestTargetNode{Kind: model.NodeKindTiCDC, DisplayName: "127.0.0.1:8300", IP: "127.0.0.1", Port: 8300}
+
+	paths, err := resolveLogSourcePaths(base, "{ip}/cdc.log", target)
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.HasLen, 1)
+	c.Assert(filepath.Base(paths[0]), check.Equals, "cdc.log")
+
+	_, err = resolveLogSourcePaths(base, "{ip}/tso.log", target)
+	c.Assert(errorx.IsOfType(err, ErrLogSourceNotFound), check.IsTrue)
+	_, err = resolveLogSourcePaths("", "{ip}/cdc.log", target)
+	c.Assert(errorx.IsOfType(err, ErrLogSourcePathForbidden), check.IsTrue)
+	_, err = resolveLogSourcePaths(base, "../"+filepath.Base(outside)+"/secret", target)
+	c.Assert(errorx.IsOfType(err, ErrLogSourcePathForbidden), check.IsTrue)
+	_, err = resolveLogSourcePaths(base, "link.log", target)
+	c.Assert(errorx.IsOfType(err, ErrLogSourcePathForbidden), check.IsTrue)
+	// The symbolic link is matched by the pattern as well.
+	_, err = resolveLogSourcePaths(base, "*.log", target)
+	c.Assert(errorx.IsOfType(err, ErrLogSourcePathForbidden), check.IsTrue)
+
+	// The address of the target cannot escape the directory either.
+	evil := &model.RequestTargetNode{Kind: model.NodeKindTiCDC, IP: "../..", Port: 8300}
+	_, err = resolveLogSourcePaths(base, "{ip}/{ip}/{ip}/secret", evil)
+	c.Assert(errorx.IsOfType(err, ErrLogSourcePathForbidden), check.IsTrue)
+	// and is not matched as a pattern
+	wildcard := &model.RequestTargetNode{Kind: model.NodeKindTiCDC, IP: "*", Port: 8300}
+	_, err = resolveLogSourcePaths(base, "{ip}/cdc.log", wildcard)
+	c.Assert(errorx.IsOfType(err, ErrLogSourceNotFound), check.IsTrue)
+}
+
+func (t *testSourceSuite) Test_openRotatedLogFiles(c *check.C) {
+	base := c.MkDir()
+	target := &model.RequestTargetNode{Kind: model.NodeKindTiCDC, DisplayName: "127.0.0.1:8300", IP: "127.0.0.1", Port: 8300}
+	files := []struct {
+		name    string
+		content string
+		modTime time.Time
+	}{
+		{"cdc.log", "[2024/01/01 10:00:02.000 +08:00] [INFO] [a.go:1] [\"current\"]\n", time.Unix(1704074402, 0)},
+		{"cdc-2024-01-01T10-00-01.000.log", "[2024/01/01 10:00:01.000 +08:00] [INFO] [a.go:1] [\"rotated\"]\n", time.Unix(1704074401, 0)},
+		{"cdc-2024-01-01T10-00-00.000.log", "[2024/01/01 10:00:00.000 +08:00] [INFO] [a.go:1] [\"old\"]\n", time.Unix(1704074400, 0)},
+	}
+	for _, f := range files {
+		p := filepath.Join(base, f.name)
+		c.Assert(os.WriteFile(p, []byte(f.content), 0o600), check.IsNil)
+		c.Assert(os.Chtimes(p, f.modTime, f.modTime), check.IsNil)
+	}
+
+	paths, err := resolveLogSourcePaths(base, "cdc*.log", target)
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.HasLen, 3)
+	c.Assert(filepath.Base(paths[0]), check.Equals, "cdc-2024-01-01T10-00-00.000.log")
+	c.Assert(filepath.Base(paths[2]), check.Equals, "cdc.log")
+
+	read := func(startTime int64) string {
+		r, err := openLogFiles(paths, startTime)
+		c.Assert(err, check.IsNil)
+		defer r.Close() // #nosec
+		data, err := io.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		return string(data)
+	}
+	c.Assert(read(0), check.Equals, files[2].content+files[1].content+files[0].content)
+	// files not modified since the start time are skipped
+	c.Assert(read(1704074400500), check.Equals, files[1].content+files[0].content)
+	// the latest file is always read
+	c.Assert(read(1704074403000), check.Equals, files[0].content)
+}
+
+func (t *testSourceSuite) Test_mergedLogStream(c *check.C) {
+	messages := func(times ...int64) []*diagnosticspb.LogMessage {
+		msgs := make([]*diagnosticspb.LogMessage, 0, len(times))
+		for _, t := range times {
+			msgs = append(msgs, &diagnosticspb.LogMessage{Time: t})
+		}
+		return msgs
+	}
+	a := &fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{{Messages: messages(1, 4)}, {Messages: messages(5)}}}
+	b := &fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{{Messages: messages(2, 3, 6)}}}
+	stream := newMergedLogStream(a, b)
+
+	res, err := stream.Recv()
+	c.Assert(err, check.IsNil)
+	times := make([]int64, 0)
+	for _, m := range res.Messages {
+		times = append(times, m.Time)
+	}
+	c.Assert(times, check.DeepEquals, []int64{1, 2, 3, 4, 5, 6})
+	_, err = stream.Recv()
+	c.Assert(err, check.Equals, io.EOF)
+
+	failed := newMergedLogStream(&fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{{Messages: messages(1)}}}, &fakeSearchLogClient{err: io.ErrUnexpectedEOF})
+	_, err = failed.Recv()
+	c.Assert(err, check.Equals, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"google.golang.org/grpc"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+const (
+	TailPollInterval = 2 * time.Second
+	// Logs are usually flushed with a delay of several seconds, so that the window of a poll ends earlier than
+	// now, and the recent lines are fetched in later polls.
+	tailLag               = 5 * time.Second
+	tailMaxDuration       = time.Hour
+	tailHeartbeatInterval = 30 * time.Second
+	tailMaxLinesPerPoll   = 1000
+	// A target not responding in time does not delay the lines of other targets.
+	tailSearchTimeout = 5 * time.Second
+)
+
+type TailLogRequest struct {
+	MinLevel LogLevel                  `json:"min_level"`
+	Patterns []string                  `json:"patterns"`
+	Targets  []model.RequestTargetNode `json:"targets" binding:"required"`
+}
+
+type TailLogLine struct {
+	Instance string                 `json:"instance"`
+	Kind     model.NodeKind         `json:"kind"`
+	Time     int64                  `json:"time"`
+	Level    diagnosticspb.LogLevel `json:"level" swaggertype:"integer"`
+	Message  string                 `json:"message"`
+}
+
+type TailLogError struct {
+	Instance string `json:"instance"`
+	Error    string `json:"error"`
+}
+
+var errTailTooManyLines = fmt.Errorf("more than %d lines in a poll, the rest are skipped", tailMaxLinesPerPoll)
+
+type tailTarget struct {
+	target *model.RequestTargetNode
+	conn   *grpc.ClientConn
+	client diagnosticspb.DiagnosticsClient
+	// unix timestamp in milliseconds, the beginning of the next window of this target
+	cursor int64
+}
+
+// logTailer polls the logs of the targets with moving windows, and merges the lines in timestamp order. Each
+// target has its own window, which only moves when the target is searched successfully, so that the lines of a
+// failed poll are fetched in the next poll.
+type logTailer struct {
+	req           *TailLogRequest
+	targets       []*tailTarget
+	searchTimeout time.Duration
+}
+
+func (s *Service) newLogTailer(req *TailLogRequest, now time.Time) (*logTailer, error) {
+	tailer := &logTailer{
+		req:           req,
+		targets:       make([]*tailTarget, 0, len(req.Targets)),
+		searchTimeout: tailSearchTimeout,
+	}
+	for i := range req.Targets {
+		target := &req.Targets[i]
+		conn, err := s.dialDiagnostics(target)
+		if err != nil {
+			tailer.Close()
+			return nil, err
+		}
+		tailer.targets = append(tailer.targets, &tailTarget{
+			target: target,
+			conn:   conn,
+			client: diagnosticspb.NewDiagnosticsClient(conn),
+			cursor: now.Add(-tailLag).UnixMilli(),
+		})
+	}
+	return tailer, nil
+}
+
+func (t *logTailer) Close() {
+	for _, target := range t.targets {
+		_ = target.conn.Close()
+	}
+}
+
+// Poll fetches the lines between the cursor of each target and now. Errors of a target, including not responding
+// in time, do not stop other targets. The lines of a failed target are dropped and fetched again in the next poll,
+// except when there are too many lines, which are skipped to keep up with the logs.
+func (t *logTailer) Poll(ctx context.Context, now time.Time) ([]*TailLogLine, []TailLogError) {
+	end := now.Add(-tailLag).UnixMilli()
+	patterns := make([]string, 0, len(t.req.Patterns))
+	for _, p := range t.req.Patterns {
+		patterns = append(patterns, "(?i)"+p)
+	}
+
+	var mu sync.Mutex
+	lines := make([]*TailLogLine, 0)
+	errs := make([]TailLogError, 0)
+	var wg sync.WaitGroup
+	for _, target := range t.targets {
+		if end < target.cursor {
+			continue
+		}
+		searchReq := &SearchLogRequest{
+			StartTime: target.cursor,
+			EndTime:   end,
+			MinLevel:  t.req.MinLevel,
+			Patterns:  patterns,
+		}
+		wg.Add(1)
+		go func(target *tailTarget) {
+			defer wg.Done()
+			searchCtx, cancel := context.WithTimeout(ctx, t.searchTimeout)
+			defer cancel()
+			targetLines, err := target.search(searchCtx, searchReq)
+			switch {
+			case err == nil || err == errTailTooManyLines:
+				target.cursor = end + 1
+			case searchCtx.Err() == context.DeadlineExceeded:
+				targetLines = nil
+				err = fmt.Errorf("no response in %s, the lines are fetched again in the next poll", t.searchTimeout)
+			default:
+				targetLines = nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, targetLines...)
+			if err != nil {
+				errs = append(errs, TailLogError{Instance: target.target.DisplayName, Error: err.Error()})
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+	return lines, errs
+}
+
+func (t *tailTarget) search(ctx context.Context, req *SearchLogRequest) ([]*TailLogLine, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := t.client.SearchLog(ctx, req.ConvertToPB(diagnosticspb.SearchLogRequest_Normal))
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]*TailLogLine, 0)
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return lines, nil
+			}
+			return lines, err
+		}
+		for _, msg := range res.Messages {
+			if len(lines) >= tailMaxLinesPerPoll {
+				return lines, errTailTooManyLines
+			}
+			lines = append(lines, &TailLogLine{
+				Instance: t.target.DisplayName,
+				Kind:     t.target.Kind,
+				Time:     msg.Time,
+				Level:    msg.Level,
+				Message:  msg.Message,
+			})
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = check.Suite(&testTailSuite{})
+
+type testTailSuite struct{}
+
+// hangingDiagnosticsClient does not respond until the context is done.
+type hangingDiagnosticsClient struct {
+	diagnosticspb.DiagnosticsClient
+	startTimes []int64
+}
+
+func (f *hangingDiagnosticsClient) SearchLog(ctx context.Context, req *diagnosticspb.SearchLogRequest, _ ...grpc.CallOption) (diagnosticspb.Diagnostics_SearchLogClient, error) {
+	f.startTimes = append(f.startTimes, req.StartTime)
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func (t *testTailSuite) Test_PollTimeout(c *check.C) {
+	now := time.Now()
+	res := &diagnosticspb.SearchLogResponse{Messages: []*diagnosticspb.LogMessage{
+		{Time: now.UnixMilli(), Level: diagnosticspb.LogLevel_Info, Message: "ok"},
+	}}
+	start := now.Add(-time.Minute).UnixMilli()
+	hanging := &hangingDiagnosticsClient{}
+	tailer := &logTailer{
+		req: &TailLogRequest{},
+		targets: []*tailTarget{
+			{
+				target: &model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "127.0.0.1:4000"},
+				client: &fakeDiagnosticsClient{stream: &fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{res}}},
+				cursor: start,
+			},
+			{
+				target: &model.RequestTargetNode{Kind: model.NodeKindTiKV, DisplayName: "127.0.0.1:20160"},
+				client: hanging,
+				cursor: start,
+			},
+		},
+		searchTimeout: 50 * time.Millisecond,
+	}
+
+	lines, errs := tailer.Poll(context.Background(), now.Add(tailLag))
+	c.Assert(lines, check.HasLen, 1)
+	c.Assert(lines[0].Message, check.Equals, "ok")
+	c.Assert(errs, check.HasLen, 1)
+	c.Assert(errs[0].Instance, check.Equals, "127.0.0.1:20160")
+	c.Assert(errs[0].Error, check.Matches, "no response in 50ms.*")
+
+	// Only the window of the target responding in time moves, the other one is searched from the same time again.
+	c.Assert(tailer.targets[0].cursor, check.Equals, now.UnixMilli()+1)
+	c.Assert(tailer.targets[1].cursor, check.Equals, start)
+	_, errs = tailer.Poll(context.Background(), now.Add(tailLag+time.Second))
+	c.Assert(errs, check.HasLen, 1)
+	c.Assert(hanging.startTimes, check.DeepEquals, []int64{start, start})
+}
+
+func (t *testTailSuite) Test_PollFailedTarget(c *check.C) {
+	now := time.Now()
+	start := now.Add(-time.Minute).UnixMilli()
+	stream := &fakeSearchLogClient{
+		responses: []*diagnosticspb.SearchLogResponse{{Messages: []*diagnosticspb.LogMessage{
+			{Time: now.UnixMilli(), Level: diagnosticspb.LogLevel_Info, Message: "late"},
+		}}},
+		err: status.Error(codes.Unavailable, "connection refused"),
+	}
+	tailer := &logTailer{
+		req: &TailLogRequest{},
+		targets: []*tailTarget{{
+			target: &model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "127.0.0.1:4000"},
+			client: &fakeDiagnosticsClient{stream: stream},
+			cursor: start,
+		}},
+		searchTimeout: time.Second,
+	}
+
+	lines, errs := tailer.Poll(context.Background(), now.Add(tailLag))
+	c.Assert(lines, check.HasLen, 0)
+	c.Assert(errs, check.HasLen, 1)
+	c.Assert(tailer.targets[0].cursor, check.Equals, start)
+
+	// The lines are fetched once the target recovers.
+	stream.err = nil
+	lines, errs = tailer.Poll(context.Background(), now.Add(tailLag))
+	c.Assert(errs, check.HasLen, 0)
+	c.Assert(lines, check.HasLen, 1)
+	c.Assert(lines[0].Message, check.Equals, "late")
+	c.Assert(tailer.targets[0].cursor, check.Equals, now.UnixMilli()+1)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+)
+
+func newTarget(kind model.NodeKind, ip string, port, searchPort uint) model.RequestTargetNode {
+	return model.RequestTargetNode{
+		Kind:        kind,
+		DisplayName: net.JoinHostPort(ip, strconv.Itoa(int(port))),
+		IP:          ip,
+		Port:        int(searchPort),
+	}
+}
+
+// resolveTargets lists the current instances of the components. Same as the UI, TiDB and TiProxy logs are
+// searched through the status port, while other components are searched through the service port.
+func (s *Service) resolveTargets(ctx context.Context, kinds []model.NodeKind) ([]model.RequestTargetNode, error) {
+	targets := make([]model.RequestTargetNode, 0)
+	for _, kind := range kinds {
+		switch kind {
+		case model.NodeKindTiDB:
+			instances, err := topology.FetchTiDBTopology(ctx, s.etcdClient)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range instances {
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.StatusPort))
+			}
+		case model.NodeKindTiProxy:
+			instances, err := topology.FetchTiProxyTopology(ctx, s.etcdClient)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range instances {
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.StatusPort))
+			}
+		case model.NodeKindTiKV, model.NodeKindTiFlash:
+			tikvs, tiflashes, err := topology.FetchStoreTopology(s.pdClient)
+			if err != nil {
+				return nil, err
+			}
+			stores := tikvs
+			if kind == model.NodeKindTiFlash {
+				stores = tiflashes
+			}
+			for _, i := range stores {
+				if i.Status == topology.ComponentStatusTombstone {
+					continue
+				}
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.Port))
+			}
+		case model.NodeKindPD:
+			instances, err := topology.FetchPDTopology(s.pdClient)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range instances {
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.Port))
+			}
+		case model.NodeKindTiCDC:
+			instances, err := topology.FetchTiCDCTopology(ctx, s.etcdClient)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range instances {
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.Port))
+			}
+		case model.NodeKindTSO:
+			instances, err := topology.FetchTSOTopology(ctx, s.pdClient)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range instances {
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.Port))
+			}
+		case model.NodeKindScheduling:
+			instances, err := topology.FetchSchedulingTopology(ctx, s.pdClient)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range instances {
+				targets = append(targets, newTarget(kind, i.IP, i.Port, i.Port))
+			}
+		}
+	}
+	return targets, nil
+}
@@ -8,7 +8,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"math"
 	"net"
 	"os"
 	"path"
@@ -22,15 +21,30 @@ import (
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 )
 
-// MaxRecvMsgSize set max gRPC receive message size received from server. If any message size is larger than
-// current value, an error will be reported from gRPC.
-var MaxRecvMsgSize = math.MaxInt64 - 1
+// The interval of saving the progress of a running task.
+const taskProgressInterval = time.Second
+
+func (s *Service) dialDiagnostics(target *model.RequestTargetNode) (*grpc.ClientConn, error) {
+	secureOpt := grpc.WithTransportCredentials(insecure.NewCredentials())
+	if s.config.ClusterTLSConfig != nil {
+		creds := credentials.NewTLS(s.config.ClusterTLSConfig)
+		secureOpt = grpc.WithTransportCredentials(creds)
+	}
+
+	return grpc.Dial(net.JoinHostPort(target.IP, strconv.Itoa(target.Port)),
+		secureOpt,
+		// gRPC reports an error if any message received from the server is larger than the limit.
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(int(s.maxRecvMsgSize.Load()))),
+	)
+}
 
 type TaskGroup struct {
 	service                *Service
@@ -56,6 +70,8 @@ func (tg *TaskGroup) InitTasks(ctx context.Context, taskModels []*TaskModel) {
 			model:     taskModel,
 			ctx:       ctx,
 			cancel:    cancel,
+			indexer: newLogIndexer(tg.service.db, &tg.service.indexMu, tg.service.diskQuota, taskModel.ID, tg.model.ID,
+				int(tg.service.maxIndexedLines.Load())),
 		})
 	}
 }
@@ -81,6 +97,12 @@ func (tg *TaskGroup) SyncRun() {
 	}
 	wg.Wait()
 
+	unclustered, err := analyzePatterns(tg.service.db, tg.model.ID)
+	if err != nil {
+		log.Warn("Failed to analyze log patterns", zap.Uint("task_group_id", tg.model.ID), zap.Error(err))
+	}
+	tg.model.UnclusteredLines = unclustered
+
 	log.Debug("LogSearchTaskGroup finished", zap.Uint("task_group_id", tg.model.ID))
 	tg.model.State = TaskGroupStateFinished
 	tg.service.db.Save(tg.model)
@@ -103,6 +125,9 @@ type Task struct {
 	model     *TaskModel
 	ctx       context.Context
 	cancel    context.CancelFunc
+	indexer   *logIndexer
+	// Bytes reserved in the disk quota, released after the stored size is saved.
+	reservedBytes int64
 }
 
 func (t *Task) String() string {
@@ -138,7 +163,20 @@ func (t *Task) accumulateLogSize(path *string) {
 	}
 }
 
+func (t *Task) saveIndexState() {
+	t.model.IndexSize = t.indexer.size
+	t.model.Indexed = t.indexer.err == nil
+	t.model.IndexError = nil
+	if t.indexer.err != nil {
+		errStr := t.indexer.err.Error()
+		t.model.IndexError = &errStr
+	}
+}
+
 func (t *Task) SyncRun() {
+	defer func() {
+		t.taskGroup.service.diskQuota.Release(t.reservedBytes + t.indexer.reserved)
+	}()
 	defer func() {
 		if t.model.Error != nil {
 			log.Warn("LogSearchTask stopped with error",
@@ -153,6 +191,7 @@ func (t *Task) SyncRun() {
 		t.model.State = TaskStateFinished
 		t.accumulateLogSize(t.model.LogStorePath)
 		t.accumulateLogSize(t.model.SlowLogStorePath)
+		t.saveIndexState()
 		log.Debug("LogSearchTask finished", zap.Any("task", t))
 		t.taskGroup.service.db.Save(t.model)
 	}()
@@ -164,45 +203,128 @@ func (t *Task) SyncRun() {
 		return
 	}
 
-	secureOpt := grpc.WithTransportCredentials(insecure.NewCredentials())
-	if t.taskGroup.service.config.ClusterTLSConfig != nil {
-		creds := credentials.NewTLS(t.taskGroup.service.config.ClusterTLSConfig)
-		secureOpt = grpc.WithTransportCredentials(creds)
+	pool := t.taskGroup.service.taskPool
+	if err := pool.Acquire(t.ctx); err != nil {
+		t.setError(err)
+		return
 	}
+	defer pool.Release()
 
-	conn, err := grpc.Dial(net.JoinHostPort(t.model.Target.IP, strconv.Itoa(t.model.Target.Port)),
-		secureOpt,
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(MaxRecvMsgSize)),
-	)
+	conn, err := t.taskGroup.service.dialDiagnostics(t.model.Target)
 	if err != nil {
 		t.setError(err)
 		return
 	}
 	defer conn.Close()
 
-	cli := diagnosticspb.NewDiagnosticsClient(conn)
-	t.searchLog(cli, diagnosticspb.SearchLogRequest_Normal)
-	// Only TiKV support searching slow log now
-	if t.model.Target.Kind == model.NodeKindTiKV {
-		t.searchLog(cli, diagnosticspb.SearchLogRequest_Slow)
-	}
+	t.searchTargetLog(diagnosticspb.NewDiagnosticsClient(conn))
 }
 
-func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diagnosticspb.SearchLogRequest_Target) {
-	if t.model.Error != nil {
+// searchTargetLog searches the log through the diagnostics service of the target. The log source is used instead
+// when the component does not implement the diagnostics service, or the service fails and a log source is
+// configured for the component. The log source of TiFlash is the log of its proxy, which is searched together with
+// the log of TiFlash instead of replacing it.
+func (t *Task) searchTargetLog(cli diagnosticspb.DiagnosticsClient) {
+	if err := t.searchLog(cli, diagnosticspb.SearchLogRequest_Normal); err != nil {
+		if t.model.Target.Kind == model.NodeKindTiFlash ||
+			(status.Code(err) != codes.Unimplemented && t.taskGroup.service.findLogSource(t.model.Target.Kind) == nil) {
+			t.setError(err)
+			return
+		}
+		log.Debug("Search log from the log source", zap.Any("task", t), zap.Error(err))
+		t.searchSourceLog()
 		return
 	}
+	// Only TiKV support searching slow log now
+	if t.model.Target.Kind == model.NodeKindTiKV && t.model.Error == nil {
+		if err := t.searchLog(cli, diagnosticspb.SearchLogRequest_Slow); err != nil {
+			t.setError(err)
+		}
+	}
+}
+
+func (t *Task) searchRequest(targetType diagnosticspb.SearchLogRequest_Target) *diagnosticspb.SearchLogRequest {
 	req := t.taskGroup.model.SearchRequest.ConvertToPB(targetType)
 	patterns := make([]string, len(req.Patterns))
 	for i, p := range req.Patterns {
 		patterns[i] = "(?i)" + p
 	}
 	req.Patterns = patterns
-	stream, err := client.SearchLog(t.ctx, req)
+	return req
+}
+
+// prefetchedLogStream replays the first response received before the stream is saved.
+type prefetchedLogStream struct {
+	logStream
+	first *diagnosticspb.SearchLogResponse
+	err   error
+}
+
+func (s *prefetchedLogStream) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	if s.first != nil || s.err != nil {
+		res, err := s.first, s.err
+		s.first, s.err = nil, nil
+		return res, err
+	}
+	return s.logStream.Recv()
+}
+
+// searchLog returns the error if the search fails before any log is received, e.g. the diagnostics service is
+// not implemented. Later errors are set to the task.
+func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diagnosticspb.SearchLogRequest_Target) error {
+	stream, err := client.SearchLog(t.ctx, t.searchRequest(targetType))
+	if err != nil {
+		return err
+	}
+	// Errors of the server streaming call are only returned by Recv.
+	first, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	meter := t.newStreamMeter()
+	var logs logStream = &meteredLogStream{logStream: &prefetchedLogStream{logStream: stream, first: first, err: err}, meter: meter}
+	if targetType == diagnosticspb.SearchLogRequest_Normal &&
+		t.model.Target.Kind == model.NodeKindTiFlash &&
+		t.taskGroup.service.findLogSource(model.NodeKindTiFlash) != nil {
+		proxyLogs, err := t.openSourceLogStream(meter)
+		if err != nil {
+			t.setError(err)
+			return nil
+		}
+		defer proxyLogs.Close() // #nosec
+		logs = newMergedLogStream(logs, proxyLogs)
+	}
+	t.saveLogStream(logs, targetType)
+	return nil
+}
+
+// openSourceLogStream opens the log collected from the log source. The received bytes are counted by `meter`.
+func (t *Task) openSourceLogStream(meter *streamMeter) (*sourceLogStream, error) {
+	req := t.searchRequest(diagnosticspb.SearchLogRequest_Normal)
+	r, err := t.taskGroup.service.openLogSource(t.ctx, t.model.Target, req.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newSourceLogStream(t.ctx, &meteredReader{ReadCloser: r, meter: meter}, req)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// searchSourceLog searches the log collected from the log source.
+func (t *Task) searchSourceLog() {
+	stream, err := t.openSourceLogStream(t.newStreamMeter())
 	if err != nil {
 		t.setError(err)
 		return
 	}
+	defer stream.Close() // #nosec
+	t.saveLogStream(stream, diagnosticspb.SearchLogRequest_Normal)
+}
+
+func (t *Task) saveLogStream(stream logStream, targetType diagnosticspb.SearchLogRequest_Target) {
 
 	// Create zip file for the log in the log directory
 	fileName := t.model.Target.FileName()
@@ -235,8 +357,17 @@ func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diag
 
 	t.model.State = TaskStateRunning
 	previewLogLinesCount := 0
+	defer t.indexer.Flush()
+	lastProgressAt := time.Now()
 	for {
 		res, err := stream.Recv()
+		if err == nil {
+			t.model.LinesMatched += int64(len(res.Messages))
+			if time.Since(lastProgressAt) >= taskProgressInterval {
+				t.saveProgress()
+				lastProgressAt = time.Now()
+			}
+		}
 		if err != nil {
 			if err != io.EOF {
 				t.setError(err)
@@ -267,10 +398,18 @@ func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diag
 				})
 				previewLogLinesCount++
 			}
+			t.indexer.Add(msg)
 		}
 	}
 }
 
+func (t *Task) saveProgress() {
+	t.taskGroup.service.db.Model(t.model).Updates(map[string]interface{}{
+		"bytes_received": t.model.BytesReceived,
+		"lines_matched":  t.model.LinesMatched,
+	})
+}
+
 func logMessageToString(msg *diagnosticspb.LogMessage) string {
 	timeStr := time.Unix(0, msg.Time*int64(time.Millisecond)).Format("2006/01/02 15:04:05.000 -07:00")
 	return fmt.Sprintf("[%s] [%s] %s\n", timeStr, msg.Level.String(), msg.Message)
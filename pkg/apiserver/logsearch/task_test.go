@@ -0,0 +1,198 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logsearch
+
+import (
+	"context"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+var _ = check.Suite(&testTaskSuite{})
+
+type testTaskSuite struct{}
+
+func newTestService(c *check.C) *Service {
+	dir := c.MkDir()
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(dir, "test.sqlite.db")))
+	c.Assert(err, check.IsNil)
+	db := &dbstore.DB{DB: gormDB}
+	c.Assert(autoMigrate(db), check.IsNil)
+	s := &Service{
+		config:            &config.Config{},
+		logStoreDirectory: dir,
+		db:                db,
+		taskPool:          newTaskPool(1),
+		diskQuota:         newDiskQuota(db),
+	}
+	s.logSearchConfig.Store(&config.LogSearchConfig{})
+	s.applyDefaultLimits()
+	return s
+}
+
+func newTestTask(c *check.C, s *Service, target model.RequestTargetNode) *Task {
+	tg := &TaskGroup{
+		service: s,
+		model: &TaskGroupModel{
+			SearchRequest: &SearchLogRequest{EndTime: math.MaxInt64},
+			State:         TaskGroupStateRunning,
+		},
+		maxPreviewLinesPerTask: TaskMaxPreviewLines,
+	}
+	c.Assert(s.db.Create(tg.model).Error, check.IsNil)
+	dir := filepath.Join(s.logStoreDirectory, "task-groups")
+	c.Assert(os.MkdirAll(dir, 0o777), check.IsNil)
+	tg.model.LogStoreDir = &dir
+	task := &TaskModel{TaskGroupID: tg.model.ID, Target: &target, State: TaskStateRunning}
+	c.Assert(s.db.Create(task).Error, check.IsNil)
+	tg.InitTasks(context.Background(), []*TaskModel{task})
+	return tg.tasks[0]
+}
+
+type fakeSearchLogClient struct {
+	grpc.ClientStream
+	responses []*diagnosticspb.SearchLogResponse
+	err       error
+}
+
+func (f *fakeSearchLogClient) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.responses) == 0 {
+		return nil, io.EOF
+	}
+	res := f.responses[0]
+	f.responses = f.responses[1:]
+	return res, nil
+}
+
+type fakeDiagnosticsClient struct {
+	diagnosticspb.DiagnosticsClient
+	stream *fakeSearchLogClient
+}
+
+func (f *fakeDiagnosticsClient) SearchLog(context.Context, *diagnosticspb.SearchLogRequest, ...grpc.CallOption) (diagnosticspb.Diagnostics_SearchLogClient, error) {
+	return f.stream, nil
+}
+
+const testSourceLog = "[2024/01/01 10:00:00.000 +08:00] [INFO] [server.go:1] [\"start\"]\n" +
+	"[2024/01/01 10:00:01.000 +08:00] [WARN] [capture.go:2] [\"owner lost\"]\n"
+
+func (t *testTaskSuite) writeSourceLog(c *check.C, s *Service) {
+	s.config.LogSourceDir = c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(s.config.LogSourceDir, "127.0.0.1-8300.log"), []byte(testSourceLog), 0o600), check.IsNil)
+	s.logSearchConfig.Store(&config.LogSearchConfig{
+		LogSources: []config.LogSourceConfig{{Kind: model.NodeKindTiCDC, FilePath: "{ip}-{port}.log"}},
+	})
+}
+
+func (t *testTaskSuite) Test_searchTargetLogDiagnostics(c *check.C) {
+	s := newTestService(c)
+	// The diagnostics service is preferred even if a log source is configured.
+	t.writeSourceLog(c, s)
+	task := newTestTask(c, s, model.RequestTargetNode{Kind: model.NodeKindTiCDC, DisplayName: "127.0.0.1:8300", IP: "127.0.0.1", Port: 8300})
+	res := &diagnosticspb.SearchLogResponse{Messages: []*diagnosticspb.LogMessage{
+		{Time: 1704074400000, Level: diagnosticspb.LogLevel_Info, Message: "from grpc"},
+	}}
+	task.searchTargetLog(&fakeDiagnosticsClient{stream: &fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{res}}})
+
+	c.Assert(task.model.Error, check.IsNil)
+	c.Assert(task.model.LinesMatched, check.Equals, int64(1))
+	c.Assert(task.model.BytesReceived, check.Equals, int64(res.Size()))
+	var previews []PreviewModel
+	c.Assert(s.db.Find(&previews).Error, check.IsNil)
+	c.Assert(previews, check.HasLen, 1)
+	c.Assert(previews[0].Message, check.Equals, "from grpc")
+}
+
+func (t *testTaskSuite) Test_searchTargetLogFallback(c *check.C) {
+	s := newTestService(c)
+	target := model.RequestTargetNode{Kind: model.NodeKindTiCDC, DisplayName: "127.0.0.1:8300", IP: "127.0.0.1", Port: 8300}
+	unimplemented := &fakeDiagnosticsClient{stream: &fakeSearchLogClient{err: status.Error(codes.Unimplemented, "unknown service")}}
+
+	// no log source is configured
+	task := newTestTask(c, s, target)
+	task.searchTargetLog(unimplemented)
+	c.Assert(task.model.Error, check.NotNil)
+	c.Assert(*task.model.Error, check.Matches, ".*configure a log source.*")
+
+	// other errors are not fallen back without a log source
+	task = newTestTask(c, s, target)
+	task.searchTargetLog(&fakeDiagnosticsClient{stream: &fakeSearchLogClient{err: status.Error(codes.Unavailable, "connection refused")}})
+	c.Assert(task.model.Error, check.NotNil)
+	c.Assert(*task.model.Error, check.Matches, ".*connection refused.*")
+
+	t.writeSourceLog(c, s)
+	task = newTestTask(c, s, target)
+	task.searchTargetLog(unimplemented)
+	c.Assert(task.model.Error, check.IsNil)
+	c.Assert(task.model.LinesMatched, check.Equals, int64(2))
+	// The whole log file is metered instead of the matched lines.
+	c.Assert(task.model.BytesReceived, check.Equals, int64(len(testSourceLog)))
+	c.Assert(task.reservedBytes, check.Equals, int64(len(testSourceLog)))
+	c.Assert(task.model.LogStorePath, check.NotNil)
+}
+
+func (t *testTaskSuite) Test_searchTargetLogTiFlashProxy(c *check.C) {
+	s := newTestService(c)
+	s.config.LogSourceDir = c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(s.config.LogSourceDir, "127.0.0.1-3930-proxy.log"), []byte(testSourceLog), 0o600), check.IsNil)
+	s.logSearchConfig.Store(&config.LogSearchConfig{
+		LogSources: []config.LogSourceConfig{{Kind: model.NodeKindTiFlash, FilePath: "{ip}-{port}-proxy.log"}},
+	})
+	target := model.RequestTargetNode{Kind: model.NodeKindTiFlash, DisplayName: "127.0.0.1:3930", IP: "127.0.0.1", Port: 3930}
+
+	// The log of the proxy is merged into the log of TiFlash by time.
+	task := newTestTask(c, s, target)
+	res := &diagnosticspb.SearchLogResponse{Messages: []*diagnosticspb.LogMessage{
+		{Time: 1704074400500, Level: diagnosticspb.LogLevel_Info, Message: "from tiflash"},
+	}}
+	task.searchTargetLog(&fakeDiagnosticsClient{stream: &fakeSearchLogClient{responses: []*diagnosticspb.SearchLogResponse{res}}})
+	c.Assert(task.model.Error, check.IsNil)
+	c.Assert(task.model.LinesMatched, check.Equals, int64(3))
+	c.Assert(task.model.BytesReceived, check.Equals, int64(res.Size()+len(testSourceLog)))
+	var previews []PreviewModel
+	c.Assert(s.db.Where("task_id = ?", task.model.ID).Order("id").Find(&previews).Error, check.IsNil)
+	c.Assert(previews, check.HasLen, 3)
+	c.Assert(previews[0].Message, check.Equals, "[server.go:1] [\"start\"]")
+	c.Assert(previews[1].Message, check.Equals, "from tiflash")
+	c.Assert(previews[2].Message, check.Equals, "[capture.go:2] [\"owner lost\"]")
+
+	// The log of the proxy cannot replace the log of TiFlash.
+	task = newTestTask(c, s, target)
+	task.searchTargetLog(&fakeDiagnosticsClient{stream: &fakeSearchLogClient{err: status.Error(codes.Unimplemented, "unknown service")}})
+	c.Assert(task.model.Error, check.NotNil)
+	c.Assert(*task.model.Error, check.Matches, ".*unknown service.*")
+}
+
+func (t *testTaskSuite) Test_saveProgress(c *check.C) {
+	s := newTestService(c)
+	task := newTestTask(c, s, model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "127.0.0.1:4000", IP: "127.0.0.1", Port: 4000})
+	task.model.BytesReceived = 1024
+	task.model.LinesMatched = 10
+	// other fields are not saved with the progress
+	task.model.State = TaskStateFinished
+	task.saveProgress()
+
+	var saved TaskModel
+	c.Assert(s.db.First(&saved, task.model.ID).Error, check.IsNil)
+	c.Assert(saved.BytesReceived, check.Equals, int64(1024))
+	c.Assert(saved.LinesMatched, check.Equals, int64(10))
+	c.Assert(saved.State, check.Equals, TaskStateRunning)
+}
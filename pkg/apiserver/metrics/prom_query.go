@@ -0,0 +1,102 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// PromSample is a sample of the instant vector returned by Prometheus.
+type PromSample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+type promInstantQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type promVectorSample struct {
+	Metric map[string]string `json:"metric"`
+	// [unix timestamp in seconds, value in string]
+	Value [2]interface{} `json:"value"`
+}
+
+func parsePromVector(body []byte) ([]PromSample, error) {
+	var resp promInstantQueryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, ErrPrometheusQueryFailed.Wrap(err, "failed to parse Prometheus query result")
+	}
+	if resp.Status != "success" {
+		return nil, ErrPrometheusQueryFailed.New("failed to query Prometheus: %s", resp.Error)
+	}
+	if resp.Data.ResultType != "vector" {
+		return nil, ErrPrometheusQueryFailed.New("result type %s is not vector", resp.Data.ResultType)
+	}
+	var result []promVectorSample
+	if err := json.Unmarshal(resp.Data.Result, &result); err != nil {
+		return nil, ErrPrometheusQueryFailed.Wrap(err, "failed to parse Prometheus query result")
+	}
+	samples := make([]PromSample, 0, len(result))
+	for _, r := range result {
+		str, ok := r.Value[1].(string)
+		if !ok {
+			return nil, ErrPrometheusQueryFailed.New("invalid sample value %v", r.Value[1])
+		}
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, ErrPrometheusQueryFailed.Wrap(err, "invalid sample value %s", str)
+		}
+		samples = append(samples, PromSample{Labels: r.Metric, Value: v})
+	}
+	return samples, nil
+}
+
+// QueryInstant evaluates the PromQL expression at the given time, and returns the samples of the instant vector.
+func (s *Service) QueryInstant(ctx context.Context, query string, t time.Time) ([]PromSample, error) {
+	addr, err := s.getPromAddressFromCache()
+	if err != nil {
+		return nil, ErrLoadPrometheusAddressFailed.Wrap(err, "Load prometheus address failed")
+	}
+	if addr == "" {
+		return nil, ErrPrometheusNotFound.New("Prometheus is not deployed in the cluster")
+	}
+
+	params := url.Values{}
+	params.Add("query", query)
+	params.Add("time", strconv.FormatInt(t.Unix(), 10))
+
+	uri := fmt.Sprintf("%s/api/v1/query?%s", addr, params.Encode())
+	promReq, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, ErrPrometheusQueryFailed.Wrap(err, "failed to build Prometheus request")
+	}
+
+	promResp, err := s.params.HTTPClient.WithTimeout(defaultPromQueryTimeout).Do(promReq)
+	if err != nil {
+		return nil, ErrPrometheusQueryFailed.Wrap(err, "failed to send requests to Prometheus")
+	}
+	defer promResp.Body.Close()
+
+	body, err := io.ReadAll(promResp.Body)
+	if err != nil {
+		return nil, ErrPrometheusQueryFailed.Wrap(err, "failed to read Prometheus query result")
+	}
+	// Prometheus responds the error in the body for bad queries.
+	if promResp.StatusCode != http.StatusOK && len(body) == 0 {
+		return nil, ErrPrometheusQueryFailed.New("failed to query Prometheus")
+	}
+	return parsePromVector(body)
+}
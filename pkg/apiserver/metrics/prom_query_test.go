@@ -0,0 +1,28 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parsePromVector(t *testing.T) {
+	samples, err := parsePromVector([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"instance":"127.0.0.1:10080"},"value":[1700000000.123,"0.85"]},
+		{"metric":{"instance":"127.0.0.2:10080"},"value":[1700000000.123,"NaN"]}
+	]}}`))
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	require.Equal(t, "127.0.0.1:10080", samples[0].Labels["instance"])
+	require.Equal(t, 0.85, samples[0].Value)
+	require.True(t, math.IsNaN(samples[1].Value))
+
+	_, err = parsePromVector([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	require.ErrorContains(t, err, "parse error")
+
+	_, err = parsePromVector([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"1"]}}`))
+	require.ErrorContains(t, err, "not vector")
+}
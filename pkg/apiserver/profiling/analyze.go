@@ -0,0 +1,150 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+func loadProtobufProfile(task *TaskModel) (*profile.Profile, error) {
+	if task.RawDataType != RawDataTypeProtobuf {
+		return nil, ErrUnsupportedRawDataType.New("task %d is not a protobuf profile", task.ID)
+	}
+	content, err := os.ReadFile(task.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	p, err := profile.ParseData(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile of task %d: %v", task.ID, err)
+	}
+	return p, nil
+}
+
+// sampleValueIndex returns the index of the sample value shown by default, the same as pprof.
+func sampleValueIndex(p *profile.Profile) int {
+	if p.DefaultSampleType != "" {
+		for i, st := range p.SampleType {
+			if st.Type == p.DefaultSampleType {
+				return i
+			}
+		}
+	}
+	return len(p.SampleType) - 1
+}
+
+// sampleFrames returns the function names of the stack of the sample, from the root to the leaf. Inlined
+// functions are expanded.
+func sampleFrames(s *profile.Sample) []string {
+	frames := make([]string, 0, len(s.Location))
+	for i := len(s.Location) - 1; i >= 0; i-- {
+		loc := s.Location[i]
+		if len(loc.Line) == 0 {
+			frames = append(frames, fmt.Sprintf("0x%x", loc.Address))
+			continue
+		}
+		for j := len(loc.Line) - 1; j >= 0; j-- {
+			name := "<unknown>"
+			if loc.Line[j].Function != nil {
+				name = loc.Line[j].Function.Name
+			}
+			frames = append(frames, name)
+		}
+	}
+	return frames
+}
+
+type functionStat struct {
+	Flat int64
+	Cum  int64
+}
+
+// functionStats sums up the flat and cumulative values of each function. The value of a sample is only counted
+// once in the cumulative value of a function even if the function appears in the stack recursively.
+func functionStats(p *profile.Profile, valueIndex int) (stats map[string]*functionStat, total int64) {
+	stats = make(map[string]*functionStat)
+	get := func(name string) *functionStat {
+		st, ok := stats[name]
+		if !ok {
+			st = &functionStat{}
+			stats[name] = st
+		}
+		return st
+	}
+	for _, s := range p.Sample {
+		v := s.Value[valueIndex]
+		total += v
+		frames := sampleFrames(s)
+		if len(frames) == 0 {
+			continue
+		}
+		get(frames[len(frames)-1]).Flat += v
+		seen := make(map[string]struct{}, len(frames))
+		for _, f := range frames {
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = struct{}{}
+			get(f).Cum += v
+		}
+	}
+	return stats, total
+}
+
+func share(v, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(v) / float64(total)
+}
+
+const DefaultTopLimit = 100
+
+type TopRow struct {
+	Function  string  `json:"function"`
+	Flat      int64   `json:"flat"`
+	FlatShare float64 `json:"flat_share"`
+	Cum       int64   `json:"cum"`
+	CumShare  float64 `json:"cum_share"`
+}
+
+type TopResponse struct {
+	Unit  string   `json:"unit"`
+	Total int64    `json:"total"`
+	Rows  []TopRow `json:"rows"`
+}
+
+// buildTopTable lists the functions sorted by the flat value, or by the cumulative value if sortByCum is set,
+// the same as `pprof -top`.
+func buildTopTable(p *profile.Profile, sortByCum bool, limit int) *TopResponse {
+	valueIndex := sampleValueIndex(p)
+	stats, total := functionStats(p, valueIndex)
+	rows := make([]TopRow, 0, len(stats))
+	for name, st := range stats {
+		rows = append(rows, TopRow{
+			Function:  name,
+			Flat:      st.Flat,
+			FlatShare: share(st.Flat, total),
+			Cum:       st.Cum,
+			CumShare:  share(st.Cum, total),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		vi, vj := rows[i].Flat, rows[j].Flat
+		if sortByCum {
+			vi, vj = rows[i].Cum, rows[j].Cum
+		}
+		if vi != vj {
+			return vi > vj
+		}
+		return rows[i].Function < rows[j].Function
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return &TopResponse{Unit: p.SampleType[valueIndex].Unit, Total: total, Rows: rows}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testAnalyzeSuite{})
+
+type testAnalyzeSuite struct{}
+
+func (t *testAnalyzeSuite) Test_buildTopTable(c *check.C) {
+	p := newTestProfile(map[string][]string{
+		"a": {"read", "handle", "main"},
+		"b": {"write", "handle", "main"},
+		"c": {"main"},
+		"d": {"handle", "handle", "main"},
+	}, map[string]int64{"a": 30, "b": 20, "c": 40, "d": 10})
+
+	top := buildTopTable(p, false, 0)
+	c.Assert(top.Total, check.Equals, int64(100))
+	c.Assert(top.Unit, check.Equals, "nanoseconds")
+	c.Assert(top.Rows, check.DeepEquals, []TopRow{
+		{Function: "main", Flat: 40, FlatShare: 0.4, Cum: 100, CumShare: 1},
+		{Function: "read", Flat: 30, FlatShare: 0.3, Cum: 30, CumShare: 0.3},
+		{Function: "write", Flat: 20, FlatShare: 0.2, Cum: 20, CumShare: 0.2},
+		{Function: "handle", Flat: 10, FlatShare: 0.1, Cum: 60, CumShare: 0.6},
+	})
+
+	top = buildTopTable(p, true, 2)
+	c.Assert(top.Rows, check.HasLen, 2)
+	c.Assert(top.Rows[0].Function, check.Equals, "main")
+	c.Assert(top.Rows[1].Function, check.Equals, "handle")
+}
+
+func (t *testAnalyzeSuite) Test_convertProfileToSpeedscope(c *check.C) {
+	p := newTestProfile(map[string][]string{
+		"a": {"read", "handle", "main"},
+		"b": {"write", "handle", "main"},
+		"c": {"idle"},
+	}, map[string]int64{"a": 30, "b": 20, "c": 0})
+
+	file := convertProfileToSpeedscope(p, "cpu_tikv")
+	c.Assert(file.Profiles, check.HasLen, 1)
+	prof := file.Profiles[0]
+	c.Assert(prof.Unit, check.Equals, "nanoseconds")
+	c.Assert(prof.EndValue, check.Equals, int64(50))
+	c.Assert(prof.Samples, check.HasLen, 2)
+	c.Assert(prof.Weights, check.HasLen, 2)
+	c.Assert(file.Shared.Frames, check.HasLen, 4)
+	for i, sample := range prof.Samples {
+		c.Assert(sample, check.HasLen, 3)
+		c.Assert(file.Shared.Frames[sample[0]].Name, check.Equals, "main")
+		c.Assert(file.Shared.Frames[sample[1]].Name, check.Equals, "handle")
+		leaf := file.Shared.Frames[sample[2]].Name
+		if leaf == "read" {
+			c.Assert(prof.Weights[i], check.Equals, int64(30))
+		} else {
+			c.Assert(leaf, check.Equals, "write")
+			c.Assert(prof.Weights[i], check.Equals, int64(20))
+		}
+	}
+}
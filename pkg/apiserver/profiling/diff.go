@@ -0,0 +1,177 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+const DefaultDiffTopLimit = 20
+
+// DiffFlameGraphNode is a node of the flame graph of the target profile, with the value of the same stack in the
+// base profile. Stacks only in the base profile are included as well, whose values are 0.
+type DiffFlameGraphNode struct {
+	Name      string                `json:"name"`
+	Value     int64                 `json:"value"`
+	BaseValue int64                 `json:"base_value"`
+	Children  []*DiffFlameGraphNode `json:"children"`
+}
+
+type DiffFlameGraph struct {
+	Unit string              `json:"unit"`
+	Root *DiffFlameGraphNode `json:"root"`
+}
+
+type DiffTopRow struct {
+	Function       string  `json:"function"`
+	Flat           int64   `json:"flat"`
+	BaseFlat       int64   `json:"base_flat"`
+	Cum            int64   `json:"cum"`
+	BaseCum        int64   `json:"base_cum"`
+	FlatShare      float64 `json:"flat_share"`
+	BaseFlatShare  float64 `json:"base_flat_share"`
+	FlatShareDelta float64 `json:"flat_share_delta"`
+	CumShare       float64 `json:"cum_share"`
+	BaseCumShare   float64 `json:"base_cum_share"`
+	CumShareDelta  float64 `json:"cum_share_delta"`
+}
+
+type DiffTopResponse struct {
+	Unit      string       `json:"unit"`
+	Total     int64        `json:"total"`
+	BaseTotal int64        `json:"base_total"`
+	Rows      []DiffTopRow `json:"rows"`
+}
+
+func checkDiffTasks(base, target *TaskModel) error {
+	if base.ProfilingType != target.ProfilingType {
+		return ErrIncomparableTasks.New("cannot compare %s profile with %s profile", base.ProfilingType, target.ProfilingType)
+	}
+	if base.Target.Kind != target.Target.Kind {
+		return ErrIncomparableTasks.New("cannot compare profile of %s with profile of %s", base.Target.Kind, target.Target.Kind)
+	}
+	return nil
+}
+
+// diffValueIndexes returns the indexes of the default sample value in both profiles.
+func diffValueIndexes(base, target *profile.Profile) (int, int, error) {
+	targetIdx := sampleValueIndex(target)
+	for i, st := range base.SampleType {
+		if st.Type == target.SampleType[targetIdx].Type {
+			return i, targetIdx, nil
+		}
+	}
+	return 0, 0, ErrIncomparableTasks.New("sample type %s is not in the base profile", target.SampleType[targetIdx].Type)
+}
+
+// diffProfiles merges the target profile with the negated base profile, the same as `pprof -diff_base`.
+func diffProfiles(base, target *profile.Profile) ([]byte, error) {
+	base = base.Copy()
+	base.SetLabel("pprof::base", []string{"true"})
+	base.Scale(-1)
+	merged, err := profile.Merge([]*profile.Profile{target, base})
+	if err != nil {
+		return nil, ErrIncomparableTasks.Wrap(err, "failed to merge profiles")
+	}
+	var buf bytes.Buffer
+	if err := merged.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func buildDiffFlameGraph(base, target *profile.Profile) (*DiffFlameGraph, error) {
+	baseIdx, targetIdx, err := diffValueIndexes(base, target)
+	if err != nil {
+		return nil, err
+	}
+	root := &DiffFlameGraphNode{Name: "root"}
+	children := make(map[*DiffFlameGraphNode]map[string]*DiffFlameGraphNode)
+	child := func(node *DiffFlameGraphNode, name string) *DiffFlameGraphNode {
+		m, ok := children[node]
+		if !ok {
+			m = make(map[string]*DiffFlameGraphNode)
+			children[node] = m
+		}
+		c, ok := m[name]
+		if !ok {
+			c = &DiffFlameGraphNode{Name: name}
+			m[name] = c
+			node.Children = append(node.Children, c)
+		}
+		return c
+	}
+	add := func(p *profile.Profile, idx int, isBase bool) {
+		for _, s := range p.Sample {
+			v := s.Value[idx]
+			nodes := []*DiffFlameGraphNode{root}
+			for _, name := range sampleFrames(s) {
+				nodes = append(nodes, child(nodes[len(nodes)-1], name))
+			}
+			for _, node := range nodes {
+				if isBase {
+					node.BaseValue += v
+				} else {
+					node.Value += v
+				}
+			}
+		}
+	}
+	add(target, targetIdx, false)
+	add(base, baseIdx, true)
+	return &DiffFlameGraph{Unit: target.SampleType[targetIdx].Unit, Root: root}, nil
+}
+
+// buildDiffTopTable lists the functions whose flat share changed most.
+func buildDiffTopTable(base, target *profile.Profile, limit int) (*DiffTopResponse, error) {
+	baseIdx, targetIdx, err := diffValueIndexes(base, target)
+	if err != nil {
+		return nil, err
+	}
+	baseStats, baseTotal := functionStats(base, baseIdx)
+	targetStats, total := functionStats(target, targetIdx)
+
+	rows := make([]DiffTopRow, 0, len(targetStats))
+	for name, st := range targetStats {
+		row := DiffTopRow{Function: name, Flat: st.Flat, Cum: st.Cum}
+		if bst, ok := baseStats[name]; ok {
+			row.BaseFlat = bst.Flat
+			row.BaseCum = bst.Cum
+		}
+		rows = append(rows, row)
+	}
+	for name, bst := range baseStats {
+		if _, ok := targetStats[name]; !ok {
+			rows = append(rows, DiffTopRow{Function: name, BaseFlat: bst.Flat, BaseCum: bst.Cum})
+		}
+	}
+	for i := range rows {
+		r := &rows[i]
+		r.FlatShare = share(r.Flat, total)
+		r.BaseFlatShare = share(r.BaseFlat, baseTotal)
+		r.FlatShareDelta = r.FlatShare - r.BaseFlatShare
+		r.CumShare = share(r.Cum, total)
+		r.BaseCumShare = share(r.BaseCum, baseTotal)
+		r.CumShareDelta = r.CumShare - r.BaseCumShare
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		di, dj := math.Abs(rows[i].FlatShareDelta), math.Abs(rows[j].FlatShareDelta)
+		if di != dj {
+			return di > dj
+		}
+		return rows[i].Function < rows[j].Function
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return &DiffTopResponse{
+		Unit:      target.SampleType[targetIdx].Unit,
+		Total:     total,
+		BaseTotal: baseTotal,
+		Rows:      rows,
+	}, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	check.TestingT(t)
+}
+
+var _ = check.Suite(&testDiffSuite{})
+
+type testDiffSuite struct{}
+
+// newTestProfile builds a CPU profile from stacks, each of which is listed from the leaf to the root.
+func newTestProfile(samples map[string][]string, values map[string]int64) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     1,
+	}
+	functions := make(map[string]*profile.Function)
+	locations := make(map[string]*profile.Location)
+	for key, stack := range samples {
+		locs := make([]*profile.Location, 0, len(stack))
+		for _, name := range stack {
+			loc, ok := locations[name]
+			if !ok {
+				fn := &profile.Function{ID: uint64(len(functions) + 1), Name: name}
+				functions[name] = fn
+				p.Function = append(p.Function, fn)
+				loc = &profile.Location{ID: uint64(len(locations) + 1), Line: []profile.Line{{Function: fn}}}
+				locations[name] = loc
+				p.Location = append(p.Location, loc)
+			}
+			locs = append(locs, loc)
+		}
+		p.Sample = append(p.Sample, &profile.Sample{Location: locs, Value: []int64{1, values[key]}})
+	}
+	return p
+}
+
+func (t *testDiffSuite) Test_diff(c *check.C) {
+	base := newTestProfile(map[string][]string{
+		"a": {"read", "handle", "main"},
+		"b": {"write", "handle", "main"},
+	}, map[string]int64{"a": 60, "b": 40})
+	target := newTestProfile(map[string][]string{
+		"a": {"read", "handle", "main"},
+		"c": {"compact", "main"},
+	}, map[string]int64{"a": 50, "c": 150})
+
+	top, err := buildDiffTopTable(base, target, 3)
+	c.Assert(err, check.IsNil)
+	c.Assert(top.Total, check.Equals, int64(200))
+	c.Assert(top.BaseTotal, check.Equals, int64(100))
+	c.Assert(top.Rows, check.HasLen, 3)
+	c.Assert(top.Rows[0].Function, check.Equals, "compact")
+	c.Assert(top.Rows[0].FlatShareDelta, check.Equals, 0.75)
+	c.Assert(top.Rows[1].Function, check.Equals, "write")
+	c.Assert(top.Rows[1].Flat, check.Equals, int64(0))
+	c.Assert(top.Rows[1].BaseCum, check.Equals, int64(40))
+	c.Assert(top.Rows[2].Function, check.Equals, "read")
+	c.Assert(top.Rows[2].FlatShareDelta < -0.34 && top.Rows[2].FlatShareDelta > -0.36, check.IsTrue)
+
+	flame, err := buildDiffFlameGraph(base, target)
+	c.Assert(err, check.IsNil)
+	c.Assert(flame.Unit, check.Equals, "nanoseconds")
+	c.Assert(flame.Root.Value, check.Equals, int64(200))
+	c.Assert(flame.Root.BaseValue, check.Equals, int64(100))
+	c.Assert(flame.Root.Children, check.HasLen, 1)
+	main := flame.Root.Children[0]
+	c.Assert(main.Name, check.Equals, "main")
+	c.Assert(main.Children, check.HasLen, 2)
+	for _, child := range main.Children {
+		switch child.Name {
+		case "handle":
+			c.Assert(child.Value, check.Equals, int64(50))
+			c.Assert(child.BaseValue, check.Equals, int64(100))
+			c.Assert(child.Children, check.HasLen, 2)
+		case "compact":
+			c.Assert(child.Value, check.Equals, int64(150))
+			c.Assert(child.BaseValue, check.Equals, int64(0))
+		default:
+			c.Fatalf("unexpected node %s", child.Name)
+		}
+	}
+
+	content, err := diffProfiles(base, target)
+	c.Assert(err, check.IsNil)
+	merged, err := profile.ParseData(content)
+	c.Assert(err, check.IsNil)
+	var total int64
+	for _, s := range merged.Sample {
+		total += s.Value[1]
+	}
+	c.Assert(total, check.Equals, int64(100))
+}
+
+func (t *testDiffSuite) Test_checkDiffTasks(c *check.C) {
+	base := &TaskModel{ProfilingType: ProfilingTypeCPU}
+	base.Target.Kind = "tikv"
+	target := &TaskModel{ProfilingType: ProfilingTypeCPU}
+	target.Target.Kind = "tikv"
+	c.Assert(checkDiffTasks(base, target), check.IsNil)
+	target.ProfilingType = ProfilingTypeHeap
+	c.Assert(checkDiffTasks(base, target), check.NotNil)
+	target.ProfilingType = ProfilingTypeCPU
+	target.Target.Kind = "tidb"
+	c.Assert(checkDiffTasks(base, target), check.NotNil)
+}
@@ -33,6 +33,7 @@ const (
 	RawDataTypeJeprof   TaskRawDataType = "jeprof"
 	RawDataTypeProtobuf TaskRawDataType = "protobuf"
 	RawDataTypeText     TaskRawDataType = "text"
+	RawDataTypeTrace    TaskRawDataType = "trace"
 )
 
 type (
@@ -50,17 +51,28 @@ func (r TaskProfilingTypeList) Value() (driver.Value, error) {
 }
 
 const (
-	ProfilingTypeCPU       TaskProfilingType = "cpu"
-	ProfilingTypeHeap      TaskProfilingType = "heap"
-	ProfilingTypeGoroutine TaskProfilingType = "goroutine"
-	ProfilingTypeMutex     TaskProfilingType = "mutex"
+	ProfilingTypeCPU          TaskProfilingType = "cpu"
+	ProfilingTypeHeap         TaskProfilingType = "heap"
+	ProfilingTypeGoroutine    TaskProfilingType = "goroutine"
+	ProfilingTypeMutex        TaskProfilingType = "mutex"
+	ProfilingTypeBlock        TaskProfilingType = "block"
+	ProfilingTypeAllocs       TaskProfilingType = "allocs"
+	ProfilingTypeThreadCreate TaskProfilingType = "threadcreate"
+	ProfilingTypeTrace        TaskProfilingType = "trace"
 )
 
+// The Go execution trace is large, so it is captured for a limited duration.
+const maxTraceDurationSecs = 10
+
 var profilingTypeMap = map[TaskProfilingType]struct{}{
-	ProfilingTypeCPU:       {},
-	ProfilingTypeHeap:      {},
-	ProfilingTypeGoroutine: {},
-	ProfilingTypeMutex:     {},
+	ProfilingTypeCPU:          {},
+	ProfilingTypeHeap:         {},
+	ProfilingTypeGoroutine:    {},
+	ProfilingTypeMutex:        {},
+	ProfilingTypeBlock:        {},
+	ProfilingTypeAllocs:       {},
+	ProfilingTypeThreadCreate: {},
+	ProfilingTypeTrace:        {},
 }
 
 type TaskModel struct {
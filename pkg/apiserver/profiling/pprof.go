@@ -62,6 +62,14 @@ func (f *fetcher) FetchAndWriteToFile(duration uint, fileNameWithoutExt string,
 		url = "/debug/pprof/mutex?debug=1"
 		profilingRawDataType = RawDataTypeText
 		fileExtenstion = "*.txt"
+	case ProfilingTypeBlock, ProfilingTypeAllocs, ProfilingTypeThreadCreate:
+		url = "/debug/pprof/" + string(profilingType)
+		profilingRawDataType = RawDataTypeProtobuf
+		fileExtenstion = "*.proto"
+	case ProfilingTypeTrace:
+		url = "/debug/pprof/trace?seconds=" + secs
+		profilingRawDataType = RawDataTypeTrace
+		fileExtenstion = "*.trace"
 	}
 
 	tmpfile, err := os.CreateTemp("", fileNameWithoutExt+"_"+fileExtenstion)
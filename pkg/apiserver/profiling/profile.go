@@ -9,6 +9,9 @@ import (
 )
 
 func profileAndWritePprof(_ context.Context, fts *fetchers, target *model.RequestTargetNode, fileNameWithoutExt string, profileDurationSecs uint, profilingType TaskProfilingType) (string, TaskRawDataType, error) {
+	if profilingType == ProfilingTypeTrace && profileDurationSecs > maxTraceDurationSecs {
+		profileDurationSecs = maxTraceDurationSecs
+	}
 	switch target.Kind {
 	case model.NodeKindTiKV:
 		// TiKV only supports CPU/heap Profiling
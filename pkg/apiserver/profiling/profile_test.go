@@ -0,0 +1,57 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"context"
+	"os"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = check.Suite(&testProfileSuite{})
+
+type testProfileSuite struct{}
+
+type testFetcher struct {
+	paths []string
+}
+
+func (f *testFetcher) fetch(op *fetchOptions) ([]byte, error) {
+	f.paths = append(f.paths, op.path)
+	return []byte("data"), nil
+}
+
+func (t *testProfileSuite) Test_profileAndWritePprof(c *check.C) {
+	tidb := &testFetcher{}
+	tikv := &testFetcher{}
+	fts := &fetchers{tidb: tidb, tikv: tikv}
+	tidbTarget := &model.RequestTargetNode{Kind: model.NodeKindTiDB, IP: "127.0.0.1", Port: 10080}
+	tikvTarget := &model.RequestTargetNode{Kind: model.NodeKindTiKV, IP: "127.0.0.1", Port: 20180}
+
+	cases := []struct {
+		profilingType TaskProfilingType
+		path          string
+		rawDataType   TaskRawDataType
+	}{
+		{ProfilingTypeBlock, "/debug/pprof/block", RawDataTypeProtobuf},
+		{ProfilingTypeAllocs, "/debug/pprof/allocs", RawDataTypeProtobuf},
+		{ProfilingTypeThreadCreate, "/debug/pprof/threadcreate", RawDataTypeProtobuf},
+		// trace is bounded by maxTraceDurationSecs
+		{ProfilingTypeTrace, "/debug/pprof/trace?seconds=10", RawDataTypeTrace},
+	}
+	for _, tc := range cases {
+		path, rawDataType, err := profileAndWritePprof(context.Background(), fts, tidbTarget, "test", 30, tc.profilingType)
+		c.Assert(err, check.IsNil)
+		c.Assert(rawDataType, check.Equals, tc.rawDataType)
+		c.Assert(tidb.paths[len(tidb.paths)-1], check.Equals, tc.path)
+		c.Assert(os.Remove(path), check.IsNil)
+
+		_, _, err = profileAndWritePprof(context.Background(), fts, tikvTarget, "test", 30, tc.profilingType)
+		c.Assert(errorx.IsOfType(err, ErrUnsupportedProfilingType), check.IsTrue)
+	}
+	c.Assert(tikv.paths, check.HasLen, 0)
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
@@ -30,11 +31,13 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint.GET("/group/detail/:groupId", auth.MWAuthRequired(), s.getGroupDetail)
 	endpoint.POST("/group/cancel/:groupId", auth.MWAuthRequired(), s.handleCancelGroup)
 	endpoint.DELETE("/group/delete/:groupId", auth.MWAuthRequired(), s.deleteGroup)
+	endpoint.GET("/group/search/:groupId", auth.MWAuthRequired(), s.searchGroup)
 
 	endpoint.GET("/action_token", auth.MWAuthRequired(), s.getActionToken)
 	endpoint.GET("/group/download", s.downloadGroup)
 	endpoint.GET("/single/download", s.downloadSingle)
 	endpoint.GET("/single/view", s.viewSingle)
+	endpoint.GET("/diff", s.viewDiff)
 
 	endpoint.GET("/config", auth.MWAuthRequired(), s.getDynamicConfig)
 	endpoint.PUT("/config", auth.MWAuthRequired(), auth.MWRequireWritePriv(), s.setDynamicConfig)
@@ -144,6 +147,50 @@ func (s *Service) getGroupDetail(c *gin.Context) {
 	})
 }
 
+// @ID searchProfilingGroup
+// @Summary Search functions in the results of a task group
+// @Description Match the functions in the finished protobuf profiles of a task group, and list the share of matched samples of each task
+// @Param groupId path string true "group ID"
+// @Param q query SymbolSearchRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {array} SymbolSearchResult
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /profiling/group/search/{groupId} [get]
+func (s *Service) searchGroup(c *gin.Context) {
+	taskGroupID, err := strconv.Atoi(c.Param("groupId"))
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var req SymbolSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Focus == "" && req.Ignore == "" {
+		rest.Error(c, rest.ErrBadRequest.New("Expect focus or ignore"))
+		return
+	}
+	matcher, err := newSymbolMatcher(&req)
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.Wrap(err, "Invalid regular expression"))
+		return
+	}
+
+	var tasks []TaskModel
+	query := s.params.LocalStore.Where("task_group_id = ? AND state = ?", taskGroupID, TaskStateFinish)
+	if req.ProfilingType != "" {
+		query = query.Where("profiling_type = ?", req.ProfilingType)
+	}
+	if err := query.Find(&tasks).Error; err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, searchTasks(tasks, matcher))
+}
+
 // @ID cancelProfilingGroup
 // @Summary Cancel all tasks with a given group ID
 // @Description Cancel all profling tasks with a given group ID
@@ -180,7 +227,7 @@ func (s *Service) handleCancelGroup(c *gin.Context) {
 // @Router /profiling/action_token [get]
 func (s *Service) getActionToken(c *gin.Context) {
 	id := c.Query("id")
-	action := c.Query("action") // group_download, single_download, single_view
+	action := c.Query("action") // group_download, single_download, single_view, diff_view
 	token, err := utils.NewJWTString("profiling/"+action, id)
 	if err != nil {
 		rest.Error(c, err)
@@ -347,6 +394,9 @@ $ go tool pprof --http=0.0.0.0:1234 cpu_xxx.proto
 
 To review the jemalloc profile data whose file name suffix is '.prof' interactively:
 $ jeprof --web profile_xxx.prof
+
+To review the Go execution trace whose file name suffix is '.trace' interactively:
+$ go tool trace trace_xxx.trace
 `
 	zipFile, err := zw.CreateHeader(&zip.FileHeader{
 		Name:     "README.md",
@@ -370,13 +420,19 @@ const (
 	ViewOutputTypeProtobuf ViewOutputType = "protobuf"
 	ViewOutputTypeGraph    ViewOutputType = "graph"
 	ViewOutputTypeText     ViewOutputType = "text"
+	ViewOutputTypeFlame    ViewOutputType = "flamegraph"
+	ViewOutputTypeTop      ViewOutputType = "top"
 )
 
 // @ID viewProfilingSingle
 // @Summary View the result of a task
-// @Description View the finished profiling result of a task
-// @Produce html
+// @Description View the finished profiling result of a task. Protobuf profiles can also be viewed as a speedscope
+// @Description flame graph or a top table.
+// @Produce html,json
 // @Param token query string true "download token"
+// @Param output_type query string true "protobuf, graph, text, flamegraph or top"
+// @Param sort query string false "sort the top table by flat (default) or cum"
+// @Param limit query int false "number of rows of the top table"
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
@@ -423,6 +479,33 @@ func (s *Service) viewSingle(c *gin.Context) {
 			contentType = "image/svg+xml"
 		case string(ViewOutputTypeProtobuf):
 			contentType = "application/protobuf"
+		case string(ViewOutputTypeFlame):
+			p, err := profile.ParseData(content)
+			if err != nil {
+				rest.Error(c, err)
+				return
+			}
+			name := fmt.Sprintf("%s_%s", task.ProfilingType, task.Target.FileName())
+			c.JSON(http.StatusOK, convertProfileToSpeedscope(p, name))
+			return
+		case string(ViewOutputTypeTop):
+			sortBy := c.DefaultQuery("sort", "flat")
+			if sortBy != "flat" && sortBy != "cum" {
+				rest.Error(c, rest.ErrBadRequest.New("Cannot sort by %s", sortBy))
+				return
+			}
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultTopLimit)))
+			if err != nil {
+				rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+				return
+			}
+			p, err := profile.ParseData(content)
+			if err != nil {
+				rest.Error(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, buildTopTable(p, sortBy == "cum", limit))
+			return
 		default:
 			// Will not handle converting protobuf to other formats except flamegraph and graph
 			rest.Error(c, rest.ErrBadRequest.New("Cannot output protobuf as %s", outputType))
@@ -462,6 +545,10 @@ func (s *Service) viewSingle(c *gin.Context) {
 			rest.Error(c, rest.ErrBadRequest.New("Cannot output jeprof raw data as %s", outputType))
 			return
 		}
+	} else if task.RawDataType == RawDataTypeTrace {
+		// Go execution trace can only be viewed by `go tool trace` after downloading
+		rest.Error(c, rest.ErrBadRequest.New("Cannot output trace as %s", outputType))
+		return
 	} else if task.RawDataType == RawDataTypeText {
 		switch outputType {
 		case string(ViewOutputTypeText):
@@ -475,6 +562,94 @@ func (s *Service) viewSingle(c *gin.Context) {
 	c.Data(http.StatusOK, contentType, content)
 }
 
+// @ID viewProfilingDiff
+// @Summary Compare the results of two tasks
+// @Description Compare the protobuf profiles of two finished tasks of the same profiling type and component, the same as `pprof -diff_base`.
+// @Description The token is acquired with the action `diff_view` and the ID `<base task ID>,<target task ID>`.
+// @Produce html,json
+// @Param token query string true "view token"
+// @Param output_type query string true "graph, flamegraph or top"
+// @Param limit query int false "number of rows of the top table"
+// @Security JwtAuth
+// @Success 200 {object} DiffTopResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /profiling/diff [get]
+func (s *Service) viewDiff(c *gin.Context) {
+	token := c.Query("token")
+	outputType := c.Query("output_type")
+	str, err := utils.ParseJWTString("profiling/diff_view", token)
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	ids := strings.Split(str, ",")
+	if len(ids) != 2 {
+		rest.Error(c, rest.ErrBadRequest.New("Expect 2 tasks"))
+		return
+	}
+	tasks := make([]TaskModel, 2)
+	for i, id := range ids {
+		err = s.params.LocalStore.Where("id = ? AND state = ?", id, TaskStateFinish).First(&tasks[i]).Error
+		if err != nil {
+			rest.Error(c, err)
+			return
+		}
+	}
+	base, target := &tasks[0], &tasks[1]
+	if err := checkDiffTasks(base, target); err != nil {
+		rest.Error(c, err)
+		return
+	}
+	baseProfile, err := loadProtobufProfile(base)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	targetProfile, err := loadProtobufProfile(target)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+
+	switch outputType {
+	case string(ViewOutputTypeGraph):
+		diffContent, err := diffProfiles(baseProfile, targetProfile)
+		if err != nil {
+			rest.Error(c, err)
+			return
+		}
+		svgContent, err := convertProtobufToSVG(diffContent, *target)
+		if err != nil {
+			rest.Error(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svgContent)
+	case string(ViewOutputTypeFlame):
+		flameGraph, err := buildDiffFlameGraph(baseProfile, targetProfile)
+		if err != nil {
+			rest.Error(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, flameGraph)
+	case string(ViewOutputTypeTop):
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultDiffTopLimit)))
+		if err != nil {
+			rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+			return
+		}
+		top, err := buildDiffTopTable(baseProfile, targetProfile, limit)
+		if err != nil {
+			rest.Error(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, top)
+	default:
+		rest.Error(c, rest.ErrBadRequest.New("Cannot output diff as %s", outputType))
+	}
+}
+
 // @ID deleteProfilingGroup
 // @Summary Delete all tasks with a given group ID
 // @Description Delete all finished profiling tasks with a given group ID
@@ -543,5 +718,10 @@ func (s *Service) setDynamicConfig(c *gin.Context) {
 		rest.Error(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, req)
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.Profiling)
 }
@@ -0,0 +1,146 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+const maxSymbolSearchFunctions = 10
+
+type SymbolSearchRequest struct {
+	// Samples are matched when any function in the stack matches Focus, and no function matches Ignore.
+	Focus         string            `json:"focus" form:"focus"`
+	Ignore        string            `json:"ignore" form:"ignore"`
+	ProfilingType TaskProfilingType `json:"profiling_type" form:"profiling_type"`
+}
+
+type MatchedFunction struct {
+	Function string  `json:"function"`
+	Cum      int64   `json:"cum"`
+	CumShare float64 `json:"cum_share"`
+}
+
+type SymbolSearchResult struct {
+	TaskID        uint                    `json:"task_id"`
+	Target        model.RequestTargetNode `json:"target"`
+	ProfilingType TaskProfilingType       `json:"profiling_type"`
+	Unit          string                  `json:"unit"`
+	Total         int64                   `json:"total"`
+	Matched       int64                   `json:"matched"`
+	Share         float64                 `json:"share"`
+	// The matched functions with the largest cumulative values in the matched samples.
+	Functions []MatchedFunction `json:"functions"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type symbolMatcher struct {
+	focus  *regexp.Regexp
+	ignore *regexp.Regexp
+}
+
+func newSymbolMatcher(req *SymbolSearchRequest) (*symbolMatcher, error) {
+	m := &symbolMatcher{}
+	var err error
+	if req.Focus != "" {
+		if m.focus, err = regexp.Compile(req.Focus); err != nil {
+			return nil, err
+		}
+	}
+	if req.Ignore != "" {
+		if m.ignore, err = regexp.Compile(req.Ignore); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// matchFrames returns the frames matching the focus if the sample is matched, or nil otherwise. All frames are
+// returned if there is no focus.
+func (m *symbolMatcher) matchFrames(frames []string) []string {
+	matched := make([]string, 0)
+	for _, f := range frames {
+		if m.ignore != nil && m.ignore.MatchString(f) {
+			return nil
+		}
+		if m.focus == nil || m.focus.MatchString(f) {
+			matched = append(matched, f)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return matched
+}
+
+// searchProfile sums up the samples matched in the profile, and the cumulative values of the matched functions.
+func searchProfile(p *profile.Profile, m *symbolMatcher, result *SymbolSearchResult) {
+	valueIndex := sampleValueIndex(p)
+	result.Unit = p.SampleType[valueIndex].Unit
+	cums := make(map[string]int64)
+	for _, s := range p.Sample {
+		v := s.Value[valueIndex]
+		result.Total += v
+		matched := m.matchFrames(sampleFrames(s))
+		if matched == nil {
+			continue
+		}
+		result.Matched += v
+		seen := make(map[string]struct{}, len(matched))
+		for _, f := range matched {
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = struct{}{}
+			cums[f] += v
+		}
+	}
+	result.Share = share(result.Matched, result.Total)
+
+	result.Functions = make([]MatchedFunction, 0, len(cums))
+	for f, cum := range cums {
+		result.Functions = append(result.Functions, MatchedFunction{Function: f, Cum: cum, CumShare: share(cum, result.Total)})
+	}
+	sort.Slice(result.Functions, func(i, j int) bool {
+		if result.Functions[i].Cum != result.Functions[j].Cum {
+			return result.Functions[i].Cum > result.Functions[j].Cum
+		}
+		return result.Functions[i].Function < result.Functions[j].Function
+	})
+	if len(result.Functions) > maxSymbolSearchFunctions {
+		result.Functions = result.Functions[:maxSymbolSearchFunctions]
+	}
+}
+
+// searchTasks searches the profiles of the tasks, and sorts the results by the matched share. Tasks whose profiles
+// cannot be parsed are listed at the end with the error.
+func searchTasks(tasks []TaskModel, m *symbolMatcher) []SymbolSearchResult {
+	results := make([]SymbolSearchResult, 0, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		result := SymbolSearchResult{
+			TaskID:        task.ID,
+			Target:        task.Target,
+			ProfilingType: task.ProfilingType,
+		}
+		p, err := loadProtobufProfile(task)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			searchProfile(p, m, &result)
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Error == "") != (results[j].Error == "") {
+			return results[i].Error == ""
+		}
+		return results[i].Share > results[j].Share
+	})
+	return results
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testSearchSuite{})
+
+type testSearchSuite struct{}
+
+func (t *testSearchSuite) Test_searchTasks(c *check.C) {
+	dir := c.MkDir()
+	writeProfile := func(name string, apply int64) string {
+		p := newTestProfile(map[string][]string{
+			"a": {"raftstore::store::fsm::apply::handle", "raftstore::store::fsm::apply::poll", "main"},
+			"b": {"grpc::poll", "main"},
+			"c": {"raftstore::store::fsm::apply::flush", "std::sys::fsync", "main"},
+		}, map[string]int64{"a": apply, "b": 100, "c": 10})
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		c.Assert(err, check.IsNil)
+		c.Assert(p.Write(f), check.IsNil)
+		c.Assert(f.Close(), check.IsNil)
+		return path
+	}
+	tasks := []TaskModel{
+		{ID: 1, RawDataType: RawDataTypeProtobuf, FilePath: writeProfile("1.proto", 50)},
+		{ID: 2, RawDataType: RawDataTypeJeprof},
+		{ID: 3, RawDataType: RawDataTypeProtobuf, FilePath: writeProfile("3.proto", 290)},
+	}
+
+	matcher, err := newSymbolMatcher(&SymbolSearchRequest{Focus: `raftstore::store::fsm::apply`, Ignore: `fsync`})
+	c.Assert(err, check.IsNil)
+	results := searchTasks(tasks, matcher)
+	c.Assert(results, check.HasLen, 3)
+
+	c.Assert(results[0].TaskID, check.Equals, uint(3))
+	c.Assert(results[0].Total, check.Equals, int64(400))
+	c.Assert(results[0].Matched, check.Equals, int64(290))
+	c.Assert(results[0].Functions, check.HasLen, 2)
+	c.Assert(results[0].Functions[0].Cum, check.Equals, int64(290))
+
+	c.Assert(results[1].TaskID, check.Equals, uint(1))
+	c.Assert(results[1].Share, check.Equals, 0.3125)
+
+	c.Assert(results[2].TaskID, check.Equals, uint(2))
+	c.Assert(results[2].Error, check.Not(check.Equals), "")
+
+	_, err = newSymbolMatcher(&SymbolSearchRequest{Focus: "("})
+	c.Assert(err, check.NotNil)
+}
@@ -13,6 +13,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
@@ -30,6 +31,8 @@ var (
 	ErrTimeout                    = ErrNS.NewType("timeout")
 	ErrUnsupportedProfilingType   = ErrNS.NewType("unsupported_profiling_type")
 	ErrUnsupportedProfilingTarget = ErrNS.NewType("unsupported_profiling_target")
+	ErrUnsupportedRawDataType     = ErrNS.NewType("unsupported_raw_data_type")
+	ErrIncomparableTasks          = ErrNS.NewType("incomparable_tasks")
 )
 
 type StartRequest struct {
@@ -53,6 +56,8 @@ type ServiceParams struct {
 	HTTPClient *httpc.Client
 	EtcdClient *clientv3.Client
 	PDClient   *pd.Client
+
+	Metrics *metrics.Service
 }
 
 type Service struct {
@@ -61,6 +66,7 @@ type Service struct {
 
 	wg            sync.WaitGroup
 	sessionCh     chan *StartRequestSession
+	triggerCh     chan *triggeredRequest
 	lastTaskGroup *TaskGroup
 	tasks         sync.Map
 	fetchers      *fetchers
@@ -70,15 +76,19 @@ var newService = fx.Provide(func(lc fx.Lifecycle, p ServiceParams, fts *fetchers
 	if err := autoMigrate(p.LocalStore); err != nil {
 		return nil, err
 	}
-	s := &Service{params: p, fetchers: fts}
+	s := &Service{params: p, fetchers: fts, triggerCh: make(chan *triggeredRequest)}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			s.lifecycleCtx = ctx
-			s.wg.Add(1)
+			s.wg.Add(2)
 			go func() {
 				defer s.wg.Done()
 				s.serviceLoop(ctx)
 			}()
+			go func() {
+				defer s.wg.Done()
+				s.triggerLoop(ctx)
+			}()
 			return nil
 		},
 		OnStop: func(context.Context) error {
@@ -126,6 +136,8 @@ func (s *Service) serviceLoop(ctx context.Context) {
 			if req := newAutoRequest(); req != nil {
 				_, _ = s.exclusiveExecute(ctx, req)
 			}
+		case t := <-s.triggerCh:
+			s.handleTrigger(ctx, t)
 		case session := <-s.sessionCh:
 			s.handleRequest(ctx, session, dc)
 		}
@@ -142,6 +154,23 @@ func (s *Service) handleRequest(ctx context.Context, session *StartRequestSessio
 	session.taskGroup, session.err = s.exclusiveExecute(ctx, &session.req)
 }
 
+// handleTrigger starts profiling for a fired trigger rule. Unlike other requests, it is skipped when any profiling
+// is running, so that a trigger never cancels the profiling started by users, the automatic collection or other rules.
+func (s *Service) handleTrigger(ctx context.Context, t *triggeredRequest) {
+	running := false
+	s.tasks.Range(func(_, _ interface{}) bool {
+		running = true
+		return false
+	})
+	if running {
+		log.Info("Triggered profiling is skipped since profiling is running", zap.String("rule", t.rule))
+		return
+	}
+	if _, err := s.startGroup(ctx, t.req); err != nil {
+		log.Warn("Failed to start triggered profiling", zap.String("rule", t.rule), zap.Error(err))
+	}
+}
+
 func (s *Service) exclusiveExecute(ctx context.Context, req *StartRequest) (*TaskGroup, error) {
 	if s.lastTaskGroup != nil {
 		if err := s.cancelGroup(s.lastTaskGroup.ID); err != nil {
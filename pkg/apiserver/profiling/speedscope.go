@@ -0,0 +1,90 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"github.com/google/pprof/profile"
+)
+
+const speedscopeSchema = "https://www.speedscope.app/file-format-schema.json"
+
+// SpeedscopeFile is a flame graph in the speedscope file format, see the schema at
+// https://www.speedscope.app/file-format-schema.json.
+type SpeedscopeFile struct {
+	Schema             string              `json:"$schema"`
+	Shared             SpeedscopeShared    `json:"shared"`
+	Profiles           []SpeedscopeProfile `json:"profiles"`
+	Name               string              `json:"name"`
+	ActiveProfileIndex int                 `json:"activeProfileIndex"`
+	Exporter           string              `json:"exporter"`
+}
+
+type SpeedscopeShared struct {
+	Frames []SpeedscopeFrame `json:"frames"`
+}
+
+type SpeedscopeFrame struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+}
+
+// SpeedscopeProfile is a sampled profile, each sample is a stack of frame indexes from the root to the leaf.
+type SpeedscopeProfile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+func speedscopeUnit(unit string) string {
+	switch unit {
+	case "nanoseconds", "microseconds", "milliseconds", "seconds", "bytes":
+		return unit
+	default:
+		return "none"
+	}
+}
+
+// convertProfileToSpeedscope converts the default sample value of the profile to a speedscope flame graph.
+func convertProfileToSpeedscope(p *profile.Profile, name string) *SpeedscopeFile {
+	valueIndex := sampleValueIndex(p)
+	frames := make([]SpeedscopeFrame, 0)
+	frameIndex := make(map[string]int)
+	prof := SpeedscopeProfile{
+		Type:    "sampled",
+		Name:    name,
+		Unit:    speedscopeUnit(p.SampleType[valueIndex].Unit),
+		Samples: make([][]int, 0, len(p.Sample)),
+		Weights: make([]int64, 0, len(p.Sample)),
+	}
+	for _, s := range p.Sample {
+		v := s.Value[valueIndex]
+		if v == 0 {
+			continue
+		}
+		stack := sampleFrames(s)
+		sample := make([]int, 0, len(stack))
+		for _, f := range stack {
+			idx, ok := frameIndex[f]
+			if !ok {
+				idx = len(frames)
+				frameIndex[f] = idx
+				frames = append(frames, SpeedscopeFrame{Name: f})
+			}
+			sample = append(sample, idx)
+		}
+		prof.Samples = append(prof.Samples, sample)
+		prof.Weights = append(prof.Weights, v)
+		prof.EndValue += v
+	}
+	return &SpeedscopeFile{
+		Schema:   speedscopeSchema,
+		Shared:   SpeedscopeShared{Frames: frames},
+		Profiles: []SpeedscopeProfile{prof},
+		Name:     name,
+		Exporter: "tidb-dashboard",
+	}
+}
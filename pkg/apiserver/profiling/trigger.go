@@ -0,0 +1,198 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+const (
+	triggerEvaluateInterval = 15 * time.Second
+	triggerQueryTimeout     = 10 * time.Second
+	triggerInstanceLabel    = "instance"
+)
+
+type triggerRuleState struct {
+	// The time when each instance starts exceeding the threshold.
+	breachingSince map[string]time.Time
+	lastFiredAt    time.Time
+}
+
+// triggerWatcher keeps how long the instances exceed the thresholds of the rules between evaluations.
+type triggerWatcher struct {
+	states map[string]*triggerRuleState
+}
+
+func newTriggerWatcher() *triggerWatcher {
+	return &triggerWatcher{states: make(map[string]*triggerRuleState)}
+}
+
+func parseTriggerTarget(kind model.NodeKind, instance string) (model.RequestTargetNode, bool) {
+	host, portStr, err := net.SplitHostPort(instance)
+	if err != nil {
+		return model.RequestTargetNode{}, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return model.RequestTargetNode{}, false
+	}
+	return model.RequestTargetNode{Kind: kind, DisplayName: instance, IP: host, Port: port}, true
+}
+
+// evaluate returns the instances to profile, which have exceeded the threshold of the rule for ForSecs seconds.
+// Nothing is returned within the cooldown after the rule is fired.
+func (w *triggerWatcher) evaluate(rule *config.ProfilingTriggerRule, samples []metrics.PromSample, now time.Time) []model.RequestTargetNode {
+	st, ok := w.states[rule.Name]
+	if !ok {
+		st = &triggerRuleState{breachingSince: make(map[string]time.Time)}
+		w.states[rule.Name] = st
+	}
+
+	breaching := make(map[string]struct{}, len(samples))
+	for _, sample := range samples {
+		instance := sample.Labels[triggerInstanceLabel]
+		if instance == "" || !(sample.Value > rule.Threshold) {
+			continue
+		}
+		breaching[instance] = struct{}{}
+		if _, ok := st.breachingSince[instance]; !ok {
+			st.breachingSince[instance] = now
+		}
+	}
+	for instance := range st.breachingSince {
+		if _, ok := breaching[instance]; !ok {
+			delete(st.breachingSince, instance)
+		}
+	}
+
+	if !st.lastFiredAt.IsZero() && now.Sub(st.lastFiredAt) < time.Duration(rule.CooldownSecs)*time.Second {
+		return nil
+	}
+	targets := make([]model.RequestTargetNode, 0)
+	for instance, since := range st.breachingSince {
+		if now.Sub(since) < time.Duration(rule.ForSecs)*time.Second {
+			continue
+		}
+		target, ok := parseTriggerTarget(rule.Kind, instance)
+		if !ok {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].DisplayName < targets[j].DisplayName
+	})
+	st.lastFiredAt = now
+	// The instances need to exceed the threshold for ForSecs seconds again to be profiled next time.
+	st.breachingSince = make(map[string]time.Time)
+	return targets
+}
+
+// prune drops the states of the rules which are removed from the config.
+func (w *triggerWatcher) prune(rules []config.ProfilingTriggerRule) {
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		names[r.Name] = struct{}{}
+	}
+	for name := range w.states {
+		if _, ok := names[name]; !ok {
+			delete(w.states, name)
+		}
+	}
+}
+
+func newTriggerRequest(rule *config.ProfilingTriggerRule, targets []model.RequestTargetNode) *StartRequest {
+	types := make(TaskProfilingTypeList, 0, len(rule.ProfilingTypes))
+	for _, t := range rule.ProfilingTypes {
+		types = append(types, TaskProfilingType(t))
+	}
+	if len(types) == 0 {
+		types = append(types, ProfilingTypeCPU)
+	}
+	return &StartRequest{
+		Targets:                targets,
+		DurationSecs:           rule.DurationSecs,
+		RequstedProfilingTypes: types,
+	}
+}
+
+// triggeredRequest is the profiling request of a fired trigger rule.
+type triggeredRequest struct {
+	rule string
+	req  *StartRequest
+}
+
+// triggerLoop evaluates the trigger rules out of the service loop, since querying the metrics may take a while.
+// Only the requests of the fired rules are sent to the service loop.
+func (s *Service) triggerLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+	var rules []config.ProfilingTriggerRule
+	var timeCh <-chan time.Time = make(chan time.Time, 1)
+	w := newTriggerWatcher()
+
+	evaluateTriggers := func() {
+		if len(rules) == 0 {
+			timeCh = make(chan time.Time, 1)
+			w = newTriggerWatcher()
+			return
+		}
+		timeCh = time.After(triggerEvaluateInterval)
+		s.evaluateTriggers(ctx, rules, w)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			rules = dc.Profiling.TriggerRules
+			evaluateTriggers()
+		case <-timeCh:
+			evaluateTriggers()
+		}
+	}
+}
+
+// evaluateTriggers queries the metrics of the trigger rules, and sends the requests to profile the instances
+// exceeding the thresholds to the service loop.
+func (s *Service) evaluateTriggers(ctx context.Context, rules []config.ProfilingTriggerRule, w *triggerWatcher) {
+	w.prune(rules)
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		queryCtx, cancel := context.WithTimeout(ctx, triggerQueryTimeout)
+		samples, err := s.params.Metrics.QueryInstant(queryCtx, rule.Expr, now)
+		cancel()
+		if err != nil {
+			log.Warn("Failed to evaluate profiling trigger rule", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		}
+		targets := w.evaluate(rule, samples, now)
+		if len(targets) == 0 {
+			continue
+		}
+		log.Info("Profiling is triggered", zap.String("rule", rule.Name), zap.Int("targets", len(targets)))
+		select {
+		case s.triggerCh <- &triggeredRequest{rule: rule.Name, req: newTriggerRequest(rule, targets)}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package profiling
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/pingcap/check"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+var _ = check.Suite(&testTriggerSuite{})
+
+type testTriggerSuite struct{}
+
+func triggerSamples(values map[string]float64) []metrics.PromSample {
+	samples := make([]metrics.PromSample, 0, len(values))
+	for instance, v := range values {
+		samples = append(samples, metrics.PromSample{Labels: map[string]string{"instance": instance}, Value: v})
+	}
+	return samples
+}
+
+func (t *testTriggerSuite) Test_evaluate(c *check.C) {
+	w := newTriggerWatcher()
+	rule := &config.ProfilingTriggerRule{Name: "r", Kind: model.NodeKindTiDB, Threshold: 0.8, ForSecs: 30, CooldownSecs: 600}
+	now := time.Unix(1000, 0)
+
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:10080": 0.9, "10.0.0.2:10080": 0.5}), now), check.IsNil)
+	// 10.0.0.2 starts exceeding later, and 10.0.0.1 is not long enough
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:10080": 0.95, "10.0.0.2:10080": 0.9}), now.Add(15*time.Second)), check.IsNil)
+
+	targets := w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:10080": 0.95, "10.0.0.2:10080": 0.9}), now.Add(30*time.Second))
+	c.Assert(targets, check.DeepEquals, []model.RequestTargetNode{
+		{Kind: model.NodeKindTiDB, DisplayName: "10.0.0.1:10080", IP: "10.0.0.1", Port: 10080},
+	})
+
+	// within the cooldown
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:10080": 0.95, "10.0.0.2:10080": 0.9}), now.Add(5*time.Minute)), check.IsNil)
+
+	targets = w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:10080": 0.95, "10.0.0.2:10080": 0.9}), now.Add(11*time.Minute))
+	c.Assert(targets, check.HasLen, 2)
+	c.Assert(targets[1].DisplayName, check.Equals, "10.0.0.2:10080")
+}
+
+func (t *testTriggerSuite) Test_evaluateRecovered(c *check.C) {
+	w := newTriggerWatcher()
+	rule := &config.ProfilingTriggerRule{Name: "r", Kind: model.NodeKindTiKV, Threshold: 0.8, ForSecs: 30, CooldownSecs: 600}
+	now := time.Unix(1000, 0)
+
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:20180": 0.9}), now), check.IsNil)
+	// the breach is interrupted, so it starts over
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:20180": 0.1}), now.Add(15*time.Second)), check.IsNil)
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:20180": 0.9}), now.Add(30*time.Second)), check.IsNil)
+	c.Assert(w.evaluate(rule, triggerSamples(map[string]float64{"10.0.0.1:20180": 0.9}), now.Add(60*time.Second)), check.HasLen, 1)
+}
+
+func (t *testTriggerSuite) Test_prune(c *check.C) {
+	w := newTriggerWatcher()
+	rule := &config.ProfilingTriggerRule{Name: "r", Kind: model.NodeKindPD, Threshold: 1}
+	w.evaluate(rule, nil, time.Now())
+	w.prune([]config.ProfilingTriggerRule{*rule})
+	c.Assert(w.states, check.HasLen, 1)
+	w.prune(nil)
+	c.Assert(w.states, check.HasLen, 0)
+}
+
+func (t *testTriggerSuite) Test_newTriggerRequest(c *check.C) {
+	rule := &config.ProfilingTriggerRule{Name: "r", Kind: model.NodeKindPD, DurationSecs: 10}
+	req := newTriggerRequest(rule, nil)
+	c.Assert(req.RequstedProfilingTypes, check.DeepEquals, TaskProfilingTypeList{ProfilingTypeCPU})
+	c.Assert(req.DurationSecs, check.Equals, uint(10))
+
+	rule.ProfilingTypes = []string{"cpu", "goroutine"}
+	req = newTriggerRequest(rule, nil)
+	c.Assert(req.RequstedProfilingTypes, check.DeepEquals, TaskProfilingTypeList{ProfilingTypeCPU, ProfilingTypeGoroutine})
+}
+
+func (t *testTriggerSuite) Test_triggerTypes(c *check.C) {
+	// The profiling types allowed by the config must be known by the profiling service.
+	for _, typ := range config.ProfilingTriggerTypes {
+		_, ok := profilingTypeMap[TaskProfilingType(typ)]
+		c.Assert(ok, check.IsTrue, check.Commentf("%s", typ))
+	}
+	c.Assert(config.ProfilingTriggerTypes, check.HasLen, len(profilingTypeMap))
+}
+
+func (t *testTriggerSuite) Test_handleTrigger(c *check.C) {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")))
+	c.Assert(err, check.IsNil)
+	db := &dbstore.DB{DB: gormDB}
+	c.Assert(autoMigrate(db), check.IsNil)
+	s := &Service{params: ServiceParams{LocalStore: db}}
+
+	// a manual profiling is running
+	target := model.RequestTargetNode{Kind: model.NodeKindTiDB, DisplayName: "10.0.0.1:10080", IP: "10.0.0.1", Port: 10080}
+	manualGroup := NewTaskGroup(db, 30, model.NewRequestTargetStatisticsFromArray(&[]model.RequestTargetNode{target}), TaskProfilingTypeList{ProfilingTypeCPU})
+	c.Assert(db.Create(manualGroup.TaskGroupModel).Error, check.IsNil)
+	manualTask := NewTask(context.Background(), manualGroup, target, nil, ProfilingTypeCPU)
+	c.Assert(db.Create(manualTask.TaskModel).Error, check.IsNil)
+	s.tasks.Store(manualTask.ID, manualTask)
+
+	triggered := &triggeredRequest{rule: "r", req: newTriggerRequest(&config.ProfilingTriggerRule{DurationSecs: 10}, nil)}
+	s.handleTrigger(context.Background(), triggered)
+	var groups []TaskGroupModel
+	c.Assert(db.Find(&groups).Error, check.IsNil)
+	c.Assert(groups, check.HasLen, 1)
+	c.Assert(manualTask.ctx.Err(), check.IsNil)
+
+	// the trigger starts profiling when nothing is running
+	s.tasks.Delete(manualTask.ID)
+	s.handleTrigger(context.Background(), triggered)
+	s.wg.Wait()
+	c.Assert(db.Find(&groups).Error, check.IsNil)
+	c.Assert(groups, check.HasLen, 2)
+	c.Assert(groups[1].ProfileDurationSecs, check.Equals, uint(10))
+}
@@ -0,0 +1,296 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+// The rolling baseline is not used until there are enough samples.
+const minBaselineSamples = 3
+
+type AlertStatus string
+
+const (
+	AlertStatusFiring   AlertStatus = "firing"
+	AlertStatusResolved AlertStatus = "resolved"
+)
+
+type Alert struct {
+	Rule     string      `json:"rule"`
+	Type     string      `json:"type"`
+	Digest   string      `json:"digest,omitempty"`
+	Status   AlertStatus `json:"status"`
+	Value    float64     `json:"value"`
+	Baseline float64     `json:"baseline"`
+	Reason   string      `json:"reason"`
+	// unix timestamp in seconds
+	StartsAt int64 `json:"starts_at"`
+	EndsAt   int64 `json:"ends_at,omitempty"`
+
+	// repeated is set when the rule was already firing in the previous poll.
+	repeated bool
+}
+
+type alertRuleState struct {
+	samples  []float64
+	firingAt int64
+}
+
+// alertWatcher keeps the rolling baselines and firing states of the rules between polls.
+type alertWatcher struct {
+	lastPollTime time.Time
+	states       map[string]*alertRuleState
+}
+
+func newAlertWatcher() *alertWatcher {
+	return &alertWatcher{states: make(map[string]*alertRuleState)}
+}
+
+func (st *alertRuleState) baseline() (float64, bool) {
+	if len(st.samples) < minBaselineSamples {
+		return 0, false
+	}
+	sum := 0.0
+	for _, v := range st.samples {
+		sum += v
+	}
+	return sum / float64(len(st.samples)), true
+}
+
+// evaluate checks the value of a rule against its threshold and rolling baseline. A firing alert is returned in
+// every poll while the rule is firing, and the ones after the first poll are marked as repeated, so that webhooks
+// which do not expect repeated notifications are not flooded by a lasting anomaly.
+func (w *alertWatcher) evaluate(rule *config.SlowQueryAlertRule, value float64, now time.Time) *Alert {
+	st, ok := w.states[rule.Name]
+	if !ok {
+		st = &alertRuleState{}
+		w.states[rule.Name] = st
+	}
+
+	baseline, hasBaseline := st.baseline()
+	reason := ""
+	if rule.Threshold > 0 && value >= rule.Threshold {
+		reason = fmt.Sprintf("value %.2f reaches the threshold %.2f", value, rule.Threshold)
+	} else if rule.BaselineDeviation > 0 && hasBaseline && baseline > 0 && value >= baseline*rule.BaselineDeviation {
+		reason = fmt.Sprintf("value %.2f deviates from the baseline %.2f by %.2fx", value, baseline, value/baseline)
+	}
+
+	st.samples = append(st.samples, value)
+	windows := int(rule.BaselineWindows)
+	if windows == 0 {
+		windows = config.DefaultSlowQueryAlertBaselineWindows
+	}
+	if len(st.samples) > windows {
+		st.samples = st.samples[len(st.samples)-windows:]
+	}
+
+	alert := &Alert{
+		Rule:     rule.Name,
+		Type:     rule.Type,
+		Digest:   rule.Digest,
+		Value:    value,
+		Baseline: baseline,
+		Reason:   reason,
+	}
+	switch {
+	case reason != "":
+		alert.repeated = st.firingAt != 0
+		if !alert.repeated {
+			st.firingAt = now.Unix()
+		}
+		alert.Status = AlertStatusFiring
+		alert.StartsAt = st.firingAt
+		return alert
+	case reason == "" && st.firingAt != 0:
+		alert.Status = AlertStatusResolved
+		alert.Reason = "value is back to normal"
+		alert.StartsAt = st.firingAt
+		alert.EndsAt = now.Unix()
+		st.firingAt = 0
+		return alert
+	}
+	return nil
+}
+
+// resolveNoData resolves the firing rule when there is no data to evaluate it, e.g. the digest is no longer
+// executed slowly. The baseline is not changed.
+func (w *alertWatcher) resolveNoData(rule *config.SlowQueryAlertRule, now time.Time) *Alert {
+	st, ok := w.states[rule.Name]
+	if !ok || st.firingAt == 0 {
+		return nil
+	}
+	baseline, _ := st.baseline()
+	alert := &Alert{
+		Rule:     rule.Name,
+		Type:     rule.Type,
+		Digest:   rule.Digest,
+		Status:   AlertStatusResolved,
+		Baseline: baseline,
+		Reason:   "no data in the window",
+		StartsAt: st.firingAt,
+		EndsAt:   now.Unix(),
+	}
+	st.firingAt = 0
+	return alert
+}
+
+// prune drops the states of the rules which are removed from the config.
+func (w *alertWatcher) prune(rules []config.SlowQueryAlertRule) {
+	names := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		names[r.Name] = struct{}{}
+	}
+	for name := range w.states {
+		if _, ok := names[name]; !ok {
+			delete(w.states, name)
+		}
+	}
+}
+
+func (s *Service) alertLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+
+	var cfg config.SlowQueryAlertConfig
+	var timeCh <-chan time.Time = make(chan time.Time, 1)
+	w := newAlertWatcher()
+
+	poll := func() {
+		if !cfg.Enabled || len(cfg.Rules) == 0 {
+			timeCh = make(chan time.Time, 1)
+			w = newAlertWatcher()
+			return
+		}
+		timeCh = time.After(time.Duration(cfg.IntervalSecs) * time.Second)
+		w.prune(cfg.Rules)
+		if err := s.pollSlowQueryAlerts(ctx, &cfg, w); err != nil {
+			log.Warn("Failed to poll slow query alerts", zap.Error(err))
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			cfg = dc.SlowQueryAlert
+			poll()
+		case <-timeCh:
+			poll()
+		}
+	}
+}
+
+func (s *Service) pollSlowQueryAlerts(ctx context.Context, cfg *config.SlowQueryAlertConfig, w *alertWatcher) error {
+	now := time.Now()
+	begin := w.lastPollTime
+	if begin.IsZero() {
+		begin = now.Add(-time.Duration(cfg.IntervalSecs) * time.Second)
+	}
+
+	// There is no user session in background, so that the SQL user authorized for SSO impersonation is used.
+	db, err := s.params.SSOService.OpenImpersonatedSQLConn()
+	if err != nil {
+		return err
+	}
+	defer utils.CloseTiDBConnection(db) //nolint:errcheck
+
+	alerts := w.evaluateRules(cfg.Rules, now, func(rule *config.SlowQueryAlertRule) (float64, bool, error) {
+		return queryAlertRuleValue(db, rule, begin, now)
+	})
+
+	for _, webhook := range cfg.Webhooks {
+		webhookAlerts := filterWebhookAlerts(webhook.Format, alerts)
+		if len(webhookAlerts) == 0 {
+			continue
+		}
+		if err := sendAlerts(ctx, webhook, webhookAlerts); err != nil {
+			log.Warn("Failed to send slow query alerts", zap.String("url", webhook.URL), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// evaluateRules evaluates all rules in a poll. A rule failed to be queried is skipped without changing its state,
+// so that the other rules are still evaluated and the window of the poll is not counted again in the next poll.
+func (w *alertWatcher) evaluateRules(
+	rules []config.SlowQueryAlertRule,
+	now time.Time,
+	query func(rule *config.SlowQueryAlertRule) (float64, bool, error),
+) []Alert {
+	alerts := make([]Alert, 0)
+	for i := range rules {
+		rule := &rules[i]
+		value, ok, err := query(rule)
+		if err != nil {
+			log.Warn("Failed to query slow query alert rule", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		}
+		var alert *Alert
+		if ok {
+			alert = w.evaluate(rule, value, now)
+		} else {
+			alert = w.resolveNoData(rule, now)
+		}
+		if alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+	w.lastPollTime = now
+	return alerts
+}
+
+// filterWebhookAlerts drops the repeated firing alerts except for Alertmanager, which resolves an alert by itself
+// when it is not received again within the resolve timeout.
+func filterWebhookAlerts(format string, alerts []Alert) []Alert {
+	if format == config.AlertWebhookFormatAlertmanager {
+		return alerts
+	}
+	filtered := make([]Alert, 0, len(alerts))
+	for _, a := range alerts {
+		if !a.repeated {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// queryAlertRuleValue returns false when there is no data to evaluate the rule in the window, e.g. the digest is
+// not executed slowly.
+func queryAlertRuleValue(db *gorm.DB, rule *config.SlowQueryAlertRule, begin, end time.Time) (float64, bool, error) {
+	tx := db.Table(SlowQueryTable).
+		Where("Time > FROM_UNIXTIME(?) AND Time <= FROM_UNIXTIME(?)", begin.Unix(), end.Unix())
+
+	switch rule.Type {
+	case config.SlowQueryAlertRuleRate:
+		var count int64
+		if err := tx.Count(&count).Error; err != nil {
+			return 0, false, err
+		}
+		minutes := end.Sub(begin).Minutes()
+		if minutes <= 0 {
+			return 0, false, nil
+		}
+		return float64(count) / minutes, true, nil
+	case config.SlowQueryAlertRuleDigestQueryTime:
+		var maxQueryTime sql.NullFloat64
+		if err := tx.Select("MAX(Query_time)").Where("Digest = ?", rule.Digest).Row().Scan(&maxQueryTime); err != nil {
+			return 0, false, err
+		}
+		return maxQueryTime.Float64, maxQueryTime.Valid, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+func TestT(t *testing.T) {
+	check.CustomVerboseFlag = true
+	check.TestingT(t)
+}
+
+var _ = check.Suite(&testAlertSuite{})
+
+type testAlertSuite struct{}
+
+func (t *testAlertSuite) Test_evaluateThreshold(c *check.C) {
+	w := newAlertWatcher()
+	rule := &config.SlowQueryAlertRule{Name: "r", Type: config.SlowQueryAlertRuleRate, Threshold: 10}
+	now := time.Unix(1000, 0)
+
+	c.Assert(w.evaluate(rule, 5, now), check.IsNil)
+
+	alert := w.evaluate(rule, 12, now)
+	c.Assert(alert, check.NotNil)
+	c.Assert(alert.Status, check.Equals, AlertStatusFiring)
+	c.Assert(alert.StartsAt, check.Equals, int64(1000))
+
+	// still firing, the alert is marked as repeated
+	alert = w.evaluate(rule, 15, now.Add(time.Minute))
+	c.Assert(alert, check.NotNil)
+	c.Assert(alert.Status, check.Equals, AlertStatusFiring)
+	c.Assert(alert.StartsAt, check.Equals, int64(1000))
+	c.Assert(alert.repeated, check.IsTrue)
+
+	alert = w.evaluate(rule, 3, now.Add(2*time.Minute))
+	c.Assert(alert, check.NotNil)
+	c.Assert(alert.Status, check.Equals, AlertStatusResolved)
+	c.Assert(alert.StartsAt, check.Equals, int64(1000))
+	c.Assert(alert.EndsAt, check.Equals, int64(1120))
+}
+
+func (t *testAlertSuite) Test_evaluateBaseline(c *check.C) {
+	w := newAlertWatcher()
+	rule := &config.SlowQueryAlertRule{Name: "r", Type: config.SlowQueryAlertRuleDigestQueryTime, Digest: "d", BaselineDeviation: 2, BaselineWindows: 3}
+	now := time.Unix(1000, 0)
+
+	// not enough samples
+	c.Assert(w.evaluate(rule, 1, now), check.IsNil)
+	c.Assert(w.evaluate(rule, 1, now), check.IsNil)
+	c.Assert(w.evaluate(rule, 5, now), check.IsNil)
+
+	alert := w.evaluate(rule, 5, now)
+	c.Assert(alert, check.NotNil)
+	c.Assert(alert.Status, check.Equals, AlertStatusFiring)
+	c.Assert(alert.Baseline, check.Equals, 7.0/3)
+
+	// the baseline only keeps the recent windows
+	c.Assert(w.states["r"].samples, check.DeepEquals, []float64{1, 5, 5})
+}
+
+func (t *testAlertSuite) Test_prune(c *check.C) {
+	w := newAlertWatcher()
+	rule := &config.SlowQueryAlertRule{Name: "r", Type: config.SlowQueryAlertRuleRate, Threshold: 10}
+	w.evaluate(rule, 1, time.Now())
+	w.prune([]config.SlowQueryAlertRule{*rule})
+	c.Assert(w.states, check.HasLen, 1)
+	w.prune(nil)
+	c.Assert(w.states, check.HasLen, 0)
+}
+
+func (t *testAlertSuite) Test_buildAlertPayload(c *check.C) {
+	alerts := []Alert{
+		{Rule: "r", Type: config.SlowQueryAlertRuleDigestQueryTime, Digest: "d", Status: AlertStatusResolved, Reason: "ok", StartsAt: 0, EndsAt: 60},
+	}
+
+	generic := buildAlertPayload(config.AlertWebhookFormatJSON, alerts).(map[string][]Alert)
+	c.Assert(generic["alerts"], check.HasLen, 1)
+
+	slack := buildAlertPayload(config.AlertWebhookFormatSlack, alerts).(map[string]string)
+	c.Assert(slack["text"], check.Equals, "[RESOLVED] slow query alert r: ok")
+
+	am := buildAlertPayload(config.AlertWebhookFormatAlertmanager, alerts).([]alertmanagerAlert)
+	c.Assert(am, check.HasLen, 1)
+	c.Assert(am[0].Labels["digest"], check.Equals, "d")
+	c.Assert(am[0].StartsAt, check.Equals, "1970-01-01T00:00:00Z")
+	c.Assert(am[0].EndsAt, check.Equals, "1970-01-01T00:01:00Z")
+}
+
+func (t *testAlertSuite) Test_resolveNoData(c *check.C) {
+	w := newAlertWatcher()
+	rule := &config.SlowQueryAlertRule{Name: "r", Type: config.SlowQueryAlertRuleDigestQueryTime, Digest: "d", Threshold: 1}
+	now := time.Unix(1000, 0)
+
+	// not firing
+	c.Assert(w.resolveNoData(rule, now), check.IsNil)
+
+	alert := w.evaluate(rule, 3, now)
+	c.Assert(alert, check.NotNil)
+	c.Assert(alert.Status, check.Equals, AlertStatusFiring)
+
+	// the digest is no longer slow
+	alert = w.resolveNoData(rule, now.Add(time.Minute))
+	c.Assert(alert, check.NotNil)
+	c.Assert(alert.Status, check.Equals, AlertStatusResolved)
+	c.Assert(alert.StartsAt, check.Equals, int64(1000))
+	c.Assert(alert.EndsAt, check.Equals, int64(1060))
+	c.Assert(w.states["r"].samples, check.DeepEquals, []float64{3})
+
+	// resolved only once
+	c.Assert(w.resolveNoData(rule, now.Add(2*time.Minute)), check.IsNil)
+}
+
+func (t *testAlertSuite) Test_filterWebhookAlerts(c *check.C) {
+	alerts := []Alert{
+		{Rule: "new", Status: AlertStatusFiring},
+		{Rule: "lasting", Status: AlertStatusFiring, repeated: true},
+		{Rule: "resolved", Status: AlertStatusResolved},
+	}
+
+	c.Assert(filterWebhookAlerts(config.AlertWebhookFormatAlertmanager, alerts), check.HasLen, 3)
+	for _, format := range []string{config.AlertWebhookFormatJSON, config.AlertWebhookFormatSlack} {
+		filtered := filterWebhookAlerts(format, alerts)
+		c.Assert(filtered, check.HasLen, 2)
+		c.Assert(filtered[0].Rule, check.Equals, "new")
+		c.Assert(filtered[1].Rule, check.Equals, "resolved")
+	}
+}
+
+func (t *testAlertSuite) Test_evaluateRulesSkipsFailedRules(c *check.C) {
+	w := newAlertWatcher()
+	rules := []config.SlowQueryAlertRule{
+		{Name: "broken", Type: config.SlowQueryAlertRuleRate, Threshold: 1},
+		{Name: "rate", Type: config.SlowQueryAlertRuleRate, Threshold: 1},
+	}
+	now := time.Unix(1000, 0)
+
+	alerts := w.evaluateRules(rules, now, func(rule *config.SlowQueryAlertRule) (float64, bool, error) {
+		if rule.Name == "broken" {
+			return 0, false, errors.New("query failed")
+		}
+		return 2, true, nil
+	})
+	c.Assert(alerts, check.HasLen, 1)
+	c.Assert(alerts[0].Rule, check.Equals, "rate")
+	c.Assert(w.lastPollTime, check.Equals, now)
+
+	// the failed rule has no sample, and the window of the poll is counted only once
+	_, ok := w.states["broken"]
+	c.Assert(ok, check.IsFalse)
+	c.Assert(w.states["rate"].samples, check.DeepEquals, []float64{2})
+}
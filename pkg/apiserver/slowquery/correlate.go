@@ -0,0 +1,104 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/logsearch"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+)
+
+// Components may log about a transaction a bit before or after the slow query is recorded, e.g. resolving locks.
+const correlatedLogMargin = 30 * time.Second
+
+var ErrNoCorrelationKey = ErrNS.NewType("no_correlation_key")
+
+// buildCorrelatedLogSearch builds a log search which finds the logs mentioning the transaction start ts or the
+// connection id of the slow query, in the TiDB instance executing it and the TiKV stores serving it. When the
+// TiKV addresses are not recorded in the slow query, all TiKV stores are searched.
+// Same as the log search, TiDB is displayed by the service address and searched through the status address,
+// which is recorded in the slow query.
+func buildCorrelatedLogSearch(detail *Model, tidbs []topology.TiDBInfo, stores []topology.StoreInfo) (*logsearch.CreateTaskGroupRequest, error) {
+	alternatives := make([]string, 0, 2)
+	if ts := strings.TrimSpace(detail.TxnStartTS); ts != "" && ts != "0" {
+		alternatives = append(alternatives, `\b`+regexp.QuoteMeta(ts)+`\b`)
+	}
+	if connID := strings.TrimSpace(detail.ConnectionID); connID != "" && connID != "0" {
+		alternatives = append(alternatives, `\bconn(ection)?(ID|_id)?"?[=: ]+"?`+regexp.QuoteMeta(connID)+`\b`)
+	}
+	if len(alternatives) == 0 {
+		return nil, ErrNoCorrelationKey.New("neither txn_start_ts nor connection id is available")
+	}
+
+	targets := make([]model.RequestTargetNode, 0)
+	host, port, err := net.SplitHostPort(detail.Instance)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance %s: %w", detail.Instance, err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance %s: %w", detail.Instance, err)
+	}
+	tidbTarget := model.RequestTargetNode{
+		Kind:        model.NodeKindTiDB,
+		DisplayName: detail.Instance,
+		IP:          host,
+		Port:        portNum,
+	}
+	for _, i := range tidbs {
+		if i.IP == host && int(i.StatusPort) == portNum {
+			tidbTarget.DisplayName = net.JoinHostPort(i.IP, strconv.Itoa(int(i.Port)))
+			break
+		}
+	}
+	targets = append(targets, tidbTarget)
+
+	copAddrs := make(map[string]struct{})
+	for _, addr := range []string{detail.CopProcAddr, detail.CopWaitAddr} {
+		if addr != "" {
+			copAddrs[addr] = struct{}{}
+		}
+	}
+	storeTargets := make([]model.RequestTargetNode, 0, len(stores))
+	relatedTargets := make([]model.RequestTargetNode, 0, len(copAddrs))
+	for _, store := range stores {
+		if store.Status == topology.ComponentStatusTombstone {
+			continue
+		}
+		addr := net.JoinHostPort(store.IP, strconv.Itoa(int(store.Port)))
+		target := model.RequestTargetNode{
+			Kind:        model.NodeKindTiKV,
+			DisplayName: addr,
+			IP:          store.IP,
+			Port:        int(store.Port),
+		}
+		storeTargets = append(storeTargets, target)
+		if _, ok := copAddrs[addr]; ok {
+			relatedTargets = append(relatedTargets, target)
+		}
+	}
+	if len(relatedTargets) > 0 {
+		targets = append(targets, relatedTargets...)
+	} else {
+		targets = append(targets, storeTargets...)
+	}
+
+	finishTime := time.UnixMilli(int64(detail.Timestamp * 1000))
+	startTime := finishTime.Add(-time.Duration(detail.QueryTime * float64(time.Second)))
+	return &logsearch.CreateTaskGroupRequest{
+		Request: logsearch.SearchLogRequest{
+			StartTime: startTime.Add(-correlatedLogMargin).UnixMilli(),
+			EndTime:   finishTime.Add(correlatedLogMargin).UnixMilli(),
+			MinLevel:  logsearch.LogLevelDebug,
+			Patterns:  []string{strings.Join(alternatives, "|")},
+		},
+		Targets: targets,
+	}, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"regexp"
+
+	"github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+)
+
+var _ = check.Suite(&testCorrelateSuite{})
+
+type testCorrelateSuite struct{}
+
+func (t *testCorrelateSuite) Test_buildCorrelatedLogSearch(c *check.C) {
+	stores := []topology.StoreInfo{
+		{IP: "10.0.0.1", Port: 20160},
+		{IP: "10.0.0.2", Port: 20160},
+		{IP: "10.0.0.3", Port: 20160, Status: topology.ComponentStatusTombstone},
+	}
+	tidbs := []topology.TiDBInfo{
+		{IP: "10.0.0.4", Port: 4000, StatusPort: 10080},
+		{IP: "10.0.0.5", Port: 4000, StatusPort: 10080},
+	}
+	detail := &Model{
+		Instance:     "10.0.0.5:10080",
+		ConnectionID: "42",
+		TxnStartTS:   "449571234",
+		Timestamp:    1000,
+		QueryTime:    2.5,
+		CopProcAddr:  "10.0.0.2:20160",
+	}
+
+	req, err := buildCorrelatedLogSearch(detail, tidbs, stores)
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Request.StartTime, check.Equals, int64(1000000-2500-30000))
+	c.Assert(req.Request.EndTime, check.Equals, int64(1000000+30000))
+	c.Assert(req.Targets, check.DeepEquals, []model.RequestTargetNode{
+		{Kind: model.NodeKindTiDB, DisplayName: "10.0.0.5:4000", IP: "10.0.0.5", Port: 10080},
+		{Kind: model.NodeKindTiKV, DisplayName: "10.0.0.2:20160", IP: "10.0.0.2", Port: 20160},
+	})
+
+	c.Assert(req.Request.Patterns, check.HasLen, 1)
+	pattern := regexp.MustCompile("(?i)" + req.Request.Patterns[0])
+	c.Assert(pattern.MatchString(`[2pc.go:1] ["prewrite"] [startTS=449571234]`), check.IsTrue)
+	c.Assert(pattern.MatchString(`[conn.go:1] ["command dispatched"] [conn=42]`), check.IsTrue)
+	c.Assert(pattern.MatchString(`["session"] [connectionID=42]`), check.IsTrue)
+	c.Assert(pattern.MatchString(`[conn.go:1] ["command dispatched"] [conn=421]`), check.IsFalse)
+	c.Assert(pattern.MatchString(`[startTS=4495712345]`), check.IsFalse)
+
+	// all stores except tombstones are searched when the related stores are unknown
+	detail.CopProcAddr = ""
+	req, err = buildCorrelatedLogSearch(detail, tidbs, stores)
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Targets, check.HasLen, 3)
+	c.Assert(req.Targets[2].DisplayName, check.Equals, "10.0.0.2:20160")
+
+	// the status address is displayed when the TiDB instance is not in the topology
+	req, err = buildCorrelatedLogSearch(detail, nil, stores)
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Targets[0].DisplayName, check.Equals, "10.0.0.5:10080")
+
+	detail.ConnectionID = ""
+	detail.TxnStartTS = "0"
+	_, err = buildCorrelatedLogSearch(detail, tidbs, stores)
+	c.Assert(err, check.NotNil)
+}
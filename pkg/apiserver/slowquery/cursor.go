@@ -0,0 +1,105 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/oleiade/reflections"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/util/reflectutil"
+)
+
+var ErrInvalidCursor = ErrNS.NewType("invalid_cursor")
+
+// listCursor identifies the last row of a page. Rows are ordered by the requested
+// column first, and then by (Time, Digest, INSTANCE, Conn_ID) so that the order is total.
+type listCursor struct {
+	OrderBy      string      `json:"o"`
+	IsDesc       bool        `json:"d"`
+	Value        interface{} `json:"v,omitempty"` // value of the order by column, omitted when ordering by timestamp
+	Timestamp    string      `json:"t"`
+	Digest       string      `json:"g"`
+	Instance     string      `json:"i"`
+	ConnectionID string      `json:"c"`
+}
+
+func encodeListCursor(req *GetListRequest, last *Model) (string, error) {
+	cursor := listCursor{
+		OrderBy:      req.OrderBy,
+		IsDesc:       req.IsDesc,
+		Timestamp:    strconv.FormatFloat(last.Timestamp, 'f', -1, 64),
+		Digest:       last.Digest,
+		Instance:     last.Instance,
+		ConnectionID: last.ConnectionID,
+	}
+	if req.OrderBy != "timestamp" {
+		fieldName, ok := modelFieldNameByJSONName(req.OrderBy)
+		if !ok {
+			return "", ErrUnknownColumn.New("unknown order by %s", req.OrderBy)
+		}
+		v, err := reflections.GetField(last, fieldName)
+		if err != nil {
+			return "", err
+		}
+		cursor.Value = v
+	}
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeListCursor(req *GetListRequest) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor.WrapWithNoMessage(err)
+	}
+	var cursor listCursor
+	// Keep numbers as they are, so that large integers are not truncated by float64.
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&cursor); err != nil {
+		return nil, ErrInvalidCursor.WrapWithNoMessage(err)
+	}
+	if cursor.OrderBy != req.OrderBy || cursor.IsDesc != req.IsDesc {
+		return nil, ErrInvalidCursor.New("cursor does not match the requested order")
+	}
+	return &cursor, nil
+}
+
+// applyListCursor filters out rows that are before (or equal to) the cursor in the requested order.
+// `orderExpr` is the SQL expression of the order by column, which is ignored when ordering by timestamp.
+func applyListCursor(tx *gorm.DB, cursor *listCursor, orderExpr string) *gorm.DB {
+	op := ">"
+	if cursor.IsDesc {
+		op = "<"
+	}
+	if cursor.OrderBy == "timestamp" {
+		// The redundant condition allows TiDB to push the time range down to the slow log reader.
+		tx = tx.Where(fmt.Sprintf("Time %s= FROM_UNIXTIME(?)", op), cursor.Timestamp)
+		return tx.Where(
+			fmt.Sprintf("(Time, Digest, INSTANCE, Conn_ID) %s (FROM_UNIXTIME(?), ?, ?, ?)", op),
+			cursor.Timestamp, cursor.Digest, cursor.Instance, cursor.ConnectionID,
+		)
+	}
+	return tx.Where(
+		fmt.Sprintf("(%s, Time, Digest, INSTANCE, Conn_ID) %s (?, FROM_UNIXTIME(?), ?, ?, ?)", orderExpr, op),
+		cursor.Value, cursor.Timestamp, cursor.Digest, cursor.Instance, cursor.ConnectionID,
+	)
+}
+
+func modelFieldNameByJSONName(jsonName string) (string, bool) {
+	fields := reflectutil.GetFieldsAndTags(Model{}, []string{"json"})
+	f, ok := lo.Find(fields, func(f reflectutil.Field) bool {
+		return f.Tags["json"] == jsonName
+	})
+	return f.Name, ok
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"fmt"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+)
+
+// groupByColumns maps the allowed group by keys to the slow query table columns.
+var groupByColumns = map[string]string{
+	"digest":      "Digest",
+	"plan_digest": "Plan_digest",
+	"user":        "User",
+	"instance":    "INSTANCE",
+	"db":          "DB",
+	"index_names": "Index_names",
+}
+
+var groupOrderByColumns = []string{
+	"count",
+	"sum_query_time",
+	"max_query_time",
+	"p50_query_time",
+	"p90_query_time",
+	"p99_query_time",
+	"sum_process_time",
+	"sum_wait_time",
+	"sum_backoff_time",
+}
+
+type GetGroupRequest struct {
+	BeginTime     int      `json:"begin_time" form:"begin_time"`
+	EndTime       int      `json:"end_time" form:"end_time"`
+	DB            []string `json:"db" form:"db"`
+	ResourceGroup []string `json:"resource_group" form:"resource_group"`
+	Text          string   `json:"text" form:"text"`
+	Digest        string   `json:"digest" form:"digest"`
+	Plans         []string `json:"plans" form:"plans"`
+
+	GroupBy string `json:"group_by" form:"group_by" enums:"digest,plan_digest,user,instance,db,index_names"`
+	// Groups are always sorted in descending order. Defaults to sum_query_time.
+	OrderBy string `json:"orderBy" form:"orderBy" enums:"count,sum_query_time,max_query_time,p50_query_time,p90_query_time,p99_query_time,sum_process_time,sum_wait_time,sum_backoff_time"`
+	Limit   int    `json:"limit" form:"limit"`
+}
+
+type GroupModel struct {
+	GroupKey string `gorm:"column:group_key" json:"group_key"`
+	Count    int    `gorm:"column:count" json:"count"`
+
+	SumQueryTime   float64 `gorm:"column:sum_query_time" json:"sum_query_time"`
+	MaxQueryTime   float64 `gorm:"column:max_query_time" json:"max_query_time"`
+	P50QueryTime   float64 `gorm:"column:p50_query_time" json:"p50_query_time"`
+	P90QueryTime   float64 `gorm:"column:p90_query_time" json:"p90_query_time"`
+	P99QueryTime   float64 `gorm:"column:p99_query_time" json:"p99_query_time"`
+	SumProcessTime float64 `gorm:"column:sum_process_time" json:"sum_process_time"`
+	SumWaitTime    float64 `gorm:"column:sum_wait_time" json:"sum_wait_time"`
+	SumBackoffTime float64 `gorm:"column:sum_backoff_time" json:"sum_backoff_time"`
+
+	// The slowest query in the group, which can be used to query the slow query detail.
+	SampleQuery        string  `gorm:"column:sample_query" json:"sample_query"`
+	SampleDigest       string  `gorm:"column:sample_digest" json:"sample_digest"`
+	SampleTimestamp    float64 `gorm:"column:sample_timestamp" json:"sample_timestamp"`
+	SampleConnectionID string  `gorm:"column:sample_connection_id" json:"sample_connection_id"`
+}
+
+func QuerySlowLogGroups(req *GetGroupRequest, sysSchema *commonUtils.SysSchema, db *gorm.DB) ([]GroupModel, error) {
+	groupColumn, ok := groupByColumns[req.GroupBy]
+	if !ok {
+		return nil, ErrUnknownColumn.New("unknown group by %s", req.GroupBy)
+	}
+	slowQueryColumns, err := sysSchema.GetTableColumnNames(db, SlowQueryTable)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.IsSubsetICaseInsensitive(slowQueryColumns, []string{groupColumn}) {
+		return nil, ErrUnknownColumn.New("group by %s is not supported in the current version TiDB schema", req.GroupBy)
+	}
+
+	if req.OrderBy == "" {
+		req.OrderBy = "sum_query_time"
+	}
+	if !lo.Contains(groupOrderByColumns, req.OrderBy) {
+		return nil, ErrUnknownColumn.New("unknown order by %s", req.OrderBy)
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+
+	// TiDB does not provide percentile aggregations, so rows are ranked by window functions inside
+	// each group and the percentiles are picked by the rank.
+	groupExpr := fmt.Sprintf("IFNULL(%s, '')", groupColumn)
+	innerStmt := fmt.Sprintf(`%s AS group_key, Query_time, Process_time, Wait_time, Backoff_time, Query, Digest, Time, Conn_ID,
+		ROW_NUMBER() OVER (PARTITION BY %s ORDER BY Query_time) AS rn,
+		COUNT(*) OVER (PARTITION BY %s) AS cnt`, groupExpr, groupExpr, groupExpr)
+	inner := applyListFilters(db.Select(innerStmt), &GetListRequest{
+		BeginTime:     req.BeginTime,
+		EndTime:       req.EndTime,
+		DB:            req.DB,
+		ResourceGroup: req.ResourceGroup,
+		Text:          req.Text,
+		Digest:        req.Digest,
+		Plans:         req.Plans,
+	})
+
+	var results []GroupModel
+	err = db.Session(&gorm.Session{NewDB: true}).
+		Table("(?) AS t", inner).
+		Select(`group_key,
+			COUNT(*) AS count,
+			SUM(Query_time) AS sum_query_time,
+			MAX(Query_time) AS max_query_time,
+			MIN(CASE WHEN rn >= CEIL(cnt * 0.5) THEN Query_time END) AS p50_query_time,
+			MIN(CASE WHEN rn >= CEIL(cnt * 0.9) THEN Query_time END) AS p90_query_time,
+			MIN(CASE WHEN rn >= CEIL(cnt * 0.99) THEN Query_time END) AS p99_query_time,
+			SUM(Process_time) AS sum_process_time,
+			SUM(Wait_time) AS sum_wait_time,
+			SUM(Backoff_time) AS sum_backoff_time,
+			MAX(CASE WHEN rn = cnt THEN Query END) AS sample_query,
+			MAX(CASE WHEN rn = cnt THEN Digest END) AS sample_digest,
+			MAX(CASE WHEN rn = cnt THEN UNIX_TIMESTAMP(Time) + 0E0 END) AS sample_timestamp,
+			MAX(CASE WHEN rn = cnt THEN Conn_ID END) AS sample_connection_id`).
+		Group("group_key").
+		Order(fmt.Sprintf("%s DESC", req.OrderBy)).
+		Limit(req.Limit).
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
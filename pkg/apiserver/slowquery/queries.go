@@ -12,6 +12,8 @@ import (
 
 const (
 	SlowQueryTable = "INFORMATION_SCHEMA.CLUSTER_SLOW_QUERY"
+
+	exportPageSize = 1000
 )
 
 type GetListRequest struct {
@@ -29,6 +31,14 @@ type GetListRequest struct {
 	Digest string   `json:"digest" form:"digest"`
 
 	Fields string `json:"fields" form:"fields"` // example: "Query,Digest"
+
+	// Cursor returned by the previous page, used for keyset pagination. The order must be the same as the previous page.
+	Cursor string `json:"cursor" form:"cursor"`
+	// Whether to count the total number of rows matching the filters. This can be slow on large slow logs.
+	WithTotal bool `json:"with_total" form:"with_total"`
+
+	// Only used when exporting slow queries. Defaults to csv.
+	Format string `json:"format" form:"format" enums:"csv,ndjson,parquet"`
 }
 
 type GetDetailRequest struct {
@@ -44,24 +54,117 @@ func QuerySlowLogList(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.
 		return nil, err
 	}
 
+	// more robust
+	if req.OrderBy == "" {
+		req.OrderBy = "timestamp"
+	}
+
+	// The instance and the order by field are required to build the cursor of the next page.
 	reqFields := strings.Split(req.Fields, ",")
+	if reqFields[0] != "*" {
+		reqFields = append(reqFields, "instance", req.OrderBy)
+	}
 	selectStmt, err := genSelectStmt(slowQueryColumns, reqFields)
 	if err != nil {
 		return nil, err
 	}
 
-	tx := db.
-		Select(selectStmt)
-
-	if req.BeginTime != 0 && req.EndTime != 0 {
-		tx = tx.Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", req.BeginTime, req.EndTime)
-	}
+	tx := applyListFilters(db.Select(selectStmt), req)
 
 	if req.Limit <= 0 {
 		req.Limit = 100
 	}
 	tx = tx.Limit(req.Limit)
 
+	orderStmt, err := genOrderStmt(slowQueryColumns, req.OrderBy, req.IsDesc)
+	if err != nil {
+		return nil, err
+	}
+	tx = tx.Order(orderStmt)
+	// Break ties so that the order is stable across pages.
+	for _, column := range []string{"Time", "Digest", "INSTANCE", "Conn_ID"} {
+		if req.IsDesc {
+			tx = tx.Order(column + " DESC")
+		} else {
+			tx = tx.Order(column + " ASC")
+		}
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeListCursor(req)
+		if err != nil {
+			return nil, err
+		}
+		orderExpr, err := genOrderExpr(slowQueryColumns, req.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		tx = applyListCursor(tx, cursor, orderExpr)
+	}
+
+	var results []Model
+	err = tx.Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamSlowLogList pages through the slow queries matching the request by the cursor, and calls `fn` for each
+// slow query. At most `req.Limit` slow queries are visited, or all of them if the limit is not set.
+// `db` is the connection to TiDB.
+func StreamSlowLogList(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.DB, fn func(m *Model) error) error {
+	remaining := req.Limit
+	pageReq := *req
+	for {
+		pageReq.Limit = exportPageSize
+		if req.Limit > 0 && remaining < exportPageSize {
+			pageReq.Limit = remaining
+		}
+		results, err := QuerySlowLogList(&pageReq, sysSchema, db.Table(SlowQueryTable))
+		if err != nil {
+			return err
+		}
+		for i := range results {
+			if err := fn(&results[i]); err != nil {
+				return err
+			}
+		}
+		remaining -= len(results)
+		if req.Limit > 0 && remaining <= 0 {
+			return nil
+		}
+		cursor, err := NextSlowLogListCursor(&pageReq, results)
+		if err != nil {
+			return err
+		}
+		if cursor == "" {
+			return nil
+		}
+		pageReq.Cursor = cursor
+	}
+}
+
+// CountSlowLogList counts the rows matching the filters of the request, ignoring the limit and the cursor.
+func CountSlowLogList(req *GetListRequest, db *gorm.DB) (int64, error) {
+	var count int64
+	err := applyListFilters(db, req).Count(&count).Error
+	return count, err
+}
+
+// NextSlowLogListCursor returns the cursor of the page after `results`, or an empty string if there is no more page.
+func NextSlowLogListCursor(req *GetListRequest, results []Model) (string, error) {
+	if len(results) == 0 || len(results) < req.Limit {
+		return "", nil
+	}
+	return encodeListCursor(req, &results[len(results)-1])
+}
+
+func applyListFilters(tx *gorm.DB, req *GetListRequest) *gorm.DB {
+	if req.BeginTime != 0 && req.EndTime != 0 {
+		tx = tx.Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", req.BeginTime, req.EndTime)
+	}
+
 	if req.Text != "" {
 		lowerStr := strings.ToLower(req.Text)
 		arr := strings.Fields(lowerStr)
@@ -84,17 +187,6 @@ func QuerySlowLogList(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.
 		tx = tx.Where("RESOURCE_GROUP IN (?)", req.ResourceGroup)
 	}
 
-	// more robust
-	if req.OrderBy == "" {
-		req.OrderBy = "timestamp"
-	}
-	orderStmt, err := genOrderStmt(slowQueryColumns, req.OrderBy, req.IsDesc)
-	if err != nil {
-		return nil, err
-	}
-
-	tx = tx.Order(orderStmt)
-
 	if len(req.Plans) > 0 {
 		tx = tx.Where("Plan_digest IN (?)", req.Plans)
 	}
@@ -103,12 +195,7 @@ func QuerySlowLogList(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.
 		tx = tx.Where("Digest = ?", req.Digest)
 	}
 
-	var results []Model
-	err = tx.Find(&results).Error
-	if err != nil {
-		return nil, err
-	}
-	return results, nil
+	return tx
 }
 
 func QuerySlowLogDetail(req *GetDetailRequest, sysSchema *utils.SysSchema, db *gorm.DB) (*Model, error) {
@@ -3,20 +3,30 @@
 package slowquery
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joomcode/errorx"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/fx"
 
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/logsearch"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sso"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/pd"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
 var (
@@ -26,16 +36,39 @@ var (
 
 type ServiceParams struct {
 	fx.In
-	TiDBClient *tidb.Client
-	SysSchema  *commonUtils.SysSchema
+	TiDBClient    *tidb.Client
+	SysSchema     *commonUtils.SysSchema
+	ConfigManager *config.DynamicConfigManager
+	SSOService    *sso.Service
+	PDClient      *pd.Client
+	EtcdClient    *clientv3.Client
+	LogSearch     *logsearch.Service
 }
 
 type Service struct {
 	params ServiceParams
+	fSwap  *fileswap.Handler
+
+	wg sync.WaitGroup
 }
 
-func newService(p ServiceParams) *Service {
-	return &Service{params: p}
+func newService(lc fx.Lifecycle, p ServiceParams) *Service {
+	s := &Service{params: p, fSwap: fileswap.New()}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.alertLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -43,11 +76,16 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	{
 		endpoint.GET("/download", s.downloadHandler)
 
+		endpoint.GET("/alert/config", auth.MWAuthRequired(), s.getAlertConfigHandler)
+		endpoint.PUT("/alert/config", auth.MWAuthRequired(), auth.MWRequireWritePriv(), s.setAlertConfigHandler)
+
 		endpoint.Use(auth.MWAuthRequired())
 		endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 		{
 			endpoint.GET("/list", s.getList)
+			endpoint.GET("/group", s.getGroups)
 			endpoint.GET("/detail", s.getDetails)
+			endpoint.POST("/logsearch", s.createLogSearchHandler)
 
 			endpoint.POST("/download/token", s.downloadTokenHandler)
 
@@ -56,9 +94,116 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	}
 }
 
+// @Summary Search the component logs of a slow query
+// @Description Create a log search task group which finds the logs mentioning the txn_start_ts or the connection id of the slow query, in the TiDB instance and the related TiKV stores, around the time the query is executed.
+// @Param request body GetDetailRequest true "Request body"
+// @Success 200 {object} logsearch.TaskGroupResponse
+// @Router /slow_query/logsearch [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) createLogSearchHandler(c *gin.Context) {
+	var req GetDetailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	detail, err := QuerySlowLogDetail(&req, s.params.SysSchema, db.Table(SlowQueryTable))
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	tidbs, err := topology.FetchTiDBTopology(c.Request.Context(), s.params.EtcdClient)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	stores, _, err := topology.FetchStoreTopology(s.params.PDClient)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	searchReq, err := buildCorrelatedLogSearch(detail, tidbs, stores)
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	resp, err := s.params.LogSearch.StartTaskGroup(searchReq)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Get slow query alert configurations
+// @Success 200 {object} config.SlowQueryAlertConfig
+// @Router /slow_query/alert/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) getAlertConfigHandler(c *gin.Context) {
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.SlowQueryAlert)
+}
+
+// @Summary Update slow query alert configurations
+// @Description The watcher requires the SQL user authorized for SSO impersonation, which is used to read slow queries in background. Omitted fields keep the current values.
+// @Param request body config.SlowQueryAlertConfig true "Request body"
+// @Success 200 {object} config.SlowQueryAlertConfig
+// @Router /slow_query/alert/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) setAlertConfigHandler(c *gin.Context) {
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	req := dc.SlowQueryAlert
+	// The elements of a slice are decoded into the existing ones, so that it is replaced as a whole if present.
+	req.Rules = nil
+	req.Webhooks = nil
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = dc.SlowQueryAlert.Rules
+	}
+	if req.Webhooks == nil {
+		req.Webhooks = dc.SlowQueryAlert.Webhooks
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.SlowQueryAlert = req
+	}
+	if err := s.params.ConfigManager.Modify(opt); err != nil {
+		rest.Error(c, err)
+		return
+	}
+	dc, err = s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.SlowQueryAlert)
+}
+
 // @Summary List all slow queries
+// @Description Use the cursor in the `X-Next-Cursor` response header to fetch the next page.
 // @Param q query GetListRequest true "Query"
 // @Success 200 {array} Model
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent if there is no more page"
+// @Header 200 {integer} X-Total-Count "Total number of matched slow queries, only available when with_total is set"
 // @Router /slow_query/list [get]
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
@@ -73,10 +218,60 @@ func (s *Service) getList(c *gin.Context) {
 	db := utils.GetTiDBConnection(c)
 	results, err := QuerySlowLogList(&req, s.params.SysSchema, db.Table(SlowQueryTable))
 	if err != nil {
+		if errorx.IsOfType(err, ErrInvalidCursor) {
+			rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
+			return
+		}
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	nextCursor, err := NextSlowLogListCursor(&req, results)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	if nextCursor != "" {
+		c.Header("X-Next-Cursor", nextCursor)
+	}
+
+	if req.WithTotal {
+		total, err := CountSlowLogList(&req, db.Table(SlowQueryTable))
+		if err != nil {
+			rest.Error(c, err)
+			return
+		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// @Summary Group slow queries and aggregate their execution time
+// @Param q query GetGroupRequest true "Query"
+// @Success 200 {array} GroupModel
+// @Router /slow_query/group [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) getGroups(c *gin.Context) {
+	var req GetGroupRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
 		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
 
+	db := utils.GetTiDBConnection(c)
+	results, err := QuerySlowLogGroups(&req, s.params.SysSchema, db.Table(SlowQueryTable))
+	if err != nil {
+		if errorx.IsOfType(err, ErrUnknownColumn) {
+			rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
+			return
+		}
+		rest.Error(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, results)
 }
 
@@ -137,53 +332,47 @@ func (s *Service) downloadTokenHandler(c *gin.Context) {
 		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	format, err := utils.ParseExportFormat(req.Format)
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
 	fields := []string{}
 	if strings.TrimSpace(req.Fields) != "" {
 		fields = strings.Split(req.Fields, ",")
 	}
 	db := utils.GetTiDBConnection(c)
-	list, err := QuerySlowLogList(&req, s.params.SysSchema, db.Table(SlowQueryTable))
-	if err != nil {
-		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
-		return
-	}
-	if len(list) == 0 {
-		rest.Error(c, ErrNoData.NewWithNoMessage())
-		return
-	}
 
-	// interface{} tricky
-	rawData := make([]interface{}, len(list))
-	for i, v := range list {
-		rawData[i] = v
-	}
-
-	// convert data
-	csvData := utils.GenerateCSVFromRaw(rawData, fields, []string{})
-
-	// generate temp file that persist encrypted data
 	timeLayout := "0102150405"
 	beginTime := time.Unix(int64(req.BeginTime), 0).Format(timeLayout)
 	endTime := time.Unix(int64(req.EndTime), 0).Format(timeLayout)
-	token, err := utils.ExportCSV(csvData,
-		fmt.Sprintf("slowquery_%s_%s_*.csv", beginTime, endTime),
-		"slowquery/download")
+	token, err := utils.ExportToFile(s.fSwap, format,
+		fmt.Sprintf("slowquery_%s_%s", beginTime, endTime),
+		Model{}, fields, []string{},
+		func(write func(row interface{}) error) error {
+			return StreamSlowLogList(&req, s.params.SysSchema, db, func(m *Model) error {
+				return write(m)
+			})
+		})
 	if err != nil {
 		rest.Error(c, err)
 		return
 	}
+	if token == "" {
+		rest.Error(c, ErrNoData.NewWithNoMessage())
+		return
+	}
 	c.String(http.StatusOK, token)
 }
 
 // @Router /slow_query/download [get]
 // @Summary Download slow query statements
-// @Produce text/csv
+// @Produce application/octet-stream
 // @Param token query string true "download token"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadHandler(c *gin.Context) {
-	token := c.Query("token")
-	utils.DownloadByToken(token, "slowquery/download", c)
+	s.fSwap.HandleDownloadRequest(c)
 }
 
 // @Summary Get available field names
@@ -58,25 +58,10 @@ func genOrderStmt(tableColumns []string, orderBy string, isDesc bool) (string, e
 	if orderBy == "timestamp" {
 		order = "Time"
 	} else {
-		// We have both TiDB 4.x and TiDB 5.x columns listed in the model. Filter out columns that do not exist in current version TiDB schema.
-		fields := lo.Filter(getFieldsAndTags(), func(f Field, _ int) bool {
-			var representedColumns []string
-			if len(f.Related) != 0 {
-				representedColumns = f.Related
-			} else {
-				representedColumns = []string{f.ColumnName}
-			}
-			// For compatibility with old TiDB, we need to check if the column exists in the table.
-			// Dependent columns of the requested field must exist in the db schema. Otherwise, the requested field will be ignored.
-			return utils.IsSubsetICaseInsensitive(tableColumns, representedColumns)
-		})
-		orderField, ok := lo.Find(fields, func(f Field) bool {
-			return f.JSONName == orderBy
-		})
-		if !ok {
-			return "", ErrUnknownColumn.New("unknown order by %s", orderBy)
+		orderField, err := findOrderField(tableColumns, orderBy)
+		if err != nil {
+			return "", err
 		}
-
 		order = orderField.ColumnName
 	}
 
@@ -88,3 +73,40 @@ func genOrderStmt(tableColumns []string, orderBy string, isDesc bool) (string, e
 
 	return order, nil
 }
+
+// genOrderExpr returns the expression of the order by field which can be used in the WHERE clause.
+func genOrderExpr(tableColumns []string, orderBy string) (string, error) {
+	if orderBy == "timestamp" {
+		return "Time", nil
+	}
+	orderField, err := findOrderField(tableColumns, orderBy)
+	if err != nil {
+		return "", err
+	}
+	if orderField.Projection != "" {
+		return orderField.Projection, nil
+	}
+	return orderField.ColumnName, nil
+}
+
+func findOrderField(tableColumns []string, orderBy string) (Field, error) {
+	// We have both TiDB 4.x and TiDB 5.x columns listed in the model. Filter out columns that do not exist in current version TiDB schema.
+	fields := lo.Filter(getFieldsAndTags(), func(f Field, _ int) bool {
+		var representedColumns []string
+		if len(f.Related) != 0 {
+			representedColumns = f.Related
+		} else {
+			representedColumns = []string{f.ColumnName}
+		}
+		// For compatibility with old TiDB, we need to check if the column exists in the table.
+		// Dependent columns of the requested field must exist in the db schema. Otherwise, the requested field will be ignored.
+		return utils.IsSubsetICaseInsensitive(tableColumns, representedColumns)
+	})
+	orderField, ok := lo.Find(fields, func(f Field) bool {
+		return f.JSONName == orderBy
+	})
+	if !ok {
+		return Field{}, ErrUnknownColumn.New("unknown order by %s", orderBy)
+	}
+	return orderField, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+const alertWebhookTimeout = 10 * time.Second
+
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    string            `json:"startsAt"`
+	EndsAt      string            `json:"endsAt,omitempty"`
+}
+
+func buildAlertPayload(format string, alerts []Alert) interface{} {
+	switch format {
+	case config.AlertWebhookFormatSlack:
+		lines := make([]string, 0, len(alerts))
+		for _, a := range alerts {
+			lines = append(lines, fmt.Sprintf("[%s] slow query alert %s: %s", strings.ToUpper(string(a.Status)), a.Rule, a.Reason))
+		}
+		return map[string]string{"text": strings.Join(lines, "\n")}
+	case config.AlertWebhookFormatAlertmanager:
+		payload := make([]alertmanagerAlert, 0, len(alerts))
+		for _, a := range alerts {
+			labels := map[string]string{
+				"alertname": "TiDBDashboardSlowQuery",
+				"rule":      a.Rule,
+				"type":      a.Type,
+			}
+			if a.Digest != "" {
+				labels["digest"] = a.Digest
+			}
+			item := alertmanagerAlert{
+				Labels: labels,
+				Annotations: map[string]string{
+					"summary":  a.Reason,
+					"value":    strconv.FormatFloat(a.Value, 'f', 2, 64),
+					"baseline": strconv.FormatFloat(a.Baseline, 'f', 2, 64),
+				},
+				StartsAt: time.Unix(a.StartsAt, 0).UTC().Format(time.RFC3339),
+			}
+			if a.EndsAt != 0 {
+				item.EndsAt = time.Unix(a.EndsAt, 0).UTC().Format(time.RFC3339)
+			}
+			payload = append(payload, item)
+		}
+		return payload
+	default:
+		return map[string][]Alert{"alerts": alerts}
+	}
+}
+
+func sendAlerts(ctx context.Context, webhook config.AlertWebhook, alerts []Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, alertWebhookTimeout)
+	defer cancel()
+
+	resp, err := resty.New().R().SetContext(ctx).
+		SetBody(buildAlertPayload(webhook.Format, alerts)).
+		Post(webhook.URL)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("webhook responds status %s", resp.Status())
+	}
+	return nil
+}
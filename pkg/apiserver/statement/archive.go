@@ -0,0 +1,540 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const archiveBatchSize = 100
+
+// ArchiveModel is a statement summary snapshot of one summary interval, aggregated by schema, digest and plan digest.
+// Columns other than `Data` are only used for filtering.
+type ArchiveModel struct {
+	ID               uint   `gorm:"primary_key"`
+	SummaryBeginTime int    `gorm:"index"`
+	SummaryEndTime   int    `gorm:"index"`
+	SchemaName       string `gorm:"index:idx_statement_archives_digest"`
+	Digest           string `gorm:"index:idx_statement_archives_digest"`
+	PlanDigest       string
+	StmtType         string
+	ResourceGroup    string
+	TableNames       string `gorm:"type:text"`
+	DigestText       string `gorm:"type:text"`
+	Data             string `gorm:"type:text"` // JSON encoded Model
+}
+
+func (ArchiveModel) TableName() string {
+	return "statement_archives"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&ArchiveModel{})
+}
+
+func (s *Service) archiveLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+
+	var cfg config.StatementConfig
+	var timeCh <-chan time.Time = make(chan time.Time, 1)
+
+	archive := func() {
+		if !cfg.ArchiveEnabled {
+			timeCh = make(chan time.Time, 1)
+			return
+		}
+		timeCh = time.After(time.Duration(cfg.ArchiveIntervalSecs) * time.Second)
+		if err := s.archiveStatements(cfg); err != nil {
+			log.Warn("Failed to archive statements", zap.Error(err))
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			cfg = dc.Statement
+			archive()
+		case <-timeCh:
+			archive()
+		}
+	}
+}
+
+// archiveStatements copies the finished summary intervals which have not been archived yet into the local store,
+// and removes the snapshots that exceed the retention.
+func (s *Service) archiveStatements(cfg config.StatementConfig) error {
+	// There is no user session in background, so that the SQL user authorized for SSO impersonation is used.
+	db, err := s.params.SSOService.OpenImpersonatedSQLConn()
+	if err != nil {
+		return err
+	}
+	defer utils.CloseTiDBConnection(db) //nolint:errcheck
+
+	var lastArchived int
+	err = s.params.LocalStore.
+		Model(&ArchiveModel{}).
+		Select("IFNULL(MAX(summary_begin_time), 0)").
+		Row().
+		Scan(&lastArchived)
+	if err != nil {
+		return err
+	}
+
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	if err != nil {
+		return err
+	}
+	// plans are large and are not needed by the statement list, so that they are not archived
+	reqFields := lo.FilterMap(getFieldsAndTags(), func(f Field, _ int) (string, bool) {
+		return f.JSONName, f.Aggregation != "" && f.JSONName != "plan" && f.JSONName != "binary_plan"
+	})
+	selectStmt, err := s.genSelectStmt(tableColumns, reqFields)
+	if err != nil {
+		return err
+	}
+
+	var rows []Model
+	err = db.
+		Select(selectStmt).
+		Table(statementsTable).
+		Where("summary_begin_time > FROM_UNIXTIME(?) AND summary_end_time <= NOW()", lastArchived).
+		Group("summary_begin_time, schema_name, digest, plan_digest").
+		Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	archives := make([]ArchiveModel, 0, len(rows))
+	for _, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		archives = append(archives, ArchiveModel{
+			SummaryBeginTime: row.AggBeginTime,
+			SummaryEndTime:   row.AggEndTime,
+			SchemaName:       row.AggSchemaName,
+			Digest:           row.AggDigest,
+			PlanDigest:       row.AggPlanDigest,
+			StmtType:         row.AggStmtType,
+			ResourceGroup:    row.AggResourceGroup,
+			TableNames:       row.AggTableNames,
+			DigestText:       row.AggDigestText,
+			Data:             string(data),
+		})
+	}
+	if len(archives) > 0 {
+		if err := s.params.LocalStore.CreateInBatches(archives, archiveBatchSize).Error; err != nil {
+			return err
+		}
+	}
+
+	expireTime := time.Now().Add(-time.Duration(cfg.ArchiveRetentionDays) * 24 * time.Hour).Unix()
+	return s.params.LocalStore.
+		Where("summary_end_time < ?", expireTime).
+		Delete(&ArchiveModel{}).Error
+}
+
+// archiveBoundary returns the begin time of the earliest summary interval that is still kept by TiDB. Intervals
+// before it can only be found in the archive.
+func archiveBoundary(db *gorm.DB) (int, error) {
+	var boundary int
+	err := db.
+		Table(statementsTable).
+		Select("IFNULL(FLOOR(UNIX_TIMESTAMP(MIN(summary_begin_time))), UNIX_TIMESTAMP())").
+		Row().
+		Scan(&boundary)
+	return boundary, err
+}
+
+// archivedStatement is an archived row with the fields kept in its archived data. Fields added to Model after
+// the row is archived are missing, and are not merged as zero values.
+type archivedStatement struct {
+	Model
+	fields fieldSet
+}
+
+// fieldSet is a set of json names of the fields which have values. All fields have values when the set is nil.
+type fieldSet map[string]struct{}
+
+func (s fieldSet) has(name string) bool {
+	if s == nil {
+		return true
+	}
+	_, ok := s[name]
+	return ok
+}
+
+// queryArchives reads the archived intervals overlapped with [beginTime, endTime] which are no longer kept by TiDB.
+// Nothing is returned if all of the requested intervals are kept by TiDB.
+func (s *Service) queryArchives(db *gorm.DB, beginTime, endTime int, filter func(*gorm.DB) *gorm.DB) ([]archivedStatement, error) {
+	// Skip querying the boundary from TiDB when nothing is archived in the range, e.g. archiving is disabled.
+	var archivedIDs []uint
+	err := s.params.LocalStore.
+		Model(&ArchiveModel{}).
+		Where("summary_begin_time <= ? AND summary_end_time >= ?", endTime, beginTime).
+		Limit(1).
+		Pluck("id", &archivedIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(archivedIDs) == 0 {
+		return nil, nil
+	}
+
+	boundary, err := archiveBoundary(db)
+	if err != nil {
+		return nil, err
+	}
+	if beginTime >= boundary {
+		return nil, nil
+	}
+
+	query := s.params.LocalStore.
+		Where("summary_begin_time < ?", boundary).
+		Where("summary_begin_time <= ? AND summary_end_time >= ?", endTime, beginTime)
+	if filter != nil {
+		query = filter(query)
+	}
+	var archives []ArchiveModel
+	if err := query.Find(&archives).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]archivedStatement, 0, len(archives))
+	for _, archive := range archives {
+		var row archivedStatement
+		if err := json.Unmarshal([]byte(archive.Data), &row.Model); err != nil {
+			return nil, err
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(archive.Data), &values); err != nil {
+			return nil, err
+		}
+		row.fields = make(fieldSet, len(values))
+		for name := range values {
+			row.fields[name] = struct{}{}
+		}
+		results = append(results, row)
+	}
+	return results, nil
+}
+
+// queryArchivedStatements reads the archived rows of the statement list.
+func (s *Service) queryArchivedStatements(
+	db *gorm.DB,
+	beginTime, endTime int,
+	schemas, resourceGroups, stmtTypes []string,
+	text string,
+) ([]archivedStatement, error) {
+	archived, err := s.queryArchives(db, beginTime, endTime, func(query *gorm.DB) *gorm.DB {
+		if len(resourceGroups) > 0 {
+			query = query.Where("resource_group in (?)", resourceGroups)
+		}
+		if len(stmtTypes) > 0 {
+			query = query.Where("stmt_type in (?)", stmtTypes)
+		}
+		return query
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filterArchivedStatements(archived, schemas, text), nil
+}
+
+// filterArchivedStatements applies the filters of the statement list which cannot be evaluated by the local store.
+func filterArchivedStatements(rows []archivedStatement, schemas []string, text string) []archivedStatement {
+	var schemaRegex *regexp.Regexp
+	if len(schemas) > 0 {
+		regex := make([]string, 0, len(schemas))
+		for _, schema := range schemas {
+			regex = append(regex, fmt.Sprintf("\\b%s\\.", regexp.QuoteMeta(schema)))
+		}
+		schemaRegex = regexp.MustCompile(strings.Join(regex, "|"))
+	}
+	words := strings.Fields(strings.ToLower(text))
+
+	return lo.Filter(rows, func(m archivedStatement, _ int) bool {
+		if schemaRegex != nil && !schemaRegex.MatchString(m.AggTableNames) {
+			return false
+		}
+		for _, word := range words {
+			matched := false
+			for _, v := range []string{m.AggDigestText, m.AggDigest, m.AggSchemaName, m.AggTableNames} {
+				if matchText(strings.ToLower(v), word) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// matchText behaves like the `REGEXP` operator in TiDB, and falls back to substring match for invalid patterns.
+func matchText(s string, pattern string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return strings.Contains(s, pattern)
+	}
+	return re.MatchString(s)
+}
+
+type mergeRule int
+
+const (
+	mergeByAnyValue mergeRule = iota
+	mergeBySum
+	mergeByMax
+	mergeByMin
+	mergeByExecCountAvg  // weighted by exec_count
+	mergeByCopTaskNumAvg // weighted by sum_cop_task_num
+	mergeByDistinctCount // count of distinct plan digests
+)
+
+// mergeRuleOf infers how to merge two aggregated values from the aggregation expression of the field.
+func mergeRuleOf(agg string) mergeRule {
+	a := strings.ToUpper(agg)
+	switch {
+	case strings.Contains(a, "/ SUM(SUM_COP_TASK_NUM)"):
+		return mergeByCopTaskNumAvg
+	case strings.Contains(a, "/ SUM(EXEC_COUNT)"), strings.HasPrefix(a, "CAST(AVG("):
+		return mergeByExecCountAvg
+	case strings.HasPrefix(a, "COUNT(DISTINCT"):
+		return mergeByDistinctCount
+	case strings.HasPrefix(a, "ANY_VALUE("):
+		return mergeByAnyValue
+	case strings.Contains(a, "MIN("):
+		return mergeByMin
+	case strings.Contains(a, "MAX("):
+		return mergeByMax
+	case strings.Contains(a, "SUM("):
+		return mergeBySum
+	default:
+		return mergeByAnyValue
+	}
+}
+
+type mergeField struct {
+	index int
+	name  string
+	rule  mergeRule
+}
+
+func mergeFieldsOf(fields []Field) []mergeField {
+	t := reflect.TypeOf(Model{})
+	indexByJSONName := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		indexByJSONName[t.Field(i).Tag.Get("json")] = i
+	}
+	return lo.FilterMap(fields, func(f Field, _ int) (mergeField, bool) {
+		idx, ok := indexByJSONName[f.JSONName]
+		return mergeField{index: idx, name: f.JSONName, rule: mergeRuleOf(f.Aggregation)}, ok && f.Aggregation != ""
+	})
+}
+
+// archiveAggregate is the aggregation of the archived rows with the same key.
+type archiveAggregate struct {
+	Model
+	fields fieldSet
+	// plan digests of the archived rows, used to count distinct plans
+	plans map[string]struct{}
+}
+
+// aggregateArchives aggregates the archived rows with the same key. The aggregations are returned in the order
+// of their first rows. Only `fields` are kept in the aggregations.
+func aggregateArchives(archived []archivedStatement, fields []mergeField, key func(m *Model) string) ([]*archiveAggregate, map[string]*archiveAggregate) {
+	aggs := make([]*archiveAggregate, 0)
+	aggByKey := make(map[string]*archiveAggregate)
+	for i := range archived {
+		row := &archived[i]
+		k := key(&row.Model)
+		agg, ok := aggByKey[k]
+		if !ok {
+			agg = &archiveAggregate{
+				Model:  projectModel(&row.Model, fields),
+				fields: cloneFieldSet(row.fields),
+				plans:  make(map[string]struct{}),
+			}
+			aggs = append(aggs, agg)
+			aggByKey[k] = agg
+		} else {
+			mergeModel(&agg.Model, agg.fields, &row.Model, row.fields, fields)
+		}
+		agg.plans[row.AggPlanDigest] = struct{}{}
+	}
+	if lo.ContainsBy(fields, func(f mergeField) bool { return f.rule == mergeByDistinctCount }) {
+		for _, agg := range aggs {
+			if len(agg.plans) > agg.AggPlanCount {
+				agg.AggPlanCount = len(agg.plans)
+			}
+		}
+	}
+	return aggs, aggByKey
+}
+
+// mergeArchiveAggregate merges the aggregation of archived rows into a row read from TiDB.
+func mergeArchiveAggregate(dst *Model, agg *archiveAggregate, fields []mergeField) {
+	mergeModel(dst, nil, &agg.Model, agg.fields, fields)
+	// The plans in TiDB and in the archive may overlap, so that the count is a lower bound.
+	if lo.ContainsBy(fields, func(f mergeField) bool { return f.rule == mergeByDistinctCount }) && agg.AggPlanCount > dst.AggPlanCount {
+		dst.AggPlanCount = agg.AggPlanCount
+	}
+}
+
+// mergeArchivedStatements merges the archived rows into the rows read from TiDB. Rows with the same key are
+// aggregated into one row. Only `fields` are kept in the archived rows, so that the merged rows are the same
+// as the rows read from TiDB.
+func mergeArchivedStatements(current []Model, archived []archivedStatement, fields []Field, key func(m *Model) string) []Model {
+	if len(archived) == 0 {
+		return current
+	}
+	mFields := mergeFieldsOf(fields)
+	aggs, aggByKey := aggregateArchives(archived, mFields, key)
+
+	results := make([]Model, 0, len(current)+len(aggs))
+	results = append(results, current...)
+	for i := range results {
+		k := key(&results[i])
+		if agg, ok := aggByKey[k]; ok {
+			mergeArchiveAggregate(&results[i], agg, mFields)
+			delete(aggByKey, k)
+		}
+	}
+	for _, agg := range aggs {
+		if _, ok := aggByKey[key(&agg.Model)]; ok {
+			results = append(results, agg.Model)
+		}
+	}
+	for i := range results {
+		_ = results[i].AfterFind(nil)
+	}
+	return results
+}
+
+func cloneFieldSet(s fieldSet) fieldSet {
+	if s == nil {
+		return nil
+	}
+	cloned := make(fieldSet, len(s))
+	for name := range s {
+		cloned[name] = struct{}{}
+	}
+	return cloned
+}
+
+func projectModel(src *Model, fields []mergeField) Model {
+	var dst Model
+	sv := reflect.ValueOf(src).Elem()
+	dv := reflect.ValueOf(&dst).Elem()
+	for _, f := range fields {
+		dv.Field(f.index).Set(sv.Field(f.index))
+	}
+	return dst
+}
+
+// mergeModel merges the fields of `src` into `dst`. Fields missing in `src` are skipped, and fields missing in
+// `dst` are copied from `src` and added into `dstFields`.
+func mergeModel(dst *Model, dstFields fieldSet, src *Model, srcFields fieldSet, fields []mergeField) {
+	// weights must be read before the sums are merged
+	dstExecCount, srcExecCount := float64(dst.AggExecCount), float64(src.AggExecCount)
+	dstCopTaskNum, srcCopTaskNum := float64(dst.AggSumCopTaskNum), float64(src.AggSumCopTaskNum)
+
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	for _, f := range fields {
+		d, s := dv.Field(f.index), sv.Field(f.index)
+		if !srcFields.has(f.name) {
+			continue
+		}
+		if !dstFields.has(f.name) {
+			d.Set(s)
+			dstFields[f.name] = struct{}{}
+			continue
+		}
+		switch f.rule {
+		case mergeByAnyValue:
+			if d.IsZero() {
+				d.Set(s)
+			}
+		case mergeBySum:
+			setNumber(d, number(d)+number(s))
+		case mergeByMax:
+			if number(s) > number(d) {
+				d.Set(s)
+			}
+		case mergeByMin:
+			if number(s) < number(d) {
+				d.Set(s)
+			}
+		case mergeByExecCountAvg:
+			setNumber(d, weightedAvg(number(d), dstExecCount, number(s), srcExecCount))
+		case mergeByCopTaskNumAvg:
+			setNumber(d, weightedAvg(number(d), dstCopTaskNum, number(s), srcCopTaskNum))
+		case mergeByDistinctCount:
+			// merged by the caller
+		}
+	}
+}
+
+func weightedAvg(v1, w1, v2, w2 float64) float64 {
+	if w1+w2 == 0 {
+		return (v1 + v2) / 2
+	}
+	return (v1*w1 + v2*w2) / (w1 + w2)
+}
+
+func number(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		return 0
+	}
+}
+
+func setNumber(v reflect.Value, n float64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(n)
+	default:
+	}
+}
+
+func sortStatementsBySumLatency(rows []Model) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].AggSumLatency > rows[j].AggSumLatency
+	})
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+)
+
+var _ = check.Suite(&testArchiveSuite{})
+
+type testArchiveSuite struct{}
+
+func (t *testArchiveSuite) Test_mergeRuleOf(c *check.C) {
+	c.Assert(mergeRuleOf("SUM(exec_count)"), check.Equals, mergeBySum)
+	c.Assert(mergeRuleOf("MAX(max_latency)"), check.Equals, mergeByMax)
+	c.Assert(mergeRuleOf("Max(MAX_QUEUED_RC_TIME)"), check.Equals, mergeByMax)
+	c.Assert(mergeRuleOf("FLOOR(UNIX_TIMESTAMP(MIN(summary_begin_time)))"), check.Equals, mergeByMin)
+	c.Assert(mergeRuleOf("ANY_VALUE(digest_text)"), check.Equals, mergeByAnyValue)
+	c.Assert(mergeRuleOf("COUNT(DISTINCT plan_digest)"), check.Equals, mergeByDistinctCount)
+	c.Assert(mergeRuleOf("CAST(SUM(exec_count * avg_latency) / SUM(exec_count) AS SIGNED)"), check.Equals, mergeByExecCountAvg)
+	c.Assert(mergeRuleOf("CAST(SUM(exec_count * avg_process_time) / SUM(sum_cop_task_num) AS SIGNED)"), check.Equals, mergeByCopTaskNumAvg)
+	c.Assert(mergeRuleOf("CAST(SUM(exec_count * (avg_request_unit_write + avg_request_unit_read)) AS DECIMAL(64, 2))"), check.Equals, mergeBySum)
+}
+
+func (t *testArchiveSuite) Test_mergeArchivedStatements(c *check.C) {
+	fields, err := selectFields(
+		[]string{"schema_name", "digest", "plan_digest", "exec_count", "sum_latency", "max_latency", "avg_latency", "summary_begin_time", "summary_end_time"},
+		[]string{"exec_count", "max_latency", "avg_latency", "plan_count"})
+	c.Assert(err, check.IsNil)
+
+	current := []Model{
+		{AggSchemaName: "test", AggDigest: "a", AggBeginTime: 200, AggEndTime: 300, AggExecCount: 10, AggSumLatency: 1000, AggMaxLatency: 200, AggAvgLatency: 100, AggPlanCount: 1},
+	}
+	archived := []archivedStatement{
+		{Model: Model{AggSchemaName: "test", AggDigest: "a", AggPlanDigest: "p1", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 30, AggSumLatency: 6000, AggMaxLatency: 300, AggAvgLatency: 200}},
+		{Model: Model{AggSchemaName: "test", AggDigest: "b", AggPlanDigest: "p1", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 1, AggSumLatency: 10, AggMaxLatency: 10, AggAvgLatency: 10, AggDigestText: "select 1"}},
+		{Model: Model{AggSchemaName: "test", AggDigest: "b", AggPlanDigest: "p2", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 1, AggSumLatency: 30, AggMaxLatency: 30, AggAvgLatency: 30}},
+	}
+
+	results := mergeArchivedStatements(current, archived, fields, func(m *Model) string {
+		return m.AggSchemaName + "." + m.AggDigest
+	})
+	sortStatementsBySumLatency(results)
+	c.Assert(results, check.HasLen, 2)
+
+	c.Assert(results[0].AggDigest, check.Equals, "a")
+	c.Assert(results[0].AggBeginTime, check.Equals, 100)
+	c.Assert(results[0].AggEndTime, check.Equals, 300)
+	c.Assert(results[0].AggExecCount, check.Equals, 40)
+	c.Assert(results[0].AggSumLatency, check.Equals, 7000)
+	c.Assert(results[0].AggMaxLatency, check.Equals, 300)
+	c.Assert(results[0].AggAvgLatency, check.Equals, 175)
+	c.Assert(results[0].AggPlanCount, check.Equals, 1)
+
+	c.Assert(results[1].AggDigest, check.Equals, "b")
+	c.Assert(results[1].AggExecCount, check.Equals, 2)
+	c.Assert(results[1].AggAvgLatency, check.Equals, 20)
+	c.Assert(results[1].AggPlanCount, check.Equals, 2)
+	// not requested
+	c.Assert(results[1].AggDigestText, check.Equals, "")
+}
+
+func (t *testArchiveSuite) Test_mergeArchivedStatementsMin(c *check.C) {
+	fields, err := selectFields(
+		[]string{"schema_name", "digest", "exec_count", "min_latency", "summary_begin_time", "summary_end_time"},
+		[]string{"exec_count", "min_latency"})
+	c.Assert(err, check.IsNil)
+	key := func(m *Model) string {
+		return m.AggDigest
+	}
+	archivedFields := fieldSet{"digest": {}, "exec_count": {}, "summary_begin_time": {}, "summary_end_time": {}, "min_latency": {}}
+	// the field is missing in the data archived before it is added
+	archivedFieldsWithoutMin := fieldSet{"digest": {}, "exec_count": {}, "summary_begin_time": {}, "summary_end_time": {}}
+
+	current := []Model{
+		{AggDigest: "a", AggBeginTime: 200, AggEndTime: 300, AggExecCount: 1, AggMinLatency: 0},
+		{AggDigest: "b", AggBeginTime: 200, AggEndTime: 300, AggExecCount: 1, AggMinLatency: 50},
+	}
+	archived := []archivedStatement{
+		{Model: Model{AggDigest: "a", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 1, AggMinLatency: 10}, fields: archivedFields},
+		{Model: Model{AggDigest: "b", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 1}, fields: archivedFieldsWithoutMin},
+		{Model: Model{AggDigest: "c", AggBeginTime: 0, AggEndTime: 100, AggExecCount: 1}, fields: archivedFieldsWithoutMin},
+		{Model: Model{AggDigest: "c", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 1, AggMinLatency: 20}, fields: archivedFields},
+		{Model: Model{AggDigest: "c", AggBeginTime: 200, AggEndTime: 300, AggExecCount: 1, AggMinLatency: 30}, fields: archivedFields},
+	}
+
+	results := mergeArchivedStatements(current, archived, fields, key)
+	c.Assert(results, check.HasLen, 3)
+	// a zero value is a valid minimum
+	c.Assert(results[0].AggMinLatency, check.Equals, 0)
+	c.Assert(results[0].AggBeginTime, check.Equals, 100)
+	// a missing value is not merged as zero
+	c.Assert(results[1].AggMinLatency, check.Equals, 50)
+	c.Assert(results[2].AggDigest, check.Equals, "c")
+	c.Assert(results[2].AggMinLatency, check.Equals, 20)
+	c.Assert(results[2].AggBeginTime, check.Equals, 0)
+	c.Assert(results[2].AggExecCount, check.Equals, 3)
+	// the field set of the archived row is not changed by merging
+	c.Assert(archivedFieldsWithoutMin.has("min_latency"), check.IsFalse)
+}
+
+func (t *testArchiveSuite) Test_filterArchivedStatements(c *check.C) {
+	rows := []archivedStatement{
+		{Model: Model{AggDigest: "a", AggTableNames: "test.t1,other.t2", AggDigestText: "select * from t1 join t2"}},
+		{Model: Model{AggDigest: "b", AggTableNames: "other.t3", AggDigestText: "select * from t3"}},
+	}
+	c.Assert(filterArchivedStatements(rows, nil, ""), check.HasLen, 2)
+	c.Assert(filterArchivedStatements(rows, []string{"test"}, ""), check.HasLen, 1)
+	c.Assert(filterArchivedStatements(rows, []string{"other"}, "T3"), check.HasLen, 1)
+	c.Assert(filterArchivedStatements(rows, nil, "select join"), check.HasLen, 1)
+	c.Assert(filterArchivedStatements(rows, nil, "t4"), check.HasLen, 0)
+}
+
+func (t *testArchiveSuite) Test_queryArchivesNothingArchived(c *check.C) {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")))
+	c.Assert(err, check.IsNil)
+	localStore := &dbstore.DB{DB: gormDB}
+	c.Assert(autoMigrate(localStore), check.IsNil)
+	s := &Service{params: ServiceParams{LocalStore: localStore}}
+	c.Assert(localStore.Create(&ArchiveModel{SummaryBeginTime: 100, SummaryEndTime: 200, Data: "{}"}).Error, check.IsNil)
+
+	// TiDB is not queried when nothing is archived in the range, so that no connection is needed.
+	archives, err := s.queryArchives(nil, 300, 400, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(archives, check.HasLen, 0)
+}
+
+func (t *testArchiveSuite) Test_streamStatementsMergesArchives(c *check.C) {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")))
+	c.Assert(err, check.IsNil)
+	localStore := &dbstore.DB{DB: gormDB}
+	c.Assert(autoMigrate(localStore), check.IsNil)
+	for _, m := range []Model{
+		{AggSchemaName: "test", AggDigest: "a", AggPlanDigest: "p1", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 30, AggSumLatency: 6000},
+		{AggSchemaName: "test", AggDigest: "b", AggPlanDigest: "p1", AggBeginTime: 100, AggEndTime: 200, AggExecCount: 1, AggSumLatency: 10},
+	} {
+		data, err := json.Marshal(m)
+		c.Assert(err, check.IsNil)
+		c.Assert(localStore.Create(&ArchiveModel{
+			SummaryBeginTime: m.AggBeginTime,
+			SummaryEndTime:   m.AggEndTime,
+			SchemaName:       m.AggSchemaName,
+			Digest:           m.AggDigest,
+			Data:             string(data),
+		}).Error, check.IsNil)
+	}
+
+	sqlDB, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}))
+	c.Assert(err, check.IsNil)
+	mock.ExpectQuery("MIN\\(summary_begin_time\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"boundary"}).AddRow(200))
+	columns := sqlmock.NewRows([]string{"Field"})
+	for _, col := range []string{"schema_name", "digest", "plan_digest", "exec_count", "sum_latency", "summary_begin_time", "summary_end_time"} {
+		columns.AddRow(col)
+	}
+	mock.ExpectQuery("DESC " + statementsTable).WillReturnRows(columns)
+	mock.ExpectQuery("SELECT .* GROUP BY schema_name, digest").
+		WillReturnRows(sqlmock.NewRows([]string{"agg_schema_name", "agg_digest", "agg_exec_count", "agg_sum_latency", "agg_begin_time", "agg_end_time"}).
+			AddRow("test", "a", 10, 1000, 200, 300))
+
+	s := &Service{params: ServiceParams{LocalStore: localStore, SysSchema: commonUtils.NewSysSchema()}}
+	var results []Model
+	err = s.streamStatements(db, 100, 300, nil, nil, nil, "", []string{"exec_count"}, func(m *Model) error {
+		results = append(results, *m)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	c.Assert(results, check.HasLen, 2)
+	c.Assert(results[0].AggDigest, check.Equals, "a")
+	c.Assert(results[0].AggExecCount, check.Equals, 40)
+	c.Assert(results[0].AggSumLatency, check.Equals, 7000)
+	c.Assert(results[0].AggBeginTime, check.Equals, 100)
+	// the statement only found in the archive is called at last
+	c.Assert(results[1].AggDigest, check.Equals, "b")
+	c.Assert(results[1].AggExecCount, check.Equals, 1)
+}
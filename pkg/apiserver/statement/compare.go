@@ -0,0 +1,218 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"math"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+const defaultRegressionRatio = 0.2
+
+type CompareStatus string
+
+const (
+	CompareStatusNew         CompareStatus = "new"
+	CompareStatusDisappeared CompareStatus = "disappeared"
+	CompareStatusRegressed   CompareStatus = "regressed"
+	CompareStatusImproved    CompareStatus = "improved"
+	CompareStatusUnchanged   CompareStatus = "unchanged"
+)
+
+var compareFields = []string{
+	"digest",
+	"digest_text",
+	"schema_name",
+	"exec_count",
+	"sum_latency",
+	"avg_latency",
+	"max_latency",
+	"avg_mem",
+	"max_mem",
+	"plan_count",
+}
+
+type CompareMetrics struct {
+	ExecCount  int `json:"exec_count"`
+	SumLatency int `json:"sum_latency"`
+	AvgLatency int `json:"avg_latency"`
+	MaxLatency int `json:"max_latency"`
+	AvgMem     int `json:"avg_mem"`
+	MaxMem     int `json:"max_mem"`
+	PlanCount  int `json:"plan_count"`
+}
+
+func newCompareMetrics(m *Model) *CompareMetrics {
+	return &CompareMetrics{
+		ExecCount:  m.AggExecCount,
+		SumLatency: m.AggSumLatency,
+		AvgLatency: m.AggAvgLatency,
+		MaxLatency: m.AggMaxLatency,
+		AvgMem:     m.AggAvgMem,
+		MaxMem:     m.AggMaxMem,
+		PlanCount:  m.AggPlanCount,
+	}
+}
+
+// CompareDelta holds the relative change from the baseline to the target window.
+// A positive value means the target is larger, e.g. 0.5 means +50%, and a negative
+// value means the target is smaller, e.g. -0.5 means the baseline is 50% larger.
+type CompareDelta struct {
+	AvgLatency float64 `json:"avg_latency"`
+	MaxLatency float64 `json:"max_latency"`
+	ExecCount  float64 `json:"exec_count"`
+	AvgMem     float64 `json:"avg_mem"`
+	PlanCount  float64 `json:"plan_count"`
+}
+
+type CompareResult struct {
+	SchemaName string          `json:"schema_name"`
+	Digest     string          `json:"digest"`
+	DigestText string          `json:"digest_text"`
+	Status     CompareStatus   `json:"status" enums:"new,disappeared,regressed,improved,unchanged"`
+	Baseline   *CompareMetrics `json:"baseline"`
+	Target     *CompareMetrics `json:"target"`
+	Delta      CompareDelta    `json:"delta"`
+}
+
+func (s *Service) compareStatements(db *gorm.DB, req *CompareStatementsRequest) ([]CompareResult, error) {
+	baseline, err := s.queryStatements(
+		db,
+		req.BaselineBeginTime, req.BaselineEndTime,
+		req.Schemas,
+		req.ResourceGroups,
+		req.StmtTypes,
+		req.Text,
+		compareFields)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.queryStatements(
+		db.Session(&gorm.Session{NewDB: true}),
+		req.TargetBeginTime, req.TargetEndTime,
+		req.Schemas,
+		req.ResourceGroups,
+		req.StmtTypes,
+		req.Text,
+		compareFields)
+	if err != nil {
+		return nil, err
+	}
+	ratio := req.RegressionRatio
+	if ratio <= 0 {
+		ratio = defaultRegressionRatio
+	}
+	return diffStatements(baseline, target, ratio), nil
+}
+
+type statementKey struct {
+	schemaName string
+	digest     string
+}
+
+// diffStatements joins the baseline and target statements by (schema, digest) and
+// returns the results ordered by the most significant latency change first.
+func diffStatements(baseline, target []Model, regressionRatio float64) []CompareResult {
+	results := make([]CompareResult, 0, len(target))
+	resultIdx := make(map[statementKey]int, len(target))
+	for i := range target {
+		m := &target[i]
+		key := statementKey{schemaName: m.AggSchemaName, digest: m.AggDigest}
+		resultIdx[key] = len(results)
+		results = append(results, CompareResult{
+			SchemaName: m.AggSchemaName,
+			Digest:     m.AggDigest,
+			DigestText: m.AggDigestText,
+			Status:     CompareStatusNew,
+			Target:     newCompareMetrics(m),
+		})
+	}
+	for i := range baseline {
+		m := &baseline[i]
+		key := statementKey{schemaName: m.AggSchemaName, digest: m.AggDigest}
+		idx, ok := resultIdx[key]
+		if !ok {
+			results = append(results, CompareResult{
+				SchemaName: m.AggSchemaName,
+				Digest:     m.AggDigest,
+				DigestText: m.AggDigestText,
+				Status:     CompareStatusDisappeared,
+				Baseline:   newCompareMetrics(m),
+			})
+			continue
+		}
+		r := &results[idx]
+		r.Baseline = newCompareMetrics(m)
+		r.Delta = CompareDelta{
+			AvgLatency: diffRatio(r.Baseline.AvgLatency, r.Target.AvgLatency),
+			MaxLatency: diffRatio(r.Baseline.MaxLatency, r.Target.MaxLatency),
+			ExecCount:  diffRatio(r.Baseline.ExecCount, r.Target.ExecCount),
+			AvgMem:     diffRatio(r.Baseline.AvgMem, r.Target.AvgMem),
+			PlanCount:  diffRatio(r.Baseline.PlanCount, r.Target.PlanCount),
+		}
+		switch {
+		case r.Delta.AvgLatency >= regressionRatio:
+			r.Status = CompareStatusRegressed
+		case r.Delta.AvgLatency <= -regressionRatio:
+			r.Status = CompareStatusImproved
+		default:
+			r.Status = CompareStatusUnchanged
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		ri, rj := compareStatusRank(results[i].Status), compareStatusRank(results[j].Status)
+		if ri != rj {
+			return ri < rj
+		}
+		abs1 := math.Abs(results[i].Delta.AvgLatency)
+		abs2 := math.Abs(results[j].Delta.AvgLatency)
+		if abs1 != abs2 {
+			return abs1 > abs2
+		}
+		return results[i].sumLatency() > results[j].sumLatency()
+	})
+	return results
+}
+
+func compareStatusRank(s CompareStatus) int {
+	switch s {
+	case CompareStatusRegressed:
+		return 0
+	case CompareStatusNew:
+		return 1
+	case CompareStatusDisappeared:
+		return 2
+	case CompareStatusImproved:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func (r *CompareResult) sumLatency() int {
+	if r.Target != nil {
+		return r.Target.SumLatency
+	}
+	return r.Baseline.SumLatency
+}
+
+// diffRatio follows the same convention as the diagnose compare report, so that
+// increases and decreases of the same magnitude have the same absolute ratio.
+func diffRatio(v1, v2 int) float64 {
+	f1, f2 := float64(v1), float64(v2)
+	switch {
+	case f1 == f2:
+		return 0
+	case f1 == 0:
+		return f2
+	case f2 == 0:
+		return -f1
+	case f2 > f1:
+		return f2/f1 - 1
+	default:
+		return 1 - f1/f2
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testCompareSuite{})
+
+type testCompareSuite struct{}
+
+func (t *testCompareSuite) Test_diffRatio(c *check.C) {
+	c.Assert(diffRatio(100, 100), check.Equals, 0.0)
+	c.Assert(diffRatio(100, 150), check.Equals, 0.5)
+	c.Assert(diffRatio(150, 100), check.Equals, -0.5)
+	c.Assert(diffRatio(0, 3), check.Equals, 3.0)
+	c.Assert(diffRatio(3, 0), check.Equals, -3.0)
+}
+
+func (t *testCompareSuite) Test_diffStatements(c *check.C) {
+	baseline := []Model{
+		{AggSchemaName: "test", AggDigest: "a", AggAvgLatency: 100, AggSumLatency: 1000, AggExecCount: 10, AggPlanCount: 1},
+		{AggSchemaName: "test", AggDigest: "b", AggAvgLatency: 100, AggSumLatency: 1000, AggExecCount: 10, AggPlanCount: 1},
+		{AggSchemaName: "test", AggDigest: "c", AggAvgLatency: 200, AggSumLatency: 2000, AggExecCount: 10, AggPlanCount: 1},
+		{AggSchemaName: "test", AggDigest: "d", AggAvgLatency: 100, AggSumLatency: 1000, AggExecCount: 10, AggPlanCount: 1},
+	}
+	target := []Model{
+		{AggSchemaName: "test", AggDigest: "a", AggAvgLatency: 110, AggSumLatency: 1100, AggExecCount: 10, AggPlanCount: 1},
+		{AggSchemaName: "test", AggDigest: "b", AggAvgLatency: 300, AggSumLatency: 3000, AggExecCount: 10, AggPlanCount: 2},
+		{AggSchemaName: "test", AggDigest: "c", AggAvgLatency: 100, AggSumLatency: 1000, AggExecCount: 10, AggPlanCount: 1},
+		{AggSchemaName: "other", AggDigest: "d", AggAvgLatency: 100, AggSumLatency: 1000, AggExecCount: 10, AggPlanCount: 1},
+	}
+
+	results := diffStatements(baseline, target, 0.2)
+	c.Assert(results, check.HasLen, 5)
+
+	c.Assert(results[0].Digest, check.Equals, "b")
+	c.Assert(results[0].Status, check.Equals, CompareStatusRegressed)
+	c.Assert(results[0].Delta.AvgLatency, check.Equals, 2.0)
+	c.Assert(results[0].Delta.PlanCount, check.Equals, 1.0)
+
+	c.Assert(results[1].SchemaName, check.Equals, "other")
+	c.Assert(results[1].Status, check.Equals, CompareStatusNew)
+	c.Assert(results[1].Baseline, check.IsNil)
+
+	c.Assert(results[2].SchemaName, check.Equals, "test")
+	c.Assert(results[2].Digest, check.Equals, "d")
+	c.Assert(results[2].Status, check.Equals, CompareStatusDisappeared)
+	c.Assert(results[2].Target, check.IsNil)
+
+	c.Assert(results[3].Digest, check.Equals, "c")
+	c.Assert(results[3].Status, check.Equals, CompareStatusImproved)
+
+	c.Assert(results[4].Digest, check.Equals, "a")
+	c.Assert(results[4].Status, check.Equals, CompareStatusUnchanged)
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+// EXPLAIN ANALYZE executes the statement, which is stopped if it runs longer than this.
+const explainAnalyzeTimeout = 60 * time.Second
+
+var ErrNoSampleQuery = ErrNS.NewType("no_sample_query")
+
+// TiDB appends the original length to the sample query when it exceeds `tidb_stmt_summary_max_sql_length`.
+var truncatedSampleChecker = regexp.MustCompile(`\(len:\d+\)$`)
+
+type ExplainResult struct {
+	QuerySampleText string `json:"query_sample_text"`
+	Analyzed        bool   `json:"analyzed"`
+	BinaryPlanJSON  string `json:"binary_plan_json"`
+	BinaryPlanText  string `json:"binary_plan_text"`
+}
+
+func buildExplainStmt(sample string, analyze bool) (string, error) {
+	sample = strings.TrimSpace(sample)
+	if sample == "" {
+		return "", ErrNoSampleQuery.New("sample query is not available")
+	}
+	if truncatedSampleChecker.MatchString(sample) {
+		return "", ErrNoSampleQuery.New("sample query is truncated")
+	}
+	if analyze {
+		return "EXPLAIN ANALYZE FORMAT = 'binary' " + sample, nil
+	}
+	return "EXPLAIN FORMAT = 'binary' " + sample, nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// explainPlan runs EXPLAIN (or EXPLAIN ANALYZE) for the sample query of a plan, so that the current plan can be
+// compared with the historical one. EXPLAIN ANALYZE executes the statement in a transaction which is always rolled
+// back, so that DML statements do not take effect.
+func (s *Service) explainPlan(db *gorm.DB, req *ExplainPlanRequest) (*ExplainResult, error) {
+	detail, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, []string{req.PlanDigest})
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := buildExplainStmt(detail.AggQuerySampleText, req.Analyze)
+	if err != nil {
+		return nil, err
+	}
+
+	var binaryPlan string
+	// USE and BEGIN are session states, so that all statements must be executed in the same connection.
+	err = db.Connection(func(conn *gorm.DB) error {
+		if detail.AggSchemaName != "" {
+			if err := conn.Exec("USE " + quoteIdentifier(detail.AggSchemaName)).Error; err != nil {
+				return err
+			}
+		}
+		if !req.Analyze {
+			return conn.Raw(stmt).Row().Scan(&binaryPlan)
+		}
+		// max_execution_time only applies to read-only statements, others are stopped by the deadline, after which
+		// the connection is closed and the transaction is rolled back.
+		if err := conn.Exec(fmt.Sprintf("SET SESSION max_execution_time = %d", explainAnalyzeTimeout.Milliseconds())).Error; err != nil {
+			return err
+		}
+		if err := conn.Exec("BEGIN").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("ROLLBACK")
+		ctx, cancel := context.WithTimeout(conn.Statement.Context, explainAnalyzeTimeout)
+		defer cancel()
+		return conn.WithContext(ctx).Raw(stmt).Row().Scan(&binaryPlan)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExplainResult{
+		QuerySampleText: detail.AggQuerySampleText,
+		Analyzed:        req.Analyze,
+	}
+	result.BinaryPlanJSON, err = utils.GenerateBinaryPlanJSON(binaryPlan)
+	if err != nil {
+		return nil, err
+	}
+	// may failed but it's ok
+	result.BinaryPlanText, _ = utils.GenerateBinaryPlanText(db, binaryPlan)
+	return result, nil
+}
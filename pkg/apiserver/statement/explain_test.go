@@ -0,0 +1,31 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testExplainSuite{})
+
+type testExplainSuite struct{}
+
+func (t *testExplainSuite) Test_buildExplainStmt(c *check.C) {
+	stmt, err := buildExplainStmt(" select * from t where a = 1 ", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(stmt, check.Equals, "EXPLAIN FORMAT = 'binary' select * from t where a = 1")
+
+	stmt, err = buildExplainStmt("select * from t where a = 1", true)
+	c.Assert(err, check.IsNil)
+	c.Assert(stmt, check.Equals, "EXPLAIN ANALYZE FORMAT = 'binary' select * from t where a = 1")
+
+	_, err = buildExplainStmt("", false)
+	c.Assert(err, check.NotNil)
+	_, err = buildExplainStmt("select * from t where a in (1, 2, 3(len:4096)", false)
+	c.Assert(err, check.NotNil)
+}
+
+func (t *testExplainSuite) Test_quoteIdentifier(c *check.C) {
+	c.Assert(quoteIdentifier("test"), check.Equals, "`test`")
+	c.Assert(quoteIdentifier("a`b"), check.Equals, "`a``b`")
+}
@@ -0,0 +1,376 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	simplejson "github.com/bitly/go-simplejson"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+const (
+	defaultIndexAdviceLimit = 100
+	maxIndexAdviceColumns   = 4
+	maxIndexNameLength      = 64
+	hypoIndexPrefix         = "hypo_"
+)
+
+// conditionColumnChecker matches conditions on a single column, e.g. `eq(test.t.a, 1)` or `in(test.t.a, 1, 2)`.
+// Conditions on expressions such as `eq(cast(test.t.a, double BINARY), 1)` are not matched since they cannot use
+// an index on the column.
+var conditionColumnChecker = regexp.MustCompile(`(not\()?\b(eq|in|isnull|gt|ge|lt|le)\(([\w$]+\.[\w$]+\.[\w$]+)[,)]`)
+
+type IndexAdviceDigest struct {
+	SchemaName string   `json:"schema_name"`
+	Digest     string   `json:"digest"`
+	DigestText string   `json:"digest_text"`
+	PlanDigest string   `json:"plan_digest"`
+	SumLatency int      `json:"sum_latency"`
+	ExecCount  int      `json:"exec_count"`
+	AvgLatency int      `json:"avg_latency"`
+	IndexNames string   `json:"index_names"` // indexes used by the statement currently
+	Diagnosis  []string `json:"diagnosis"`   // diagnosis of the full table scan in the plan
+
+	querySampleText string
+}
+
+type HypoIndexVerification struct {
+	// Whether the optimizer chooses the hypothetical index for the sample query of the top digest.
+	UsedByPlan bool   `json:"used_by_plan"`
+	Digest     string `json:"digest"`
+	Error      string `json:"error,omitempty"`
+}
+
+type IndexAdvice struct {
+	Database     string              `json:"database"`
+	Table        string              `json:"table"`
+	Columns      []string            `json:"columns"`
+	CreateStmt   string              `json:"create_stmt"`
+	SumLatency   int                 `json:"sum_latency"`
+	LatencyShare float64             `json:"latency_share"` // share of sum_latency of all statements in the time range
+	Digests      []IndexAdviceDigest `json:"digests"`
+
+	Verification *HypoIndexVerification `json:"verification,omitempty"`
+}
+
+// fullScanCandidate is a full table scan with filters found in a plan.
+type fullScanCandidate struct {
+	database  string
+	table     string
+	columns   []string
+	diagnosis []string
+}
+
+func (s *Service) queryIndexAdvice(db *gorm.DB, req *GetIndexAdviceRequest) ([]IndexAdvice, error) {
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	if err != nil {
+		return nil, err
+	}
+	selectStmt, err := s.genSelectStmt(tableColumns, []string{
+		"digest_text",
+		"plan_digest",
+		"exec_count",
+		"avg_latency",
+		"table_names",
+		"index_names",
+		"binary_plan",
+		"query_sample_text",
+	})
+	if err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultIndexAdviceLimit
+	}
+	query := db.
+		Select(selectStmt).
+		Table(statementsTable).
+		Where("summary_begin_time <= FROM_UNIXTIME(?) AND summary_end_time >= FROM_UNIXTIME(?)", req.EndTime, req.BeginTime).
+		Where("digest IS NOT NULL").
+		Group("schema_name, digest, plan_digest").
+		Order("agg_sum_latency DESC").
+		Limit(limit)
+	if len(req.Schemas) > 0 {
+		query = query.Where("schema_name IN (?)", req.Schemas)
+	}
+	var rows []Model
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var totalLatency int
+	err = db.
+		Table(statementsTable).
+		Select("IFNULL(SUM(sum_latency), 0)").
+		Where("summary_begin_time <= FROM_UNIXTIME(?) AND summary_end_time >= FROM_UNIXTIME(?)", req.EndTime, req.BeginTime).
+		Row().
+		Scan(&totalLatency)
+	if err != nil {
+		return nil, err
+	}
+
+	advices := buildIndexAdvice(rows, totalLatency)
+	if req.Verify {
+		for i := range advices {
+			advices[i].Verification = verifyIndexAdvice(db, &advices[i])
+		}
+	}
+	return advices, nil
+}
+
+// buildIndexAdvice proposes an index for each filtered full table scan found in the plans. The candidate index
+// contains the columns compared by equality first, and then a column compared by range.
+func buildIndexAdvice(rows []Model, totalLatency int) []IndexAdvice {
+	advices := make([]IndexAdvice, 0)
+	idxByKey := make(map[string]int)
+	for _, row := range rows {
+		if row.AggBinaryPlan == "" {
+			continue
+		}
+		planJSON, err := utils.GenerateBinaryPlanJSON(row.AggBinaryPlan)
+		if err != nil || planJSON == "" {
+			continue
+		}
+		plan, err := simplejson.NewJson([]byte(planJSON))
+		if err != nil || plan.Get(utils.DiscardedDueToTooLong).MustBool() {
+			continue
+		}
+		candidates := findFullScanCandidates(plan.Get(utils.MainTree), nil)
+		ctes := plan.Get(utils.CteTrees)
+		for i := range ctes.MustArray() {
+			candidates = append(candidates, findFullScanCandidates(ctes.GetIndex(i), nil)...)
+		}
+
+		for _, c := range candidates {
+			key := strings.Join(append([]string{c.database, c.table}, c.columns...), ".")
+			idx, ok := idxByKey[key]
+			if !ok {
+				idx = len(advices)
+				idxByKey[key] = idx
+				advices = append(advices, IndexAdvice{
+					Database: c.database,
+					Table:    c.table,
+					Columns:  c.columns,
+				})
+			}
+			advices[idx].Digests = append(advices[idx].Digests, IndexAdviceDigest{
+				SchemaName:      row.AggSchemaName,
+				Digest:          row.AggDigest,
+				DigestText:      row.AggDigestText,
+				PlanDigest:      row.AggPlanDigest,
+				SumLatency:      row.AggSumLatency,
+				ExecCount:       row.AggExecCount,
+				AvgLatency:      row.AggAvgLatency,
+				IndexNames:      row.AggIndexNames,
+				Diagnosis:       c.diagnosis,
+				querySampleText: row.AggQuerySampleText,
+			})
+		}
+	}
+
+	advices = mergePrefixIndexAdvice(advices)
+	for i := range advices {
+		a := &advices[i]
+		// a plan may contain multiple full table scans on the same table
+		a.Digests = lo.UniqBy(a.Digests, func(d IndexAdviceDigest) string {
+			return d.SchemaName + "." + d.Digest + "." + d.PlanDigest
+		})
+		sort.SliceStable(a.Digests, func(i, j int) bool {
+			return a.Digests[i].SumLatency > a.Digests[j].SumLatency
+		})
+		a.SumLatency = lo.SumBy(a.Digests, func(d IndexAdviceDigest) int { return d.SumLatency })
+		if totalLatency > 0 {
+			a.LatencyShare = float64(a.SumLatency) / float64(totalLatency)
+		}
+		a.CreateStmt = fmt.Sprintf("CREATE INDEX %s ON %s.%s (%s)",
+			quoteIdentifier(indexName("idx_", a.Columns)),
+			quoteIdentifier(a.Database),
+			quoteIdentifier(a.Table),
+			strings.Join(lo.Map(a.Columns, func(c string, _ int) string { return quoteIdentifier(c) }), ", "))
+	}
+	sort.SliceStable(advices, func(i, j int) bool {
+		return advices[i].SumLatency > advices[j].SumLatency
+	})
+	return advices
+}
+
+// mergePrefixIndexAdvice merges the advice into another advice of the same table whose columns start with the
+// columns of the former one, since the latter index can also be used by the digests of the former one.
+func mergePrefixIndexAdvice(advices []IndexAdvice) []IndexAdvice {
+	sort.SliceStable(advices, func(i, j int) bool {
+		return len(advices[i].Columns) > len(advices[j].Columns)
+	})
+	results := make([]IndexAdvice, 0, len(advices))
+	for _, a := range advices {
+		merged := false
+		for i := range results {
+			r := &results[i]
+			if r.Database == a.Database && r.Table == a.Table && len(r.Columns) >= len(a.Columns) &&
+				strings.Join(r.Columns[:len(a.Columns)], ",") == strings.Join(a.Columns, ",") {
+				r.Digests = append(r.Digests, a.Digests...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			results = append(results, a)
+		}
+	}
+	return results
+}
+
+func findFullScanCandidates(node *simplejson.Json, parent *simplejson.Json) []fullScanCandidate {
+	var candidates []fullScanCandidate
+	name := node.Get(utils.OperatorName).MustString()
+	if strings.HasPrefix(name, "TableFullScan") && parent != nil &&
+		strings.HasPrefix(parent.Get(utils.OperatorName).MustString(), "Selection") &&
+		len(parent.Get(utils.Children).MustArray()) == 1 &&
+		node.Get(utils.StoreType).MustString() == "tikv" {
+		if c, ok := newFullScanCandidate(node, parent); ok {
+			candidates = append(candidates, c)
+		}
+	}
+
+	children := node.Get(utils.Children)
+	for i := range children.MustArray() {
+		candidates = append(candidates, findFullScanCandidates(children.GetIndex(i), node)...)
+	}
+	return candidates
+}
+
+func newFullScanCandidate(scan *simplejson.Json, selection *simplejson.Json) (fullScanCandidate, bool) {
+	var database, table string
+	accessObjects := scan.Get(utils.AccessObjects)
+	for i := range accessObjects.MustArray() {
+		obj := accessObjects.GetIndex(i).Get(utils.ScanObject)
+		if obj.Get("database").MustString() != "" {
+			database = obj.Get("database").MustString()
+			table = obj.Get("table").MustString()
+			break
+		}
+	}
+	switch strings.ToLower(database) {
+	case "", "information_schema", "metrics_schema", "performance_schema", "mysql":
+		return fullScanCandidate{}, false
+	}
+
+	columns := extractIndexColumns(selection.Get(utils.OperatorInfo).MustString(), database, table)
+	if len(columns) == 0 {
+		return fullScanCandidate{}, false
+	}
+	diagnosis := append(
+		selection.Get(utils.Diagnosis).MustStringArray(),
+		scan.Get(utils.Diagnosis).MustStringArray()...)
+	return fullScanCandidate{
+		database:  database,
+		table:     table,
+		columns:   columns,
+		diagnosis: lo.Uniq(diagnosis),
+	}, true
+}
+
+// extractIndexColumns returns the columns of `database.table` used by the conditions, where the columns compared
+// by equality come first, followed by at most one column compared by range.
+// For example: `eq(test.t.a, 1), gt(test.t.b, 2), eq(test.t.c, 3)` returns [a, c, b].
+func extractIndexColumns(conditions string, database string, table string) []string {
+	prefix := strings.ToLower(database + "." + table + ".")
+	var eqColumns, rangeColumns []string
+	for _, m := range conditionColumnChecker.FindAllStringSubmatch(conditions, -1) {
+		negative, op, column := m[1] != "", m[2], m[3]
+		if !strings.HasPrefix(strings.ToLower(column), prefix) {
+			continue
+		}
+		column = column[len(prefix):]
+		switch {
+		case negative:
+			// e.g. `not(isnull(test.t.a))` is not selective enough
+		case op == "eq" || op == "in" || op == "isnull":
+			eqColumns = append(eqColumns, column)
+		default:
+			rangeColumns = append(rangeColumns, column)
+		}
+	}
+	columns := lo.Uniq(eqColumns)
+	for _, c := range rangeColumns {
+		if !lo.Contains(columns, c) {
+			columns = append(columns, c)
+			break
+		}
+	}
+	if len(columns) > maxIndexAdviceColumns {
+		columns = columns[:maxIndexAdviceColumns]
+	}
+	return columns
+}
+
+func indexName(prefix string, columns []string) string {
+	name := prefix + strings.Join(columns, "_")
+	if len(name) > maxIndexNameLength {
+		name = name[:maxIndexNameLength]
+	}
+	return name
+}
+
+// verifyIndexAdvice creates a hypothetical index in the session, and checks whether the optimizer chooses it for the
+// sample query of the top digest. Hypothetical indexes only exist in the optimizer of the current session.
+func verifyIndexAdvice(db *gorm.DB, advice *IndexAdvice) *HypoIndexVerification {
+	d, ok := lo.Find(advice.Digests, func(d IndexAdviceDigest) bool {
+		_, err := buildExplainStmt(d.querySampleText, false)
+		return err == nil
+	})
+	if !ok {
+		return &HypoIndexVerification{Error: "no sample query is available"}
+	}
+	v := &HypoIndexVerification{Digest: d.Digest}
+
+	name := indexName(hypoIndexPrefix, advice.Columns)
+	table := quoteIdentifier(advice.Database) + "." + quoteIdentifier(advice.Table)
+	columns := strings.Join(lo.Map(advice.Columns, func(c string, _ int) string { return quoteIdentifier(c) }), ", ")
+	err := db.Connection(func(conn *gorm.DB) error {
+		if d.SchemaName != "" {
+			if err := conn.Exec("USE " + quoteIdentifier(d.SchemaName)).Error; err != nil {
+				return err
+			}
+		}
+		if err := conn.Exec(fmt.Sprintf("CREATE INDEX %s TYPE HYPO ON %s (%s)", quoteIdentifier(name), table, columns)).Error; err != nil {
+			return err
+		}
+		defer conn.Exec(fmt.Sprintf("DROP HYPO INDEX %s ON %s", quoteIdentifier(name), table))
+
+		rows, err := conn.Raw("EXPLAIN FORMAT = 'brief' " + strings.TrimSpace(d.querySampleText)).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close() // #nosec
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		values := make([]sql.RawBytes, len(cols))
+		dest := lo.Map(values, func(_ sql.RawBytes, i int) interface{} { return &values[i] })
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			for _, value := range values {
+				if strings.Contains(string(value), "index:"+name+"(") {
+					v.UsedByPlan = true
+				}
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		v.Error = err.Error()
+	}
+	return v
+}
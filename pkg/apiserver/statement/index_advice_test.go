@@ -0,0 +1,56 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	simplejson "github.com/bitly/go-simplejson"
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testIndexAdviceSuite{})
+
+type testIndexAdviceSuite struct{}
+
+func (t *testIndexAdviceSuite) Test_extractIndexColumns(c *check.C) {
+	c.Assert(extractIndexColumns("eq(test.t.a, 1), gt(test.t.b, 2), eq(test.t.c, 3)", "test", "t"), check.DeepEquals, []string{"a", "c", "b"})
+	c.Assert(extractIndexColumns("in(test.t.a, 1, 2), lt(test.t.b, 2), ge(test.t.c, 3)", "test", "t"), check.DeepEquals, []string{"a", "b"})
+	c.Assert(extractIndexColumns("eq(test.t.a, 1), eq(test.t.a, 2), isnull(test.t.b)", "test", "t"), check.DeepEquals, []string{"a", "b"})
+	c.Assert(extractIndexColumns("not(isnull(test.t.a)), eq(test.t2.b, 1)", "test", "t"), check.HasLen, 0)
+	c.Assert(extractIndexColumns("gt(cast(test.t.a, double BINARY), 20)", "test", "t"), check.HasLen, 0)
+}
+
+func (t *testIndexAdviceSuite) Test_findFullScanCandidates(c *check.C) {
+	plan, err := simplejson.NewJson([]byte(`{
+		"name": "TableReader_7", "storeType": "tidb",
+		"children": [{
+			"name": "Selection_6", "storeType": "tikv", "operatorInfo": "eq(test.t.a, 1), gt(test.t.b, 2)",
+			"diagnosis": ["good_filter_on_table_fullscan"],
+			"children": [{
+				"name": "TableFullScan_5", "storeType": "tikv", "operatorInfo": "keep order:false",
+				"accessObjects": [{"scanObject": {"database": "test", "table": "t"}}],
+				"diagnosis": []
+			}]
+		}]
+	}`))
+	c.Assert(err, check.IsNil)
+	candidates := findFullScanCandidates(plan, nil)
+	c.Assert(candidates, check.HasLen, 1)
+	c.Assert(candidates[0].database, check.Equals, "test")
+	c.Assert(candidates[0].table, check.Equals, "t")
+	c.Assert(candidates[0].columns, check.DeepEquals, []string{"a", "b"})
+	c.Assert(candidates[0].diagnosis, check.DeepEquals, []string{"good_filter_on_table_fullscan"})
+}
+
+func (t *testIndexAdviceSuite) Test_mergePrefixIndexAdvice(c *check.C) {
+	advices := mergePrefixIndexAdvice([]IndexAdvice{
+		{Database: "test", Table: "t", Columns: []string{"a"}, Digests: []IndexAdviceDigest{{Digest: "d1"}}},
+		{Database: "test", Table: "t", Columns: []string{"a", "b"}, Digests: []IndexAdviceDigest{{Digest: "d2"}}},
+		{Database: "test", Table: "t", Columns: []string{"b"}, Digests: []IndexAdviceDigest{{Digest: "d3"}}},
+		{Database: "test", Table: "t2", Columns: []string{"a"}, Digests: []IndexAdviceDigest{{Digest: "d4"}}},
+	})
+	c.Assert(advices, check.HasLen, 3)
+	c.Assert(advices[0].Columns, check.DeepEquals, []string{"a", "b"})
+	c.Assert(advices[0].Digests, check.HasLen, 2)
+	c.Assert(advices[1].Columns, check.DeepEquals, []string{"b"})
+	c.Assert(advices[2].Table, check.Equals, "t2")
+}
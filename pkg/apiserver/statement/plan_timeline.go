@@ -0,0 +1,165 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+type PlanTimelinePoint struct {
+	BeginTime  int `json:"begin_time"`
+	EndTime    int `json:"end_time"`
+	ExecCount  int `json:"exec_count"`
+	AvgLatency int `json:"avg_latency"`
+}
+
+type PlanTimelinePlan struct {
+	PlanDigest     string              `json:"plan_digest"`
+	FirstSeen      int                 `json:"first_seen"` // begin time of the first interval that uses the plan
+	LastSeen       int                 `json:"last_seen"`  // end time of the last interval that uses the plan
+	ExecCount      int                 `json:"exec_count"`
+	AvgLatency     int                 `json:"avg_latency"`
+	PlanCanBeBound bool                `json:"plan_can_be_bound"`
+	Points         []PlanTimelinePoint `json:"points"`
+}
+
+// PlanFlip records that the optimizer switched the dominant plan (the plan with the
+// most executions) of a digest from one interval to the next.
+type PlanFlip struct {
+	Time           int     `json:"time"`
+	FromPlanDigest string  `json:"from_plan_digest"`
+	ToPlanDigest   string  `json:"to_plan_digest"`
+	FromAvgLatency int     `json:"from_avg_latency"`
+	ToAvgLatency   int     `json:"to_avg_latency"`
+	LatencyRatio   float64 `json:"latency_ratio"`
+	Regressed      bool    `json:"regressed"`
+	// The plan digest that can be passed to `POST /statements/plan/binding` to pin the previous plan.
+	// Only available when the flip is regressed and the previous plan can be bound.
+	BindingPlanDigest string `json:"binding_plan_digest,omitempty"`
+}
+
+type PlanTimeline struct {
+	Plans []PlanTimelinePlan `json:"plans"`
+	Flips []PlanFlip         `json:"flips"`
+}
+
+func (s *Service) queryPlanTimeline(
+	db *gorm.DB,
+	beginTime, endTime int,
+	schemaName, digest string,
+) (result []Model, err error) {
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	selectStmt, err := s.genSelectStmt(tableColumns, []string{
+		"plan_digest",
+		"exec_count",
+		"avg_latency",
+		"stmt_type", // required by quick plan binding
+		"plan_hint", // required by quick plan binding, only available in TiDB 6.6.0+, could be filter out by `tableColumns`
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.
+		Select(selectStmt).
+		Table(statementsTable).
+		Where("summary_begin_time <= FROM_UNIXTIME(?) AND summary_end_time >= FROM_UNIXTIME(?)", endTime, beginTime).
+		Where("digest = ?", digest).
+		Group("summary_begin_time, plan_digest").
+		Order("summary_begin_time ASC")
+
+	if schemaName != "" {
+		query = query.Where("schema_name = ?", schemaName)
+	}
+
+	err = query.Find(&result).Error
+	return
+}
+
+// buildPlanTimeline expects rows aggregated by (summary_begin_time, plan_digest).
+func buildPlanTimeline(rows []Model, regressionRatio float64) *PlanTimeline {
+	timeline := &PlanTimeline{
+		Plans: []PlanTimelinePlan{},
+		Flips: []PlanFlip{},
+	}
+
+	planIdx := make(map[string]int)
+	sumLatency := make(map[string]int)
+	// the dominant row of each interval, keyed by the interval begin time
+	dominant := make(map[int]*Model)
+	for i := range rows {
+		row := &rows[i]
+		idx, ok := planIdx[row.AggPlanDigest]
+		if !ok {
+			idx = len(timeline.Plans)
+			planIdx[row.AggPlanDigest] = idx
+			timeline.Plans = append(timeline.Plans, PlanTimelinePlan{
+				PlanDigest:     row.AggPlanDigest,
+				FirstSeen:      row.AggBeginTime,
+				PlanCanBeBound: row.PlanCanBeBound,
+			})
+		}
+		plan := &timeline.Plans[idx]
+		if row.AggBeginTime < plan.FirstSeen {
+			plan.FirstSeen = row.AggBeginTime
+		}
+		if row.AggEndTime > plan.LastSeen {
+			plan.LastSeen = row.AggEndTime
+		}
+		plan.ExecCount += row.AggExecCount
+		sumLatency[row.AggPlanDigest] += row.AggExecCount * row.AggAvgLatency
+		plan.Points = append(plan.Points, PlanTimelinePoint{
+			BeginTime:  row.AggBeginTime,
+			EndTime:    row.AggEndTime,
+			ExecCount:  row.AggExecCount,
+			AvgLatency: row.AggAvgLatency,
+		})
+
+		if d, ok := dominant[row.AggBeginTime]; !ok || row.AggExecCount > d.AggExecCount {
+			dominant[row.AggBeginTime] = row
+		}
+	}
+	for i := range timeline.Plans {
+		plan := &timeline.Plans[i]
+		if plan.ExecCount > 0 {
+			plan.AvgLatency = sumLatency[plan.PlanDigest] / plan.ExecCount
+		}
+	}
+
+	intervals := make([]int, 0, len(dominant))
+	for t := range dominant {
+		intervals = append(intervals, t)
+	}
+	sort.Ints(intervals)
+
+	for i := 1; i < len(intervals); i++ {
+		prev := dominant[intervals[i-1]]
+		cur := dominant[intervals[i]]
+		if prev.AggPlanDigest == cur.AggPlanDigest {
+			continue
+		}
+		from := &timeline.Plans[planIdx[prev.AggPlanDigest]]
+		to := &timeline.Plans[planIdx[cur.AggPlanDigest]]
+		flip := PlanFlip{
+			Time:           cur.AggBeginTime,
+			FromPlanDigest: from.PlanDigest,
+			ToPlanDigest:   to.PlanDigest,
+			FromAvgLatency: from.AvgLatency,
+			ToAvgLatency:   to.AvgLatency,
+			LatencyRatio:   diffRatio(from.AvgLatency, to.AvgLatency),
+		}
+		flip.Regressed = flip.LatencyRatio >= regressionRatio
+		if flip.Regressed && from.PlanCanBeBound {
+			flip.BindingPlanDigest = from.PlanDigest
+		}
+		timeline.Flips = append(timeline.Flips, flip)
+	}
+
+	return timeline
+}
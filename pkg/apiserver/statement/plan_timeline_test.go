@@ -0,0 +1,48 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testPlanTimelineSuite{})
+
+type testPlanTimelineSuite struct{}
+
+func (t *testPlanTimelineSuite) Test_buildPlanTimeline(c *check.C) {
+	rows := []Model{
+		{AggBeginTime: 0, AggEndTime: 1800, AggPlanDigest: "p1", AggExecCount: 10, AggAvgLatency: 100, PlanCanBeBound: true},
+		{AggBeginTime: 1800, AggEndTime: 3600, AggPlanDigest: "p1", AggExecCount: 10, AggAvgLatency: 100, PlanCanBeBound: true},
+		{AggBeginTime: 1800, AggEndTime: 3600, AggPlanDigest: "p2", AggExecCount: 20, AggAvgLatency: 400},
+		{AggBeginTime: 3600, AggEndTime: 5400, AggPlanDigest: "p2", AggExecCount: 20, AggAvgLatency: 400},
+		{AggBeginTime: 5400, AggEndTime: 7200, AggPlanDigest: "p3", AggExecCount: 20, AggAvgLatency: 100, PlanCanBeBound: true},
+	}
+
+	timeline := buildPlanTimeline(rows, 0.2)
+	c.Assert(timeline.Plans, check.HasLen, 3)
+
+	c.Assert(timeline.Plans[0].PlanDigest, check.Equals, "p1")
+	c.Assert(timeline.Plans[0].FirstSeen, check.Equals, 0)
+	c.Assert(timeline.Plans[0].LastSeen, check.Equals, 3600)
+	c.Assert(timeline.Plans[0].ExecCount, check.Equals, 20)
+	c.Assert(timeline.Plans[0].AvgLatency, check.Equals, 100)
+	c.Assert(timeline.Plans[0].Points, check.HasLen, 2)
+
+	c.Assert(timeline.Plans[1].PlanDigest, check.Equals, "p2")
+	c.Assert(timeline.Plans[1].FirstSeen, check.Equals, 1800)
+	c.Assert(timeline.Plans[1].LastSeen, check.Equals, 5400)
+
+	c.Assert(timeline.Flips, check.HasLen, 2)
+	c.Assert(timeline.Flips[0].Time, check.Equals, 1800)
+	c.Assert(timeline.Flips[0].FromPlanDigest, check.Equals, "p1")
+	c.Assert(timeline.Flips[0].ToPlanDigest, check.Equals, "p2")
+	c.Assert(timeline.Flips[0].Regressed, check.IsTrue)
+	c.Assert(timeline.Flips[0].BindingPlanDigest, check.Equals, "p1")
+
+	c.Assert(timeline.Flips[1].Time, check.Equals, 5400)
+	c.Assert(timeline.Flips[1].FromPlanDigest, check.Equals, "p2")
+	c.Assert(timeline.Flips[1].ToPlanDigest, check.Equals, "p3")
+	c.Assert(timeline.Flips[1].Regressed, check.IsFalse)
+	c.Assert(timeline.Flips[1].BindingPlanDigest, check.Equals, "")
+}
@@ -42,6 +42,129 @@ func (s *Service) queryStatements(
 	text string,
 	reqFields []string,
 ) (result []Model, err error) {
+	archived, err := s.queryArchivedStatements(db, beginTime, endTime, schemas, resourceGroups, stmtTypes, text)
+	if err != nil {
+		return nil, err
+	}
+	if len(archived) > 0 && len(reqFields) > 0 && reqFields[0] != "*" {
+		// required to merge the averages
+		reqFields = append(reqFields, "exec_count", "sum_cop_task_num")
+	}
+
+	query, err := s.buildStatementsQuery(db, beginTime, endTime, schemas, resourceGroups, stmtTypes, text, reqFields)
+	if err != nil {
+		return nil, err
+	}
+	if err = query.Find(&result).Error; err != nil {
+		return nil, err
+	}
+	if len(archived) == 0 {
+		return result, nil
+	}
+
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := selectFields(tableColumns, reqFields)
+	if err != nil {
+		return nil, err
+	}
+	result = mergeArchivedStatements(result, archived, fields, func(m *Model) string {
+		return m.AggSchemaName + "." + m.AggDigest
+	})
+	sortStatementsBySumLatency(result)
+	return result, nil
+}
+
+// streamStatements is similar to queryStatements, but calls `fn` for each statement as soon as it is
+// read from TiDB instead of collecting all of them in memory. Statements only found in the archive are
+// called after the ones read from TiDB.
+func (s *Service) streamStatements(
+	db *gorm.DB,
+	beginTime, endTime int,
+	schemas, resourceGroups, stmtTypes []string,
+	text string,
+	reqFields []string,
+	fn func(m *Model) error,
+) error {
+	archived, err := s.queryArchivedStatements(db, beginTime, endTime, schemas, resourceGroups, stmtTypes, text)
+	if err != nil {
+		return err
+	}
+	var mFields []mergeField
+	var aggs []*archiveAggregate
+	var aggByKey map[string]*archiveAggregate
+	key := func(m *Model) string {
+		return m.AggSchemaName + "." + m.AggDigest
+	}
+	if len(archived) > 0 {
+		if len(reqFields) > 0 && reqFields[0] != "*" {
+			// required to merge the averages
+			reqFields = append(reqFields, "exec_count", "sum_cop_task_num")
+		}
+		tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+		if err != nil {
+			return err
+		}
+		fields, err := selectFields(tableColumns, reqFields)
+		if err != nil {
+			return err
+		}
+		mFields = mergeFieldsOf(fields)
+		aggs, aggByKey = aggregateArchives(archived, mFields, key)
+	}
+
+	query, err := s.buildStatementsQuery(db, beginTime, endTime, schemas, resourceGroups, stmtTypes, text, reqFields)
+	if err != nil {
+		return err
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // #nosec
+
+	for rows.Next() {
+		var m Model
+		if err := query.ScanRows(rows, &m); err != nil {
+			return err
+		}
+		k := key(&m)
+		if agg, ok := aggByKey[k]; ok {
+			mergeArchiveAggregate(&m, agg, mFields)
+			delete(aggByKey, k)
+		}
+		// hooks are not triggered by ScanRows
+		_ = m.AfterFind(nil)
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, agg := range aggs {
+		if _, ok := aggByKey[key(&agg.Model)]; !ok {
+			continue
+		}
+		m := agg.Model
+		_ = m.AfterFind(nil)
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) buildStatementsQuery(
+	db *gorm.DB,
+	beginTime, endTime int,
+	schemas, resourceGroups, stmtTypes []string,
+	text string,
+	reqFields []string,
+) (*gorm.DB, error) {
 	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
 	if err != nil {
 		return nil, err
@@ -91,8 +214,7 @@ func (s *Service) queryStatements(
 		}
 	}
 
-	err = query.Find(&result).Error
-	return
+	return query, nil
 }
 
 func (s *Service) queryPlans(
@@ -105,7 +227,7 @@ func (s *Service) queryPlans(
 		return nil, err
 	}
 
-	selectStmt, err := s.genSelectStmt(tableColumns, []string{
+	reqFields := []string{
 		"plan_digest",
 		"schema_name",
 		"digest_text",
@@ -119,7 +241,8 @@ func (s *Service) queryPlans(
 		"max_mem",
 		"stmt_type", // required by quick plan binding
 		"plan_hint", // required by quick plan binding, only available in TiDB 6.6.0+, could be filter out by `tableColumns`
-	})
+	}
+	selectStmt, err := s.genSelectStmt(tableColumns, reqFields)
 	if err != nil {
 		return nil, err
 	}
@@ -140,9 +263,31 @@ func (s *Service) queryPlans(
 		query.Where("digest = ?", digest)
 	}
 
-	err = query.Find(&result).Error
+	if err = query.Find(&result).Error; err != nil {
+		return nil, err
+	}
 
-	return
+	archived, err := s.queryArchives(db, beginTime, endTime, func(query *gorm.DB) *gorm.DB {
+		// the evicted record's digest is archived as an empty string
+		query = query.Where("digest = ?", digest)
+		if digest != "" && schemaName != "" {
+			query = query.Where("schema_name = ?", schemaName)
+		}
+		return query
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(archived) == 0 {
+		return result, nil
+	}
+	fields, err := selectFields(tableColumns, reqFields)
+	if err != nil {
+		return nil, err
+	}
+	return mergeArchivedStatements(result, archived, fields, func(m *Model) string {
+		return m.AggPlanDigest
+	}), nil
 }
 
 func (s *Service) queryPlanDetail(
@@ -3,10 +3,12 @@
 package statement
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,11 +17,15 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sso"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
 	"github.com/pingcap/tidb-dashboard/util/featureflag"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
 var (
@@ -29,23 +35,55 @@ var (
 
 type ServiceParams struct {
 	fx.In
-	TiDBClient *tidb.Client
-	SysSchema  *commonUtils.SysSchema
+	TiDBClient    *tidb.Client
+	SysSchema     *commonUtils.SysSchema
+	LocalStore    *dbstore.DB
+	ConfigManager *config.DynamicConfigManager
+	SSOService    *sso.Service
 }
 
 type Service struct {
 	params                 ServiceParams
 	planBindingFeatureFlag *featureflag.FeatureFlag
+	hypoIndexFeatureFlag   *featureflag.FeatureFlag
+	fSwap                  *fileswap.Handler
+
+	wg sync.WaitGroup
 }
 
-func newService(p ServiceParams, ff *featureflag.Registry) *Service {
-	return &Service{params: p, planBindingFeatureFlag: ff.Register("plan_binding", ">= 6.5.0")}
+func newService(lc fx.Lifecycle, p ServiceParams, ff *featureflag.Registry) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	s := &Service{
+		params:                 p,
+		planBindingFeatureFlag: ff.Register("plan_binding", ">= 6.5.0"),
+		hypoIndexFeatureFlag:   ff.Register("hypo_index", ">= 8.0.0"),
+		fSwap:                  fileswap.New(),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.archiveLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s, nil
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/statements")
 	{
 		endpoint.GET("/download", s.downloadHandler)
+		endpoint.GET("/archive/config", auth.MWAuthRequired(), s.getArchiveConfigHandler)
+		endpoint.PUT("/archive/config", auth.MWAuthRequired(), auth.MWRequireWritePriv(), s.setArchiveConfigHandler)
 
 		endpoint.Use(auth.MWAuthRequired())
 		endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
@@ -56,8 +94,12 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 			endpoint.POST("/config", auth.MWRequireWritePriv(), s.modifyConfigHandler)
 			endpoint.GET("/stmt_types", s.stmtTypesHandler)
 			endpoint.GET("/list", s.listHandler)
+			endpoint.GET("/compare", s.compareHandler)
 			endpoint.GET("/plans", s.plansHandler)
 			endpoint.GET("/plan/detail", s.planDetailHandler)
+			endpoint.GET("/plan/timeline", s.planTimelineHandler)
+			endpoint.POST("/plan/explain", s.explainPlanHandler)
+			endpoint.GET("/index_advice", s.indexAdviceHandler)
 
 			endpoint.GET("/available_fields", s.getAvailableFields)
 
@@ -125,6 +167,56 @@ func (s *Service) modifyConfigHandler(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Get statement archive configurations
+// @Success 200 {object} config.StatementConfig
+// @Router /statements/archive/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) getArchiveConfigHandler(c *gin.Context) {
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.Statement)
+}
+
+// @Summary Update statement archive configurations
+// @Description Archiving requires the SQL user authorized for SSO impersonation, which is used to read statements in background. Omitted fields keep the current values.
+// @Param request body config.StatementConfig true "Request body"
+// @Success 200 {object} config.StatementConfig
+// @Router /statements/archive/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) setArchiveConfigHandler(c *gin.Context) {
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	req := dc.Statement
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.Statement = req
+	}
+	if err := s.params.ConfigManager.Modify(opt); err != nil {
+		rest.Error(c, err)
+		return
+	}
+	dc, err = s.params.ConfigManager.Get()
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.Statement)
+}
+
 // @Summary Get all statement types
 // @Success 200 {array} string
 // @Router /statements/stmt_types [get]
@@ -148,6 +240,8 @@ type GetStatementsRequest struct {
 	EndTime        int      `json:"end_time" form:"end_time"`
 	Text           string   `json:"text" form:"text"`
 	Fields         string   `json:"fields" form:"fields"`
+	// Only used when exporting statements. Defaults to csv.
+	Format string `json:"format" form:"format" enums:"csv,ndjson,parquet"`
 }
 
 // @Summary Get a list of statements
@@ -183,6 +277,46 @@ func (s *Service) listHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, overviews)
 }
 
+type CompareStatementsRequest struct {
+	Schemas           []string `json:"schemas" form:"schemas"`
+	ResourceGroups    []string `json:"resource_groups" form:"resource_groups"`
+	StmtTypes         []string `json:"stmt_types" form:"stmt_types"`
+	Text              string   `json:"text" form:"text"`
+	BaselineBeginTime int      `json:"baseline_begin_time" form:"baseline_begin_time" binding:"required"`
+	BaselineEndTime   int      `json:"baseline_end_time" form:"baseline_end_time" binding:"required"`
+	TargetBeginTime   int      `json:"target_begin_time" form:"target_begin_time" binding:"required"`
+	TargetEndTime     int      `json:"target_end_time" form:"target_end_time" binding:"required"`
+	// A digest is regressed when its average latency in the target window grows by at least this ratio.
+	// Defaults to 0.2 (+20%) when not specified.
+	RegressionRatio float64 `json:"regression_ratio" form:"regression_ratio"`
+}
+
+// @Summary Compare statements between a baseline time window and a target time window
+// @Param q query CompareStatementsRequest true "Query"
+// @Success 200 {array} CompareResult
+// @Router /statements/compare [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) compareHandler(c *gin.Context) {
+	var req CompareStatementsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.BaselineBeginTime > req.BaselineEndTime || req.TargetBeginTime > req.TargetEndTime {
+		rest.Error(c, rest.ErrBadRequest.New("begin time must not be later than end time"))
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	results, err := s.compareStatements(db, &req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
 type GetPlansRequest struct {
 	SchemaName string `json:"schema_name" form:"schema_name"`
 	Digest     string `json:"digest" form:"digest"`
@@ -251,6 +385,123 @@ func (s *Service) planDetailHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+type GetPlanTimelineRequest struct {
+	GetPlansRequest
+	// A plan flip is regressed when the average latency of the new plan grows by at least this ratio.
+	// Defaults to 0.2 (+20%) when not specified.
+	RegressionRatio float64 `json:"regression_ratio" form:"regression_ratio"`
+}
+
+// @Summary Get the plan change timeline of a statement
+// @Description Flips where the new plan is slower contain a plan digest that can be used to create a plan binding.
+// @Param q query GetPlanTimelineRequest true "Query"
+// @Success 200 {object} PlanTimeline
+// @Router /statements/plan/timeline [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) planTimelineHandler(c *gin.Context) {
+	var req GetPlanTimelineRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Digest == "" {
+		rest.Error(c, rest.ErrBadRequest.New("digest cannot be empty"))
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	rows, err := s.queryPlanTimeline(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	ratio := req.RegressionRatio
+	if ratio <= 0 {
+		ratio = defaultRegressionRatio
+	}
+	c.JSON(http.StatusOK, buildPlanTimeline(rows, ratio))
+}
+
+type ExplainPlanRequest struct {
+	SchemaName string `json:"schema_name"`
+	Digest     string `json:"digest"`
+	PlanDigest string `json:"plan_digest"`
+	BeginTime  int    `json:"begin_time"`
+	EndTime    int    `json:"end_time"`
+	// Run EXPLAIN ANALYZE instead of EXPLAIN. The sample query is executed, so that write privilege is required.
+	Analyze bool `json:"analyze"`
+}
+
+// @Summary Explain the sample query of an execution plan against the current TiDB
+// @Description The result can be compared with the historical plan to check whether the plan is still used.
+// @Param request body ExplainPlanRequest true "Request body"
+// @Success 200 {object} ExplainResult
+// @Router /statements/plan/explain [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) explainPlanHandler(c *gin.Context) {
+	var req ExplainPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.PlanDigest == "" {
+		rest.Error(c, rest.ErrBadRequest.New("plan_digest cannot be empty"))
+		return
+	}
+	if req.Analyze && !utils.GetSession(c).IsWriteable {
+		rest.Error(c, rest.ErrForbidden.New("write privilege is required to run EXPLAIN ANALYZE"))
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	result, err := s.explainPlan(db, &req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type GetIndexAdviceRequest struct {
+	BeginTime int      `json:"begin_time" form:"begin_time"`
+	EndTime   int      `json:"end_time" form:"end_time"`
+	Schemas   []string `json:"schemas" form:"schemas"`
+	// The number of plans with the highest sum latency to be analyzed. Defaults to 100.
+	Limit int `json:"limit" form:"limit"`
+	// Verify each advice by explaining the sample query with a hypothetical index. Requires TiDB 8.0.0+.
+	Verify bool `json:"verify" form:"verify"`
+}
+
+// @Summary Get index advice for statements
+// @Description Candidate indexes are proposed for the filtered full table scans in the plans of the statements.
+// @Param q query GetIndexAdviceRequest true "Query"
+// @Success 200 {array} IndexAdvice
+// @Router /statements/index_advice [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) indexAdviceHandler(c *gin.Context) {
+	var req GetIndexAdviceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Verify && !s.hypoIndexFeatureFlag.IsSupported() {
+		rest.Error(c, rest.ErrBadRequest.New("hypothetical index is not supported in the current version"))
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	advices, err := s.queryIndexAdvice(db, &req)
+	if err != nil {
+		rest.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, advices)
+}
+
 // @Summary	Get the bound plan digest (if exists) of a statement
 // @Param	sql_digest	query	string	true	"query template id"
 // @Param	begin_time	query	int	true	"begin time"
@@ -355,60 +606,53 @@ func (s *Service) downloadTokenHandler(c *gin.Context) {
 		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	format, err := utils.ParseExportFormat(req.Format)
+	if err != nil {
+		rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
 	db := utils.GetTiDBConnection(c)
 	fields := []string{}
 	if strings.TrimSpace(req.Fields) != "" {
 		fields = strings.Split(req.Fields, ",")
 	}
-	overviews, err := s.queryStatements(
-		db,
-		req.BeginTime, req.EndTime,
-		req.Schemas,
-		req.ResourceGroups,
-		req.StmtTypes,
-		req.Text,
-		fields)
-	if err != nil {
-		rest.Error(c, rest.ErrBadRequest.NewWithNoMessage())
-		return
-	}
-	if len(overviews) == 0 {
-		rest.Error(c, ErrNoData.NewWithNoMessage())
-		return
-	}
-
-	// interface{} tricky
-	rawData := make([]interface{}, len(overviews))
-	for i, v := range overviews {
-		rawData[i] = v
-	}
 
-	// convert data
-	csvData := utils.GenerateCSVFromRaw(rawData, fields, []string{"first_seen", "last_seen"})
-
-	// generate temp file that persist encrypted data
 	timeLayout := "01021504"
 	beginTime := time.Unix(int64(req.BeginTime), 0).Format(timeLayout)
 	endTime := time.Unix(int64(req.EndTime), 0).Format(timeLayout)
-	token, err := utils.ExportCSV(csvData,
-		fmt.Sprintf("statements_%s_%s_*.csv", beginTime, endTime),
-		"statements/download")
+	token, err := utils.ExportToFile(s.fSwap, format,
+		fmt.Sprintf("statements_%s_%s", beginTime, endTime),
+		Model{}, fields, []string{"first_seen", "last_seen"},
+		func(write func(row interface{}) error) error {
+			return s.streamStatements(
+				db,
+				req.BeginTime, req.EndTime,
+				req.Schemas,
+				req.ResourceGroups,
+				req.StmtTypes,
+				req.Text,
+				fields,
+				func(m *Model) error { return write(m) })
+		})
 	if err != nil {
 		rest.Error(c, err)
 		return
 	}
+	if token == "" {
+		rest.Error(c, ErrNoData.NewWithNoMessage())
+		return
+	}
 	c.String(http.StatusOK, token)
 }
 
 // @Router /statements/download [get]
 // @Summary Download statements
-// @Produce text/csv
+// @Produce application/octet-stream
 // @Param token query string true "download token"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadHandler(c *gin.Context) {
-	token := c.Query("token")
-	utils.DownloadByToken(token, "statements/download", c)
+	s.fSwap.HandleDownloadRequest(c)
 }
 
 // @Summary Get available field names
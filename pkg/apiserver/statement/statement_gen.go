@@ -15,6 +15,22 @@ import (
 var ErrUnknownColumn = ErrNS.NewType("unknown_column")
 
 func (s *Service) genSelectStmt(tableColumns []string, reqJSONColumns []string) (string, error) {
+	fields, err := selectFields(tableColumns, reqJSONColumns)
+	if err != nil {
+		return "", err
+	}
+
+	stmt := lo.Map(fields, func(f Field, _ int) string {
+		if f.Aggregation == "" {
+			return f.JSONName
+		}
+		return fmt.Sprintf("%s AS %s", f.Aggregation, f.ColumnName)
+	})
+	return strings.Join(stmt, ", "), nil
+}
+
+// selectFields returns the fields to be selected for the requested columns.
+func selectFields(tableColumns []string, reqJSONColumns []string) ([]Field, error) {
 	fields := getFieldsAndTags()
 
 	// use required fields filter when not all fields are requested
@@ -44,14 +60,7 @@ func (s *Service) genSelectStmt(tableColumns []string, reqJSONColumns []string)
 	})
 
 	if len(fields) == 0 {
-		return "", ErrUnknownColumn.New("all columns are not included in the current version %s schema, columns: %q", distro.R().TiDB, reqJSONColumns)
+		return nil, ErrUnknownColumn.New("all columns are not included in the current version %s schema, columns: %q", distro.R().TiDB, reqJSONColumns)
 	}
-
-	stmt := lo.Map(fields, func(f Field, _ int) string {
-		if f.Aggregation == "" {
-			return f.JSONName
-		}
-		return fmt.Sprintf("%s AS %s", f.Aggregation, f.ColumnName)
-	})
-	return strings.Join(stmt, ", "), nil
+	return fields, nil
 }
@@ -22,6 +22,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
+	"gorm.io/gorm"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
@@ -153,6 +154,16 @@ func (s *Service) getAndDecryptImpersonation() (string, string, error) {
 	return imp.SQLUser, string(decryptedPass), nil
 }
 
+// OpenImpersonatedSQLConn opens a SQL connection with the SQL user authorized for impersonation. It is used by
+// background jobs which are not associated with any user session.
+func (s *Service) OpenImpersonatedSQLConn() (*gorm.DB, error) {
+	userName, password, err := s.getAndDecryptImpersonation()
+	if err != nil {
+		return nil, ErrInvalidImpersonateCredential.Wrap(err, "Invalid SQL credential")
+	}
+	return s.params.TiDBClient.OpenSQLConn(userName, password)
+}
+
 func (s *Service) updateImpersonationStatus(user string, status ImpersonateStatus) error {
 	return s.params.LocalStore.
 		Model(&SSOImpersonationModel{}).
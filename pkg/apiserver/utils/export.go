@@ -3,140 +3,371 @@
 package utils
 
 import (
-	"encoding/base64"
+	"bufio"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
 
-	"github.com/Xeoncross/go-aesctr-with-hmac"
-	"github.com/gin-gonic/gin"
-	"github.com/gtank/cryptopasta"
-	"github.com/oleiade/reflections"
-	"github.com/pingcap/log"
-	"go.uber.org/zap"
+	"github.com/parquet-go/parquet-go"
 
-	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
-// TODO: Better to be a streaming interface.
-func GenerateCSVFromRaw(rawData []interface{}, fields []string, timeFields []string) (data [][]string) {
-	timeFieldsMap := make(map[string]struct{})
-	for _, f := range timeFields {
-		timeFieldsMap[f] = struct{}{}
+var ErrUnknownExportFormat = ErrNS.NewType("unknown_export_format")
+
+type ExportFormat string
+
+const (
+	ExportFormatCSV     ExportFormat = "csv"
+	ExportFormatNDJSON  ExportFormat = "ndjson"
+	ExportFormatParquet ExportFormat = "parquet"
+)
+
+const (
+	// Rows are flushed into a new parquet row group after this number of rows, so that
+	// the memory used by the parquet writer is bounded.
+	parquetRowGroupSize = 10000
+
+	exportTokenExpire = time.Hour
+)
+
+// ParseExportFormat parses the format passed in by the user. CSV is used when the format is empty.
+func ParseExportFormat(format string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(format)); f {
+	case "":
+		return ExportFormatCSV, nil
+	case ExportFormatCSV, ExportFormatNDJSON, ExportFormatParquet:
+		return f, nil
+	default:
+		return "", ErrUnknownExportFormat.New("unknown export format %s", format)
 	}
+}
 
-	fieldsMap := make(map[string]string)
-	t := reflect.TypeOf(rawData[0])
-	fieldsNum := t.NumField()
-	allFields := make([]string, fieldsNum)
-	for i := 0; i < fieldsNum; i++ {
-		field := t.Field(i)
-		allFields[i] = strings.ToLower(field.Tag.Get("json"))
-		fieldsMap[allFields[i]] = field.Name
+func (f ExportFormat) Ext() string {
+	switch f {
+	case ExportFormatNDJSON:
+		return ".ndjson"
+	case ExportFormatParquet:
+		return ".parquet"
+	default:
+		return ".csv"
+	}
+}
+
+type exportColumn struct {
+	name       string
+	fieldIndex int
+	isTime     bool
+	// nullable is set for pointer fields, which are optional columns in parquet
+	nullable bool
+}
+
+// Exporter writes rows of the same struct type into a writer in CSV, NDJSON or Parquet format.
+// Columns are named by the json tag of the struct fields.
+type Exporter struct {
+	format  ExportFormat
+	columns []exportColumn
+
+	csvWriter *csv.Writer
+	csvRowBuf []string
+
+	jsonWriter *bufio.Writer
+
+	parquetWriter *parquet.Writer
+	// parquetColumnIdx[i] is the column index of columns[i] in the parquet schema
+	parquetColumnIdx []int
+	parquetRowBuf    []parquet.Row
+	parquetRows      int
+}
+
+// NewExporter creates an exporter for rows of the same type as `sample`. Only the fields whose json tag is
+// listed in `fields` are exported, or all fields when `fields` is empty or is ["*"]. Fields listed in
+// `timeFields` are integers of unix seconds.
+func NewExporter(w io.Writer, format ExportFormat, sample interface{}, fields []string, timeFields []string) (*Exporter, error) {
+	t := reflect.Indirect(reflect.ValueOf(sample)).Type()
+	fieldIdx := make(map[string]int)
+	allFields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.ToLower(strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldIdx[name] = i
+		allFields = append(allFields, name)
 	}
-	if len(fields) == 1 && fields[0] == "*" {
+	if len(fields) == 0 || (len(fields) == 1 && fields[0] == "*") {
 		fields = allFields
 	}
 
-	data = [][]string{fields}
-	timeLayout := "01-02 15:04:05"
-	for _, overview := range rawData {
-		row := []string{}
-		for _, field := range fields {
-			fieldName := fieldsMap[field]
-			s, _ := reflections.GetField(overview, fieldName)
-			var val string
-			switch t := s.(type) {
-			case int:
-				if _, ok := timeFieldsMap[field]; ok {
-					val = time.Unix(int64(t), 0).Format(timeLayout)
-				} else {
-					val = fmt.Sprintf("%d", t)
-				}
-			case uint:
-				val = fmt.Sprintf("%d", t)
-			case float64:
-				val = fmt.Sprintf("%f", t)
-			default:
-				val = fmt.Sprintf("%s", t)
+	e := &Exporter{format: format}
+	for _, f := range fields {
+		idx, ok := fieldIdx[f]
+		if !ok {
+			continue
+		}
+		// each field is exported at most once
+		delete(fieldIdx, f)
+		e.columns = append(e.columns, exportColumn{
+			name:       f,
+			fieldIndex: idx,
+			isTime:     isTimeField(t.Field(idx), f, timeFields),
+			nullable:   t.Field(idx).Type.Kind() == reflect.Ptr,
+		})
+	}
+
+	switch format {
+	case ExportFormatCSV:
+		e.csvWriter = csv.NewWriter(w)
+		e.csvRowBuf = make([]string, 0, len(e.columns))
+		for _, c := range e.columns {
+			e.csvRowBuf = append(e.csvRowBuf, c.name)
+		}
+		if err := e.csvWriter.Write(e.csvRowBuf); err != nil {
+			return nil, err
+		}
+	case ExportFormatNDJSON:
+		e.jsonWriter = bufio.NewWriter(w)
+	case ExportFormatParquet:
+		group := parquet.Group{}
+		for _, c := range e.columns {
+			node := parquetNodeOf(t.Field(c.fieldIndex).Type, c.isTime)
+			if c.nullable {
+				node = parquet.Optional(node)
 			}
-			row = append(row, val)
+			group[c.name] = node
+		}
+		schema := parquet.NewSchema(t.Name(), group)
+		schemaIdx := make(map[string]int)
+		for i, f := range schema.Fields() {
+			schemaIdx[f.Name()] = i
+		}
+		for _, c := range e.columns {
+			e.parquetColumnIdx = append(e.parquetColumnIdx, schemaIdx[c.name])
 		}
-		data = append(data, row)
+		e.parquetWriter = parquet.NewWriter(w, schema)
+		e.parquetRowBuf = make([]parquet.Row, 1)
+	default:
+		return nil, ErrUnknownExportFormat.New("unknown export format %s", format)
 	}
-	return
+	return e, nil
 }
 
-// TODO: Better to be a streaming interface.
-func ExportCSV(data [][]string, filename, tokenNamespace string) (token string, err error) {
-	csvFile, err := os.CreateTemp("", filename)
-	if err != nil {
-		return
+func isTimeField(f reflect.StructField, name string, timeFields []string) bool {
+	ft := f.Type
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	switch ft.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	default:
+		return false
 	}
-	defer csvFile.Close() // #nosec
+	for _, tf := range timeFields {
+		if tf == name {
+			return true
+		}
+	}
+	return false
+}
 
-	// generate encryption key
-	secretKey := *cryptopasta.NewEncryptionKey()
+func parquetNodeOf(t reflect.Type, isTime bool) parquet.Node {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isTime {
+		return parquet.Timestamp(parquet.Millisecond)
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return parquet.Int(64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return parquet.Uint(64)
+	case reflect.Float32, reflect.Float64:
+		return parquet.Leaf(parquet.DoubleType)
+	case reflect.Bool:
+		return parquet.Leaf(parquet.BooleanType)
+	default:
+		return parquet.String()
+	}
+}
 
-	pr, pw := io.Pipe()
-	go func() {
-		csvwriter := csv.NewWriter(pw)
-		_ = csvwriter.WriteAll(data)
-		_ = pw.Close()
-	}()
-	err = aesctr.Encrypt(pr, csvFile, secretKey[0:16], secretKey[16:])
-	if err != nil {
-		return
+func (e *Exporter) Write(row interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	switch e.format {
+	case ExportFormatCSV:
+		return e.writeCSV(v)
+	case ExportFormatNDJSON:
+		return e.writeNDJSON(v)
+	default:
+		return e.writeParquet(v)
 	}
+}
 
-	// generate token by filepath and secretKey
-	secretKeyStr := base64.StdEncoding.EncodeToString(secretKey[:])
-	token, err = NewJWTString(tokenNamespace, secretKeyStr+" "+csvFile.Name())
-	return
+func (e *Exporter) writeCSV(v reflect.Value) error {
+	timeLayout := "01-02 15:04:05"
+	e.csvRowBuf = e.csvRowBuf[:0]
+	for _, c := range e.columns {
+		fv := reflect.Indirect(v.Field(c.fieldIndex))
+		var val string
+		switch {
+		case !fv.IsValid():
+			val = ""
+		case c.isTime:
+			val = time.Unix(fv.Int(), 0).Format(timeLayout)
+		case fv.Kind() == reflect.Float32 || fv.Kind() == reflect.Float64:
+			val = fmt.Sprintf("%f", fv.Float())
+		default:
+			val = stringOf(fv)
+		}
+		e.csvRowBuf = append(e.csvRowBuf, val)
+	}
+	return e.csvWriter.Write(e.csvRowBuf)
 }
 
-// FIXME: Remove or refine this function, as it is not general.
-func DownloadByToken(token, tokenNamespace string, c *gin.Context) {
-	tokenPlain, err := ParseJWTString(tokenNamespace, token)
-	if err != nil {
-		rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
-		return
+func (e *Exporter) writeNDJSON(v reflect.Value) error {
+	if err := e.jsonWriter.WriteByte('{'); err != nil {
+		return err
+	}
+	for i, c := range e.columns {
+		if i > 0 {
+			if err := e.jsonWriter.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		name, _ := json.Marshal(c.name)
+		val, err := json.Marshal(v.Field(c.fieldIndex).Interface())
+		if err != nil {
+			return err
+		}
+		_, _ = e.jsonWriter.Write(name)
+		_ = e.jsonWriter.WriteByte(':')
+		if _, err := e.jsonWriter.Write(val); err != nil {
+			return err
+		}
 	}
-	arr := strings.Fields(tokenPlain)
-	if len(arr) != 2 {
-		rest.Error(c, rest.ErrBadRequest.New("invalid token"))
-		return
+	_, err := e.jsonWriter.WriteString("}\n")
+	return err
+}
+
+func (e *Exporter) writeParquet(v reflect.Value) error {
+	// values in the row must be ordered by the column index
+	row := e.parquetRowBuf[0][:0]
+	for range e.columns {
+		row = append(row, parquet.Value{})
 	}
-	secretKey, err := base64.StdEncoding.DecodeString(arr[0])
-	if err != nil {
-		rest.Error(c, rest.ErrBadRequest.WrapWithNoMessage(err))
-		return
+	for i, c := range e.columns {
+		fv := reflect.Indirect(v.Field(c.fieldIndex))
+		// the definition level of a value in an optional column is 1, and is 0 for null
+		definitionLevel := 0
+		if c.nullable && fv.IsValid() {
+			definitionLevel = 1
+		}
+		var pv parquet.Value
+		switch {
+		case !fv.IsValid():
+			pv = parquet.NullValue()
+		case c.isTime:
+			pv = parquet.Int64Value(fv.Int() * 1000)
+		default:
+			switch fv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				pv = parquet.Int64Value(fv.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				pv = parquet.Int64Value(int64(fv.Uint()))
+			case reflect.Float32, reflect.Float64:
+				pv = parquet.DoubleValue(fv.Float())
+			case reflect.Bool:
+				pv = parquet.BooleanValue(fv.Bool())
+			default:
+				pv = parquet.ByteArrayValue([]byte(stringOf(fv)))
+			}
+		}
+		row[e.parquetColumnIdx[i]] = pv.Level(0, definitionLevel, e.parquetColumnIdx[i])
+	}
+	e.parquetRowBuf[0] = row
+	if _, err := e.parquetWriter.WriteRows(e.parquetRowBuf); err != nil {
+		return err
+	}
+	e.parquetRows++
+	if e.parquetRows%parquetRowGroupSize == 0 {
+		return e.parquetWriter.Flush()
 	}
+	return nil
+}
 
-	filePath := arr[1]
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		rest.Error(c, err)
-		return
+func stringOf(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes())
+		}
+	default:
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Close flushes buffered data and writes the file footer if needed. The underlying writer is not closed.
+func (e *Exporter) Close() error {
+	switch e.format {
+	case ExportFormatCSV:
+		e.csvWriter.Flush()
+		return e.csvWriter.Error()
+	case ExportFormatNDJSON:
+		return e.jsonWriter.Flush()
+	default:
+		return e.parquetWriter.Close()
 	}
-	f, err := os.Open(filepath.Clean(filePath))
+}
+
+// ExportToFile streams the rows produced by `produce` into an encrypted temporary file, and returns a token
+// to download it through `fSwap`. `produce` is expected to page through the data source and call `write`
+// for each row, so that the whole result set is never held in memory.
+// An empty token is returned when no row is written.
+func ExportToFile(
+	fSwap *fileswap.Handler,
+	format ExportFormat,
+	fileName string,
+	sample interface{},
+	fields []string,
+	timeFields []string,
+	produce func(write func(row interface{}) error) error,
+) (token string, err error) {
+	fw, err := fSwap.NewFileWriter("export_*" + format.Ext())
 	if err != nil {
-		rest.Error(c, err)
-		return
+		return "", err
 	}
+	defer func() {
+		if err != nil || token == "" {
+			fw.Remove()
+		}
+	}()
 
-	c.Writer.Header().Set("Content-type", "text/csv")
-	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileInfo.Name()))
-	err = aesctr.Decrypt(f, c.Writer, secretKey[0:16], secretKey[16:])
+	exporter, err := NewExporter(fw, format, sample, fields, timeFields)
 	if err != nil {
-		log.Error("decrypt csv failed", zap.Error(err))
+		return "", err
+	}
+	rows := 0
+	err = produce(func(row interface{}) error {
+		rows++
+		return exporter.Write(row)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = exporter.Close(); err != nil {
+		return "", err
+	}
+	if err = fw.Close(); err != nil {
+		return "", err
+	}
+	if rows == 0 {
+		return "", nil
 	}
-	// delete it anyway
-	_ = f.Close()
-	_ = os.Remove(filePath)
+	return fw.GetDownloadToken(fileName+format.Ext(), exportTokenExpire)
 }
@@ -0,0 +1,140 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/pingcap/check"
+)
+
+var _ = check.Suite(&testExportSuite{})
+
+type testExportSuite struct{}
+
+type testExportRow struct {
+	Digest    string  `json:"digest"`
+	ExecCount int     `json:"exec_count"`
+	Latency   float64 `json:"latency"`
+	FirstSeen int     `json:"first_seen"`
+	Hint      *string `json:"hint"`
+	Ignored   string  `json:"-"`
+}
+
+func testExportRows() []testExportRow {
+	hint := "use_index(t, idx)"
+	return []testExportRow{
+		{Digest: "a", ExecCount: 1, Latency: 1.5, FirstSeen: 1600000000, Hint: &hint},
+		{Digest: "b", ExecCount: 2, Latency: 2.5, FirstSeen: 1600000001},
+	}
+}
+
+func (t *testExportSuite) export(c *check.C, format ExportFormat, fields []string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	e, err := NewExporter(buf, format, testExportRow{}, fields, []string{"first_seen"})
+	c.Assert(err, check.IsNil)
+	for _, row := range testExportRows() {
+		c.Assert(e.Write(row), check.IsNil)
+	}
+	c.Assert(e.Close(), check.IsNil)
+	return buf
+}
+
+func (t *testExportSuite) Test_ParseExportFormat(c *check.C) {
+	f, err := ParseExportFormat("")
+	c.Assert(err, check.IsNil)
+	c.Assert(f, check.Equals, ExportFormatCSV)
+	f, err = ParseExportFormat("Parquet")
+	c.Assert(err, check.IsNil)
+	c.Assert(f, check.Equals, ExportFormatParquet)
+	_, err = ParseExportFormat("xlsx")
+	c.Assert(err, check.NotNil)
+}
+
+func (t *testExportSuite) Test_Exporter_CSV(c *check.C) {
+	buf := t.export(c, ExportFormatCSV, []string{"digest", "latency", "hint", "not_exist"})
+	c.Assert(buf.String(), check.Equals, "digest,latency,hint\na,1.500000,\"use_index(t, idx)\"\nb,2.500000,\n")
+
+	buf = t.export(c, ExportFormatCSV, []string{"first_seen"})
+	c.Assert(buf.String(), check.Equals, "first_seen\n"+
+		time.Unix(1600000000, 0).Format("01-02 15:04:05")+"\n"+
+		time.Unix(1600000001, 0).Format("01-02 15:04:05")+"\n")
+}
+
+func (t *testExportSuite) Test_Exporter_NDJSON(c *check.C) {
+	buf := t.export(c, ExportFormatNDJSON, []string{"*"})
+	c.Assert(buf.String(), check.Equals,
+		`{"digest":"a","exec_count":1,"latency":1.5,"first_seen":1600000000,"hint":"use_index(t, idx)"}`+"\n"+
+			`{"digest":"b","exec_count":2,"latency":2.5,"first_seen":1600000001,"hint":null}`+"\n")
+}
+
+func (t *testExportSuite) Test_Exporter_Parquet(c *check.C) {
+	buf := t.export(c, ExportFormatParquet, []string{"exec_count", "digest", "first_seen", "hint"})
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, check.IsNil)
+	c.Assert(f.NumRows(), check.Equals, int64(2))
+
+	type row struct {
+		Digest    string    `parquet:"digest"`
+		ExecCount int64     `parquet:"exec_count"`
+		FirstSeen time.Time `parquet:"first_seen,timestamp(millisecond)"`
+		Hint      *string   `parquet:"hint,optional"`
+	}
+	rows := make([]row, 2)
+	n, err := parquet.NewGenericReader[row](f).Read(rows)
+	c.Assert(n, check.Equals, 2)
+	c.Assert(err == nil || errors.Is(err, io.EOF), check.IsTrue)
+	c.Assert(rows[0].Digest, check.Equals, "a")
+	c.Assert(rows[0].ExecCount, check.Equals, int64(1))
+	c.Assert(rows[0].FirstSeen.Unix(), check.Equals, int64(1600000000))
+	c.Assert(*rows[0].Hint, check.Equals, "use_index(t, idx)")
+	c.Assert(rows[1].Digest, check.Equals, "b")
+	c.Assert(rows[1].Hint, check.IsNil)
+}
+
+func (t *testExportSuite) Test_Exporter_ParquetNull(c *check.C) {
+	type nullableRow struct {
+		Digest    string   `json:"digest"`
+		ExecCount *int     `json:"exec_count"`
+		Latency   *float64 `json:"latency"`
+		FirstSeen *int     `json:"first_seen"`
+	}
+	execCount, latency, firstSeen := 3, 1.5, 1600000000
+	buf := &bytes.Buffer{}
+	e, err := NewExporter(buf, ExportFormatParquet, nullableRow{}, nil, []string{"first_seen"})
+	c.Assert(err, check.IsNil)
+	c.Assert(e.Write(nullableRow{Digest: "a", ExecCount: &execCount, Latency: &latency, FirstSeen: &firstSeen}), check.IsNil)
+	c.Assert(e.Write(nullableRow{Digest: "b"}), check.IsNil)
+	c.Assert(e.Close(), check.IsNil)
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, check.IsNil)
+	for _, name := range []string{"exec_count", "latency", "first_seen"} {
+		col, ok := f.Schema().Lookup(name)
+		c.Assert(ok, check.IsTrue)
+		c.Assert(col.Node.Optional(), check.IsTrue)
+	}
+
+	type row struct {
+		Digest    string   `parquet:"digest"`
+		ExecCount *int64   `parquet:"exec_count,optional"`
+		Latency   *float64 `parquet:"latency,optional"`
+		FirstSeen *int64   `parquet:"first_seen,optional"`
+	}
+	rows := make([]row, 2)
+	n, err := parquet.NewGenericReader[row](f).Read(rows)
+	c.Assert(n, check.Equals, 2)
+	c.Assert(err == nil || errors.Is(err, io.EOF), check.IsTrue)
+	c.Assert(*rows[0].ExecCount, check.Equals, int64(3))
+	c.Assert(*rows[0].Latency, check.Equals, 1.5)
+	c.Assert(*rows[0].FirstSeen, check.Equals, int64(1600000000000))
+	c.Assert(rows[1].Digest, check.Equals, "b")
+	c.Assert(rows[1].ExecCount, check.IsNil)
+	c.Assert(rows[1].Latency, check.IsNil)
+	c.Assert(rows[1].FirstSeen, check.IsNil)
+}
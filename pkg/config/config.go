@@ -23,6 +23,7 @@ const (
 type Config struct {
 	DataDir          string
 	TempDir          string
+	LogSourceDir     string // the base directory of the log files read by log search, disabled if empty
 	PDEndPoint       string
 	PublicPathPrefix string
 
@@ -43,6 +44,7 @@ func Default() *Config {
 	return &Config{
 		DataDir:               "/tmp/dashboard-data",
 		TempDir:               "",
+		LogSourceDir:          "",
 		PDEndPoint:            "http://127.0.0.1:2379",
 		PublicPathPrefix:      defaultPublicPathPrefix,
 		ClusterTLSConfig:      nil,
@@ -3,6 +3,11 @@
 package config
 
 import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 )
 
@@ -15,10 +20,54 @@ const (
 	DefaultProfilingAutoCollectionDurationSecs = 30
 	MaxProfilingAutoCollectionDurationSecs     = 120
 	DefaultProfilingAutoCollectionIntervalSecs = 3600
+	DefaultProfilingTriggerDurationSecs        = 30
+	DefaultProfilingTriggerCooldownSecs        = 1800
+	MinProfilingTriggerCooldownSecs            = 60
+
+	DefaultStatementArchiveIntervalSecs  = 1800
+	MinStatementArchiveIntervalSecs      = 60
+	DefaultStatementArchiveRetentionDays = 30
+
+	DefaultSlowQueryAlertIntervalSecs    = 60
+	MinSlowQueryAlertIntervalSecs        = 10
+	DefaultSlowQueryAlertBaselineWindows = 10
+
+	SlowQueryAlertRuleRate            = "rate"
+	SlowQueryAlertRuleDigestQueryTime = "digest_query_time"
+
+	AlertWebhookFormatJSON         = "json"
+	AlertWebhookFormatSlack        = "slack"
+	AlertWebhookFormatAlertmanager = "alertmanager"
+
+	DefaultLogSearchRetentionDays   = 7
+	DefaultLogSearchRetentionSizeMB = 10240
+	DefaultLogSearchMaxRunningTasks = 16
+	DefaultLogSearchDiskQuotaMB     = 20480
+
+	DefaultLogSearchMaxIndexedLinesPerTask = 100000
+	DefaultLogSearchMaxRecvMsgSizeMB       = 128
+	MaxLogSearchMaxRecvMsgSizeMB           = 1024
+	// Approximate size of an indexed log line besides its message, used to bound the indexed lines by the disk quota.
+	LogIndexLineOverheadBytes = 64
 )
 
 var (
-	KeyVisualPolicies = []string{KeyVisualDBPolicy, KeyVisualKVPolicy}
+	KeyVisualPolicies       = []string{KeyVisualDBPolicy, KeyVisualKVPolicy}
+	SlowQueryAlertRuleTypes = []string{SlowQueryAlertRuleRate, SlowQueryAlertRuleDigestQueryTime}
+	AlertWebhookFormats     = []string{AlertWebhookFormatJSON, AlertWebhookFormatSlack, AlertWebhookFormatAlertmanager}
+	// LogSourceKinds are the components whose logs can be collected from the log sources, when their diagnostics
+	// service is unavailable. The log source of TiFlash is the log of its proxy, which is not served by the
+	// diagnostics service of TiFlash.
+	LogSourceKinds = []model.NodeKind{
+		model.NodeKindTiFlash, model.NodeKindTiCDC, model.NodeKindTiProxy, model.NodeKindTSO, model.NodeKindScheduling,
+	}
+	// ProfilingTriggerKinds are the components which can be profiled by the trigger rules.
+	ProfilingTriggerKinds = []model.NodeKind{
+		model.NodeKindTiDB, model.NodeKindTiKV, model.NodeKindPD, model.NodeKindTiFlash,
+		model.NodeKindTiCDC, model.NodeKindTiProxy, model.NodeKindTSO, model.NodeKindScheduling,
+	}
+	// ProfilingTriggerTypes are the profiling types which can be requested by the trigger rules.
+	ProfilingTriggerTypes = []string{"cpu", "heap", "goroutine", "mutex", "block", "allocs", "threadcreate", "trace"}
 
 	ErrVerificationFailed = ErrorNS.NewType("verification failed")
 )
@@ -42,6 +91,182 @@ type ProfilingConfig struct {
 	AutoCollectionTargets      []model.RequestTargetNode `json:"auto_collection_targets"`
 	AutoCollectionDurationSecs uint                      `json:"auto_collection_duration_secs"`
 	AutoCollectionIntervalSecs uint                      `json:"auto_collection_interval_secs"`
+	// Start profiling when the metrics of some instances exceed the thresholds.
+	TriggerRules []ProfilingTriggerRule `json:"trigger_rules"`
+}
+
+// ProfilingTriggerRule profiles the instances of Kind whose value of Expr exceeds Threshold for ForSecs seconds.
+// Expr is a PromQL expression evaluated by Prometheus, and the instances are identified by the `instance` label
+// of the result, which must be the address to profile, e.g. `rate(process_cpu_seconds_total{job="tidb"}[1m])`.
+type ProfilingTriggerRule struct {
+	Name      string         `json:"name"`
+	Expr      string         `json:"expr"`
+	Kind      model.NodeKind `json:"kind"`
+	Threshold float64        `json:"threshold"`
+	ForSecs   uint           `json:"for_secs"`
+	// The rule is not triggered again within the cooldown after profiling is started.
+	CooldownSecs   uint     `json:"cooldown_secs"`
+	DurationSecs   uint     `json:"duration_secs"`
+	ProfilingTypes []string `json:"profiling_types"`
+}
+
+func (c *ProfilingConfig) validateTriggerRules() error {
+	names := make(map[string]struct{}, len(c.TriggerRules))
+	for _, r := range c.TriggerRules {
+		if r.Name == "" {
+			return ErrVerificationFailed.New("trigger rule name cannot be empty")
+		}
+		if _, ok := names[r.Name]; ok {
+			return ErrVerificationFailed.New("duplicated trigger rule name %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if r.Expr == "" {
+			return ErrVerificationFailed.New("expr of trigger rule %s cannot be empty", r.Name)
+		}
+		if !slices.Contains(ProfilingTriggerKinds, r.Kind) {
+			return ErrVerificationFailed.New("trigger rule kind must be in %v", ProfilingTriggerKinds)
+		}
+		for _, t := range r.ProfilingTypes {
+			if !slices.Contains(ProfilingTriggerTypes, t) {
+				return ErrVerificationFailed.New("profiling types of trigger rule %s must be in %v", r.Name, ProfilingTriggerTypes)
+			}
+		}
+		if r.DurationSecs == 0 || r.DurationSecs > MaxProfilingAutoCollectionDurationSecs {
+			return ErrVerificationFailed.New("duration_secs of trigger rule %s must be in [1, %d]", r.Name, MaxProfilingAutoCollectionDurationSecs)
+		}
+		if r.CooldownSecs < MinProfilingTriggerCooldownSecs {
+			return ErrVerificationFailed.New("cooldown_secs of trigger rule %s cannot be less than %d", r.Name, MinProfilingTriggerCooldownSecs)
+		}
+	}
+	return nil
+}
+
+// StatementConfig controls archiving statement summary snapshots into the local store, so that statements
+// evicted from the TiDB statement summary history are still available.
+type StatementConfig struct {
+	ArchiveEnabled       bool `json:"archive_enabled"`
+	ArchiveIntervalSecs  uint `json:"archive_interval_secs"`
+	ArchiveRetentionDays uint `json:"archive_retention_days"`
+}
+
+// LogSearchConfig controls how long the finished log search task groups and their downloaded logs are kept.
+// The oldest task groups are removed first when the total size of logs exceeds the limit.
+type LogSearchConfig struct {
+	RetentionDays   uint `json:"retention_days"`
+	RetentionSizeMB uint `json:"retention_size_mb"`
+	// The max number of tasks receiving logs at the same time, over all task groups.
+	MaxRunningTasks uint `json:"max_running_tasks"`
+	// The max rate of receiving logs from each instance. 0 means unlimited.
+	TargetRateLimitKBps uint `json:"target_rate_limit_kbps"`
+	// The max size of a message of logs received from each instance.
+	MaxRecvMsgSizeMB uint `json:"max_recv_msg_size_mb"`
+	// Tasks fail when the logs stored by all task groups exceed the quota.
+	DiskQuotaMB uint `json:"disk_quota_mb"`
+	// Lines after the limit are still available for downloading, but not indexed.
+	MaxIndexedLinesPerTask uint `json:"max_indexed_lines_per_task"`
+	// Where to collect the logs of the components without the diagnostics service.
+	LogSources []LogSourceConfig `json:"log_sources"`
+}
+
+// LogSourceConfig locates the log file of each instance of a component. Exactly one of HTTPPath and FilePath is
+// set. HTTPPath is requested from the address of the instance, e.g. `/debug/log`. FilePath is a glob pattern
+// relative to the `--log-source-dir` of the dashboard, in which `{ip}` and `{port}` are replaced by the address of
+// the instance, e.g. `{ip}-{port}/ticdc*.log` to match the rotated files as well.
+type LogSourceConfig struct {
+	Kind     model.NodeKind `json:"kind"`
+	HTTPPath string         `json:"http_path"`
+	FilePath string         `json:"file_path"`
+}
+
+// maxIndexedLinesInQuota returns the max number of lines whose index can be stored within the disk quota.
+func (c *LogSearchConfig) maxIndexedLinesInQuota() uint {
+	return c.DiskQuotaMB * 1024 * 1024 / LogIndexLineOverheadBytes
+}
+
+func (c *LogSearchConfig) validateLogSources() error {
+	kinds := make(map[model.NodeKind]struct{}, len(c.LogSources))
+	for _, src := range c.LogSources {
+		if !slices.Contains(LogSourceKinds, src.Kind) {
+			return ErrVerificationFailed.New("log source kind must be in %v", LogSourceKinds)
+		}
+		if _, ok := kinds[src.Kind]; ok {
+			return ErrVerificationFailed.New("duplicated log source of %s", src.Kind)
+		}
+		kinds[src.Kind] = struct{}{}
+		if (src.HTTPPath == "") == (src.FilePath == "") {
+			return ErrVerificationFailed.New("exactly one of http_path and file_path of %s must be set", src.Kind)
+		}
+		if src.HTTPPath != "" && !strings.HasPrefix(src.HTTPPath, "/") {
+			return ErrVerificationFailed.New("http_path of %s must start with /", src.Kind)
+		}
+		if src.FilePath != "" && filepath.IsAbs(src.FilePath) {
+			return ErrVerificationFailed.New("file_path of %s must be relative to the log source directory", src.Kind)
+		}
+		if _, err := filepath.Match(src.FilePath, ""); err != nil {
+			return ErrVerificationFailed.New("file_path of %s is not a valid glob pattern", src.Kind)
+		}
+	}
+	return nil
+}
+
+type SlowQueryAlertRule struct {
+	Name string `json:"name"`
+	// `rate` watches the number of slow queries per minute, `digest_query_time` watches the max query time
+	// in seconds of the slow queries of `digest`.
+	Type   string `json:"type"`
+	Digest string `json:"digest"`
+	// Alert when the value is not less than the threshold. 0 means disabled.
+	Threshold float64 `json:"threshold"`
+	// Alert when the value is not less than the rolling baseline multiplied by this ratio. 0 means disabled.
+	BaselineDeviation float64 `json:"baseline_deviation"`
+	// Number of recent polls to calculate the rolling baseline.
+	BaselineWindows uint `json:"baseline_windows"`
+}
+
+type AlertWebhook struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+}
+
+type SlowQueryAlertConfig struct {
+	Enabled      bool                 `json:"enabled"`
+	IntervalSecs uint                 `json:"interval_secs"`
+	Rules        []SlowQueryAlertRule `json:"rules"`
+	Webhooks     []AlertWebhook       `json:"webhooks"`
+}
+
+func (c *SlowQueryAlertConfig) validate() error {
+	if c.IntervalSecs < MinSlowQueryAlertIntervalSecs {
+		return ErrVerificationFailed.New("interval_secs cannot be less than %d", MinSlowQueryAlertIntervalSecs)
+	}
+	names := make(map[string]struct{}, len(c.Rules))
+	for _, r := range c.Rules {
+		if r.Name == "" {
+			return ErrVerificationFailed.New("rule name cannot be empty")
+		}
+		if _, ok := names[r.Name]; ok {
+			return ErrVerificationFailed.New("duplicated rule name %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if !slices.Contains(SlowQueryAlertRuleTypes, r.Type) {
+			return ErrVerificationFailed.New("rule type must be in %v", SlowQueryAlertRuleTypes)
+		}
+		if r.Type == SlowQueryAlertRuleDigestQueryTime && r.Digest == "" {
+			return ErrVerificationFailed.New("digest of rule %s cannot be empty", r.Name)
+		}
+		if r.Threshold <= 0 && r.BaselineDeviation <= 0 {
+			return ErrVerificationFailed.New("either threshold or baseline_deviation of rule %s must be set", r.Name)
+		}
+	}
+	for _, w := range c.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return ErrVerificationFailed.New("invalid webhook url %s", w.URL)
+		}
+		if !slices.Contains(AlertWebhookFormats, w.Format) {
+			return ErrVerificationFailed.New("webhook format must be in %v", AlertWebhookFormats)
+		}
+	}
+	return nil
 }
 
 type SSOCoreConfig struct {
@@ -62,15 +287,26 @@ type SSOConfig struct {
 }
 
 type DynamicConfig struct {
-	KeyVisual KeyVisualConfig `json:"keyvisual"`
-	Profiling ProfilingConfig `json:"profiling"`
-	SSO       SSOConfig       `json:"sso"`
+	KeyVisual      KeyVisualConfig      `json:"keyvisual"`
+	Profiling      ProfilingConfig      `json:"profiling"`
+	Statement      StatementConfig      `json:"statement"`
+	SlowQueryAlert SlowQueryAlertConfig `json:"slow_query_alert"`
+	LogSearch      LogSearchConfig      `json:"log_search"`
+	SSO            SSOConfig            `json:"sso"`
 }
 
 func (c *DynamicConfig) Clone() *DynamicConfig {
 	newCfg := *c
 	newCfg.Profiling.AutoCollectionTargets = make([]model.RequestTargetNode, len(c.Profiling.AutoCollectionTargets))
 	copy(newCfg.Profiling.AutoCollectionTargets, c.Profiling.AutoCollectionTargets)
+	newCfg.Profiling.TriggerRules = make([]ProfilingTriggerRule, len(c.Profiling.TriggerRules))
+	for i, r := range c.Profiling.TriggerRules {
+		r.ProfilingTypes = slices.Clone(r.ProfilingTypes)
+		newCfg.Profiling.TriggerRules[i] = r
+	}
+	newCfg.SlowQueryAlert.Rules = slices.Clone(c.SlowQueryAlert.Rules)
+	newCfg.SlowQueryAlert.Webhooks = slices.Clone(c.SlowQueryAlert.Webhooks)
+	newCfg.LogSearch.LogSources = slices.Clone(c.LogSearch.LogSources)
 	return &newCfg
 }
 
@@ -99,10 +335,85 @@ func (c *DynamicConfig) Validate() error {
 			return ErrVerificationFailed.New("auto_collection_interval_secs must be 0")
 		}
 	}
+	if err := c.Profiling.validateTriggerRules(); err != nil {
+		return err
+	}
+
+	if c.Statement.ArchiveEnabled {
+		if c.Statement.ArchiveIntervalSecs < MinStatementArchiveIntervalSecs {
+			return ErrVerificationFailed.New("archive_interval_secs cannot be less than %d", MinStatementArchiveIntervalSecs)
+		}
+		if c.Statement.ArchiveRetentionDays == 0 {
+			return ErrVerificationFailed.New("archive_retention_days cannot be 0")
+		}
+	}
+
+	if c.SlowQueryAlert.Enabled {
+		if err := c.SlowQueryAlert.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.LogSearch.RetentionDays == 0 {
+		return ErrVerificationFailed.New("retention_days cannot be 0")
+	}
+	if c.LogSearch.RetentionSizeMB == 0 {
+		return ErrVerificationFailed.New("retention_size_mb cannot be 0")
+	}
+	if c.LogSearch.MaxRunningTasks == 0 {
+		return ErrVerificationFailed.New("max_running_tasks cannot be 0")
+	}
+	if c.LogSearch.MaxRecvMsgSizeMB == 0 {
+		return ErrVerificationFailed.New("max_recv_msg_size_mb cannot be 0")
+	}
+	if c.LogSearch.MaxRecvMsgSizeMB > MaxLogSearchMaxRecvMsgSizeMB {
+		return ErrVerificationFailed.New("max_recv_msg_size_mb cannot be greater than %d", MaxLogSearchMaxRecvMsgSizeMB)
+	}
+	if c.LogSearch.DiskQuotaMB == 0 {
+		return ErrVerificationFailed.New("disk_quota_mb cannot be 0")
+	}
+	if c.LogSearch.MaxIndexedLinesPerTask == 0 {
+		return ErrVerificationFailed.New("max_indexed_lines_per_task cannot be 0")
+	}
+	if maxLines := c.LogSearch.maxIndexedLinesInQuota(); c.LogSearch.MaxIndexedLinesPerTask > maxLines {
+		return ErrVerificationFailed.New("max_indexed_lines_per_task cannot be greater than %d within the disk quota", maxLines)
+	}
+	if err := c.LogSearch.validateLogSources(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// applyOptions applies the options and validates the result. Values set by the options are validated as they
+// are, except the omitted fields of the rules, which are filled with the defaults.
+func (c *DynamicConfig) applyOptions(opts ...DynamicConfigOption) error {
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.fillRuleDefaults()
+	return c.Validate()
+}
+
+// fillRuleDefaults fills the defaults of the omitted fields of the rules. Rules are always replaced as a whole, so
+// that their omitted fields cannot keep the current values.
+func (c *DynamicConfig) fillRuleDefaults() {
+	for i := range c.Profiling.TriggerRules {
+		r := &c.Profiling.TriggerRules[i]
+		if r.DurationSecs == 0 {
+			r.DurationSecs = DefaultProfilingTriggerDurationSecs
+		}
+		if r.CooldownSecs == 0 {
+			r.CooldownSecs = DefaultProfilingTriggerCooldownSecs
+		}
+	}
+	for i := range c.SlowQueryAlert.Rules {
+		if c.SlowQueryAlert.Rules[i].BaselineWindows == 0 {
+			c.SlowQueryAlert.Rules[i].BaselineWindows = DefaultSlowQueryAlertBaselineWindows
+		}
+	}
+}
+
 // Adjust is used to fill the default config for the existing config of the old version.
 func (c *DynamicConfig) Adjust() {
 	if !c.KeyVisual.AutoCollectionDisabled {
@@ -125,4 +436,56 @@ func (c *DynamicConfig) Adjust() {
 		c.Profiling.AutoCollectionDurationSecs = 0
 		c.Profiling.AutoCollectionIntervalSecs = 0
 	}
+	c.fillRuleDefaults()
+	for i := range c.Profiling.TriggerRules {
+		r := &c.Profiling.TriggerRules[i]
+		if r.DurationSecs > MaxProfilingAutoCollectionDurationSecs {
+			r.DurationSecs = MaxProfilingAutoCollectionDurationSecs
+		}
+		if r.CooldownSecs < MinProfilingTriggerCooldownSecs {
+			r.CooldownSecs = MinProfilingTriggerCooldownSecs
+		}
+	}
+
+	if c.Statement.ArchiveIntervalSecs == 0 {
+		c.Statement.ArchiveIntervalSecs = DefaultStatementArchiveIntervalSecs
+	}
+	if c.Statement.ArchiveIntervalSecs < MinStatementArchiveIntervalSecs {
+		c.Statement.ArchiveIntervalSecs = MinStatementArchiveIntervalSecs
+	}
+	if c.Statement.ArchiveRetentionDays == 0 {
+		c.Statement.ArchiveRetentionDays = DefaultStatementArchiveRetentionDays
+	}
+
+	if c.SlowQueryAlert.IntervalSecs == 0 {
+		c.SlowQueryAlert.IntervalSecs = DefaultSlowQueryAlertIntervalSecs
+	}
+	if c.SlowQueryAlert.IntervalSecs < MinSlowQueryAlertIntervalSecs {
+		c.SlowQueryAlert.IntervalSecs = MinSlowQueryAlertIntervalSecs
+	}
+
+	if c.LogSearch.RetentionDays == 0 {
+		c.LogSearch.RetentionDays = DefaultLogSearchRetentionDays
+	}
+	if c.LogSearch.RetentionSizeMB == 0 {
+		c.LogSearch.RetentionSizeMB = DefaultLogSearchRetentionSizeMB
+	}
+	if c.LogSearch.MaxRunningTasks == 0 {
+		c.LogSearch.MaxRunningTasks = DefaultLogSearchMaxRunningTasks
+	}
+	if c.LogSearch.MaxRecvMsgSizeMB == 0 {
+		c.LogSearch.MaxRecvMsgSizeMB = DefaultLogSearchMaxRecvMsgSizeMB
+	}
+	if c.LogSearch.MaxRecvMsgSizeMB > MaxLogSearchMaxRecvMsgSizeMB {
+		c.LogSearch.MaxRecvMsgSizeMB = MaxLogSearchMaxRecvMsgSizeMB
+	}
+	if c.LogSearch.DiskQuotaMB == 0 {
+		c.LogSearch.DiskQuotaMB = DefaultLogSearchDiskQuotaMB
+	}
+	if c.LogSearch.MaxIndexedLinesPerTask == 0 {
+		c.LogSearch.MaxIndexedLinesPerTask = DefaultLogSearchMaxIndexedLinesPerTask
+	}
+	if maxLines := c.LogSearch.maxIndexedLinesInQuota(); c.LogSearch.MaxIndexedLinesPerTask > maxLines {
+		c.LogSearch.MaxIndexedLinesPerTask = maxLines
+	}
 }
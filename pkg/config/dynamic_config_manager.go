@@ -142,10 +142,7 @@ func (m *DynamicConfigManager) Modify(opts ...DynamicConfigOption) error {
 		return err
 	}
 
-	for _, opt := range opts {
-		opt(newDc)
-	}
-	if err := newDc.Validate(); err != nil {
+	if err := newDc.applyOptions(opts...); err != nil {
 		return err
 	}
 
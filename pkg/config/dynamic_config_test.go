@@ -0,0 +1,137 @@
+// Copyright 2024 PingCAP, Inc. Licensed under Apache-2.0.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+func newTestDynamicConfig() *DynamicConfig {
+	dc := &DynamicConfig{}
+	dc.Adjust()
+	return dc
+}
+
+func Test_applyOptionsRejectsZeroValues(t *testing.T) {
+	dc := newTestDynamicConfig()
+	err := dc.applyOptions(func(dc *DynamicConfig) {
+		dc.Profiling = ProfilingConfig{AutoCollectionTargets: []model.RequestTargetNode{{Kind: model.NodeKindTiDB}}}
+	})
+	require.ErrorContains(t, err, "auto_collection_duration_secs cannot be 0")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.MaxRunningTasks = 0
+	})
+	require.ErrorContains(t, err, "max_running_tasks cannot be 0")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.RetentionDays = 3
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint(DefaultLogSearchMaxRunningTasks), dc.LogSearch.MaxRunningTasks)
+}
+
+func Test_applyOptionsFillsSlowQueryAlertRules(t *testing.T) {
+	dc := newTestDynamicConfig()
+	err := dc.applyOptions(func(dc *DynamicConfig) {
+		dc.SlowQueryAlert.Rules = []SlowQueryAlertRule{{Name: "rate", Type: SlowQueryAlertRuleRate, Threshold: 1}}
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint(DefaultSlowQueryAlertBaselineWindows), dc.SlowQueryAlert.Rules[0].BaselineWindows)
+}
+
+func Test_applyOptionsFillsTriggerRules(t *testing.T) {
+	dc := newTestDynamicConfig()
+	err := dc.applyOptions(func(dc *DynamicConfig) {
+		dc.Profiling = ProfilingConfig{TriggerRules: []ProfilingTriggerRule{
+			{Name: "cpu", Kind: model.NodeKindTiDB, Expr: "up", Threshold: 1},
+		}}
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint(DefaultProfilingTriggerCooldownSecs), dc.Profiling.TriggerRules[0].CooldownSecs)
+	require.Equal(t, uint(DefaultProfilingTriggerDurationSecs), dc.Profiling.TriggerRules[0].DurationSecs)
+}
+
+func Test_applyOptionsValidates(t *testing.T) {
+	dc := newTestDynamicConfig()
+	// Invalid values are rejected instead of being adjusted.
+	err := dc.applyOptions(func(dc *DynamicConfig) {
+		dc.Profiling = ProfilingConfig{TriggerRules: []ProfilingTriggerRule{
+			{Name: "cpu", Kind: model.NodeKindTiDB, Expr: "up", CooldownSecs: 1},
+		}}
+	})
+	require.ErrorContains(t, err, "cooldown_secs")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.Profiling = ProfilingConfig{TriggerRules: []ProfilingTriggerRule{
+			{Name: "cpu", Kind: model.NodeKindTiDB, Expr: "up", ProfilingTypes: []string{"cpu", "flamegraph"}},
+		}}
+	})
+	require.ErrorContains(t, err, "profiling types")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.Statement = StatementConfig{ArchiveEnabled: true, ArchiveIntervalSecs: 1}
+	})
+	require.ErrorContains(t, err, "archive_interval_secs")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.LogSources = []LogSourceConfig{{Kind: model.NodeKindTiCDC, FilePath: "/var/log/ticdc.log"}}
+	})
+	require.ErrorContains(t, err, "file_path")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.LogSources = []LogSourceConfig{{Kind: model.NodeKindTiFlash, FilePath: "{ip}/tiflash_tikv[.log"}}
+	})
+	require.ErrorContains(t, err, "glob pattern")
+}
+
+func Test_maxIndexedLinesPerTaskBoundedByDiskQuota(t *testing.T) {
+	dc := newTestDynamicConfig()
+	require.Equal(t, uint(DefaultLogSearchMaxIndexedLinesPerTask), dc.LogSearch.MaxIndexedLinesPerTask)
+
+	err := dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.MaxIndexedLinesPerTask = 0
+	})
+	require.ErrorContains(t, err, "max_indexed_lines_per_task cannot be 0")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.DiskQuotaMB = 1
+		dc.LogSearch.MaxIndexedLinesPerTask = 1024*1024/LogIndexLineOverheadBytes + 1
+	})
+	require.ErrorContains(t, err, "within the disk quota")
+
+	dc = &DynamicConfig{LogSearch: LogSearchConfig{DiskQuotaMB: 1, MaxIndexedLinesPerTask: 1 << 30}}
+	dc.Adjust()
+	require.Equal(t, uint(1024*1024/LogIndexLineOverheadBytes), dc.LogSearch.MaxIndexedLinesPerTask)
+}
+
+func Test_maxRecvMsgSizeBounded(t *testing.T) {
+	dc := newTestDynamicConfig()
+	require.Equal(t, uint(DefaultLogSearchMaxRecvMsgSizeMB), dc.LogSearch.MaxRecvMsgSizeMB)
+
+	err := dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.MaxRecvMsgSizeMB = 0
+	})
+	require.ErrorContains(t, err, "max_recv_msg_size_mb cannot be 0")
+
+	dc = newTestDynamicConfig()
+	err = dc.applyOptions(func(dc *DynamicConfig) {
+		dc.LogSearch.MaxRecvMsgSizeMB = MaxLogSearchMaxRecvMsgSizeMB + 1
+	})
+	require.ErrorContains(t, err, "max_recv_msg_size_mb cannot be greater than")
+
+	dc = &DynamicConfig{LogSearch: LogSearchConfig{MaxRecvMsgSizeMB: 1 << 20}}
+	dc.Adjust()
+	require.Equal(t, uint(MaxLogSearchMaxRecvMsgSizeMB), dc.LogSearch.MaxRecvMsgSizeMB)
+}
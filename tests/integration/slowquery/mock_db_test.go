@@ -262,6 +262,58 @@ func (s *testMockDBSuite) TestGetListAllRequest() {
 	s.Require().Contains(ds2[0].Digest, digest)
 }
 
+func (s *testMockDBSuite) TestGetListCursorRequest() {
+	all := s.mustQuerySlowLogList(&slowquery.GetListRequest{IsDesc: true})
+	s.Require().Len(all, 9)
+
+	var paged []slowquery.Model
+	req := &slowquery.GetListRequest{IsDesc: true, Limit: 4}
+	for {
+		ds := s.mustQuerySlowLogList(req)
+		paged = append(paged, ds...)
+		cursor, err := slowquery.NextSlowLogListCursor(req, ds)
+		s.Require().NoError(err)
+		if cursor == "" {
+			break
+		}
+		req = &slowquery.GetListRequest{IsDesc: true, Limit: 4, Cursor: cursor}
+	}
+	s.Require().Len(paged, len(all))
+	for i := range all {
+		s.Require().Equal(all[i].Timestamp, paged[i].Timestamp)
+		s.Require().Equal(all[i].ConnectionID, paged[i].ConnectionID)
+	}
+
+	total, err := slowquery.CountSlowLogList(&slowquery.GetListRequest{}, s.mockDBSession())
+	s.Require().NoError(err)
+	s.Require().EqualValues(9, total)
+
+	_, err = slowquery.QuerySlowLogList(&slowquery.GetListRequest{Cursor: "invalid"}, s.sysSchema, s.mockDBSession())
+	s.Require().Error(err)
+}
+
+func (s *testMockDBSuite) TestGetGroupsRequest() {
+	ds, err := slowquery.QuerySlowLogGroups(&slowquery.GetGroupRequest{GroupBy: "digest"}, s.sysSchema, s.mockDBSession())
+	s.Require().NoError(err)
+	s.Require().NotEmpty(ds)
+
+	count := 0
+	for i, d := range ds {
+		count += d.Count
+		s.Require().Equal(d.GroupKey, d.SampleDigest)
+		s.Require().LessOrEqual(d.P50QueryTime, d.P90QueryTime)
+		s.Require().LessOrEqual(d.P90QueryTime, d.P99QueryTime)
+		s.Require().LessOrEqual(d.P99QueryTime, d.MaxQueryTime)
+		if i > 0 {
+			s.Require().LessOrEqual(d.SumQueryTime, ds[i-1].SumQueryTime)
+		}
+	}
+	s.Require().Equal(9, count)
+
+	_, err = slowquery.QuerySlowLogGroups(&slowquery.GetGroupRequest{GroupBy: "query"}, s.sysSchema, s.mockDBSession())
+	s.Require().Error(err)
+}
+
 func (s *testMockDBSuite) TestGetDetailRequest() {
 	ds, err := s.mustQuerySlowLogDetail(&slowquery.GetDetailRequest{
 		Digest:    "2375da6810d9c5a0d1c84875b1376bfd469ad952c1884f5dc1d6f36fc953b5df",